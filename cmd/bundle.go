@@ -2,12 +2,8 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-	"gopkg.in/yaml.v3"
 
 	"orecert/internal/bundle"
 )
@@ -18,27 +14,33 @@ var bundleCmd = &cobra.Command{
 	Short: "PEM → P12/JKS 梱包",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
-			return fmt.Errorf("profile required")
+			return configError(fmt.Errorf("profile required"))
 		}
 		typ, _ := cmd.Flags().GetString("type")
-		profileBytes, err := os.ReadFile(args[0])
-		if err != nil {
-			return err
-		}
 		var prof struct {
-			CN string `yaml:"cn"`
+			CN      string `yaml:"cn"`
+			KeyPass string `yaml:"key_pass"`
 		}
-		if err := yaml.Unmarshal(profileBytes, &prof); err != nil {
+		if err := readProfile(args[0], &prof); err != nil {
 			return err
 		}
 		var cfg bundle.Config
-		if err := viper.Unmarshal(&cfg); err != nil {
+		if err := loadConfig(&cfg); err != nil {
 			return err
 		}
+		cfg.KeyPass = prof.KeyPass
 		if err := bundle.Bundle(cfg, prof.CN, typ); err != nil {
-			return err
+			return withCN(prof.CN, err)
+		}
+		paths := certPaths(cfg.Layout, prof.CN)
+		files := map[string]string{}
+		if typ == "pkcs" || typ == "all" {
+			files["pkcs12"] = paths.PKCS12
+		}
+		if typ == "jks" || typ == "all" {
+			files["jks"] = paths.JKS
 		}
-		fmt.Println("✅", filepath.Join("certs", prof.CN))
+		success(cmd, "✅ "+paths.Dir, result{CN: prof.CN, Files: files})
 		return nil
 	},
 }
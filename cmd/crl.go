@@ -0,0 +1,165 @@
+/*
+Copyright © 2025 ramsesyok
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"orecert/internal/crl"
+)
+
+// crlCmd represents the crl command group
+var crlCmd = &cobra.Command{
+	Use:   "crl",
+	Short: "CRL の表示・再署名・整理・出力",
+}
+
+var crlShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "CRL のエントリ一覧",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := crlConfig(cmd)
+		if err != nil {
+			return err
+		}
+		issuer, _ := cmd.Flags().GetString("issuer")
+		info, err := crl.Show(cfg, issuer)
+		if err != nil {
+			return err
+		}
+		if jsonOutput() {
+			success(cmd, "", result{Files: map[string]string{"crl": info.Path}, Data: info})
+			return nil
+		}
+		fmt.Printf("CRL: %s (number %s)\n", info.Path, info.Number)
+		if !info.ThisUpdate.IsZero() {
+			fmt.Printf("This Update: %s\nNext Update: %s\n", info.ThisUpdate.Format(time.RFC3339), info.NextUpdate.Format(time.RFC3339))
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SERIAL\tCN\tREVOKED\tREASON\tINVALIDITY")
+		for _, e := range info.Entries {
+			inv := "-"
+			if e.InvalidityDate != nil {
+				inv = e.InvalidityDate.Format(time.RFC3339)
+			}
+			cn := e.CN
+			if cn == "" {
+				cn = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Serial, cn, e.RevokedAt.Format(time.RFC3339), e.Reason, inv)
+		}
+		return w.Flush()
+	},
+}
+
+var crlRefreshCmd = &cobra.Command{
+	Use:   "refresh",
+	Short: "CRL を新しい番号で再署名",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := crlConfig(cmd)
+		if err != nil {
+			return err
+		}
+		issuers, err := crlIssuers(cmd, cfg)
+		if err != nil {
+			return err
+		}
+		for _, iss := range issuers {
+			if err := crl.Refresh(cfg, iss); err != nil {
+				return err
+			}
+			info, err := crl.Show(cfg, iss)
+			if err != nil {
+				return err
+			}
+			success(cmd, fmt.Sprintf("✅ %s (Next Update: %s)", info.Path, info.NextUpdate.Format("2006-01-02")), result{Expires: info.NextUpdate.Format("2006-01-02"), Files: map[string]string{"crl": info.Path}})
+		}
+		return nil
+	},
+}
+
+var crlPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "期限切れ証明書のエントリを削除",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := crlConfig(cmd)
+		if err != nil {
+			return err
+		}
+		issuers, err := crlIssuers(cmd, cfg)
+		if err != nil {
+			return err
+		}
+		for _, iss := range issuers {
+			n, err := crl.Prune(cfg, iss)
+			if err != nil {
+				return err
+			}
+			info, err := crl.Show(cfg, iss)
+			if err != nil {
+				return err
+			}
+			success(cmd, fmt.Sprintf("✅ %s (pruned %d)", info.Path, n), result{Files: map[string]string{"crl": info.Path}, Data: map[string]int{"pruned": n}})
+		}
+		return nil
+	},
+}
+
+var crlExportCmd = &cobra.Command{
+	Use:   "export [out]",
+	Short: "CRL を PEM/DER で出力",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return configError(fmt.Errorf("output path required"))
+		}
+		cfg, err := crlConfig(cmd)
+		if err != nil {
+			return err
+		}
+		issuer, _ := cmd.Flags().GetString("issuer")
+		format, _ := cmd.Flags().GetString("format")
+		if err := crl.Export(cfg, issuer, format, args[0]); err != nil {
+			return err
+		}
+		success(cmd, "✅ "+args[0], result{Files: map[string]string{"crl": args[0]}})
+		return nil
+	},
+}
+
+// crlConfig は設定を読み込み、--days 指定があれば CRL 有効日数を上書きします。
+func crlConfig(cmd *cobra.Command) (crl.Config, error) {
+	var cfg crl.Config
+	if err := loadConfig(&cfg); err != nil {
+		return cfg, err
+	}
+	if f := cmd.Flags().Lookup("days"); f != nil && f.Changed {
+		cfg.CRLDays, _ = cmd.Flags().GetInt("days")
+	}
+	return cfg, nil
+}
+
+// crlIssuers は --all 指定時は全署名 CA を、それ以外は --issuer の CA を返します。
+func crlIssuers(cmd *cobra.Command, cfg crl.Config) ([]string, error) {
+	if all, _ := cmd.Flags().GetBool("all"); all {
+		return crl.Issuers(cfg)
+	}
+	issuer, _ := cmd.Flags().GetString("issuer")
+	return []string{issuer}, nil
+}
+
+func init() {
+	rootCmd.AddCommand(crlCmd)
+	crlCmd.AddCommand(crlShowCmd, crlRefreshCmd, crlPruneCmd, crlExportCmd)
+	crlCmd.PersistentFlags().String("issuer", "", "intermediate CA name (default root CA)")
+	for _, c := range []*cobra.Command{crlRefreshCmd, crlPruneCmd} {
+		c.Flags().Bool("all", false, "process root and all intermediate CAs")
+		c.Flags().Int("days", 0, "CRL lifetime in days (default crl_days or 30)")
+	}
+	crlExportCmd.Flags().String("format", "pem", "output format (pem|der)")
+}
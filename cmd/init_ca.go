@@ -4,9 +4,8 @@ Copyright © 2025 ramsesyok
 package cmd
 
 import (
-	"fmt"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
+
 	"orecert/internal/ca"
 )
 
@@ -14,16 +13,20 @@ import (
 var initCaCmd = &cobra.Command{
 	Use:   "init-ca",
 	Short: "ルート CA 鍵 + 証明書生成",
-	Long:  `certs/ca/ 配下に自己署名CA証明書と秘密鍵を生成します。`,
+	Long:  `certs_dir (既定 certs/) の ca/ 配下に自己署名CA証明書と秘密鍵を生成します。`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		var cfg ca.Config
-		if err := viper.Unmarshal(&cfg); err != nil {
+		if err := loadConfig(&cfg); err != nil {
 			return err
 		}
 		if err := ca.InitCA(cfg); err != nil {
 			return err
 		}
-		fmt.Println("✅", cfg.CA.Cert)
+		cert := cfg.CA.Cert
+		if cert == "" {
+			cert = cfg.CAPath("cert.pem")
+		}
+		success(cmd, "✅ "+cert, result{Expires: expires(cert), Files: map[string]string{"cert": cert}})
 		return nil
 	},
 }
@@ -0,0 +1,49 @@
+/*
+Copyright © 2025 ramsesyok
+*/
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"orecert/internal/ca"
+	"orecert/internal/issue"
+)
+
+// initIntermediateCmd represents the init-intermediate command
+var initIntermediateCmd = &cobra.Command{
+	Use:   "init-intermediate [name]",
+	Short: "中間 CA 鍵 + 証明書生成",
+	Long: `certs/ca/intermediates/<name>/ 配下にルート CA (または --parent で指定した中間 CA) が
+署名した中間 CA 証明書と秘密鍵を生成します。`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return configError(fmt.Errorf("name required"))
+		}
+		parent, _ := cmd.Flags().GetString("parent")
+		pathLen, _ := cmd.Flags().GetInt("path-len")
+		var cfg ca.Config
+		if err := loadConfig(&cfg); err != nil {
+			return err
+		}
+		if err := ca.InitIntermediate(cfg, args[0], parent, pathLen); err != nil {
+			return err
+		}
+		caCert := cfg.CA.Cert
+		if caCert == "" {
+			caCert = cfg.CAPath("cert.pem")
+		}
+		cert := filepath.Join(issue.IntermediateDir(caCert, args[0]), "cert.pem")
+		success(cmd, "✅ "+cert, result{CN: args[0], Expires: expires(cert), Files: map[string]string{"cert": cert}})
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(initIntermediateCmd)
+	initIntermediateCmd.Flags().String("parent", "", "signing intermediate CA name (default root CA)")
+	initIntermediateCmd.Flags().Int("path-len", 0, "path length constraint (-1 for none)")
+}
@@ -0,0 +1,36 @@
+/*
+Copyright © 2025 ramsesyok
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"orecert/internal/ocsp"
+)
+
+// initOCSPCmd represents the init-ocsp command
+var initOCSPCmd = &cobra.Command{
+	Use:   "init-ocsp",
+	Short: "OCSP 署名用の委任証明書を生成",
+	Long: `署名 CA のディレクトリの ocsp/ 配下に OCSPSigning の EKU を持つ委任証明書と
+秘密鍵を生成します。serve ocsp --signer delegated で使用します。`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var cfg ocsp.Config
+		if err := loadConfig(&cfg); err != nil {
+			return err
+		}
+		issuer, _ := cmd.Flags().GetString("issuer")
+		path, err := ocsp.InitSigner(cfg, issuer)
+		if err != nil {
+			return err
+		}
+		success(cmd, "✅ "+path, result{Expires: expires(path), Files: map[string]string{"cert": path}})
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(initOCSPCmd)
+	initOCSPCmd.Flags().String("issuer", "", "signing intermediate CA name (default root CA)")
+}
@@ -0,0 +1,52 @@
+/*
+Copyright © 2025 ramsesyok
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"orecert/internal/inspect"
+	"orecert/internal/issue"
+)
+
+// inspectCmd represents the inspect command
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <file|CN>",
+	Short: "証明書・CSR・CRL・キーストアの内容表示",
+	Long: `PEM/DER の証明書・CSR・CRL・秘密鍵、PKCS#12、JKS を自動判別して内容を表示します。
+CN を指定した場合は出力レイアウト上の cert.pem を表示します。`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return configError(fmt.Errorf("file or CN required"))
+		}
+		pw, _ := cmd.Flags().GetString("password")
+		if pw == "" {
+			pw = viper.GetString("pkcs12_password")
+		}
+		format, _ := cmd.Flags().GetString("output")
+		var layout issue.Layout
+		if err := loadConfig(&layout); err != nil {
+			return err
+		}
+		r, err := inspect.File(inspect.Resolve(layout, args[0]), inspect.Options{Password: pw})
+		if err != nil {
+			return err
+		}
+		if jsonOutput() && !cmd.Flags().Changed("output") {
+			success(cmd, "", result{Files: map[string]string{r.Kind: r.Path}, Data: r})
+			return nil
+		}
+		return inspect.Write(os.Stdout, r, format)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+	inspectCmd.Flags().StringP("output", "o", "text", "output format (text|json)")
+	inspectCmd.Flags().String("password", "", "PKCS#12/JKS password source (prompt:, file:<path> or literal)")
+}
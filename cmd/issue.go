@@ -5,41 +5,191 @@ package cmd
 
 import (
 	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-	"gopkg.in/yaml.v3"
 
 	"orecert/internal/issue"
+	"orecert/internal/profile"
 )
 
 // issueCmd represents the issue command
 var issueCmd = &cobra.Command{
-	Use:   "issue",
+	Use:   "issue <profile>",
 	Short: "鍵+CSR+証明書生成",
+	Long: `プロファイルから鍵・CSR・証明書を生成します。
+--all ではディレクトリ内の *.yaml / *.yml、またはグロブに一致するプロファイルをまとめて発行します。
+CA の鍵は 1 回だけ読み込み、--parallel 件ずつ並列に発行します。失敗したプロファイルがあっても
+残りの発行は続けます。
+プロファイルの文字列の値には {{.name}} のような変数を書けます。値は --set key=value か
+--values の CSV (先頭行が変数名) / YAML (マップのリスト) で指定し、--values の 1 行ごとに 1 枚発行します。`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		typ, _ := cmd.Flags().GetString("type")
-		if len(args) != 1 {
-			return fmt.Errorf("profile required")
+		all, _ := cmd.Flags().GetBool("all")
+		if len(args) == 0 || (!all && len(args) != 1) {
+			return configError(fmt.Errorf("profile required"))
 		}
 		var cfg issue.Config
-		if err := viper.Unmarshal(&cfg); err != nil {
+		if err := loadConfig(&cfg); err != nil {
 			return err
 		}
-		data, err := os.ReadFile(args[0])
+		if issuer, _ := cmd.Flags().GetString("issuer"); issuer != "" {
+			cfg.Issuer = issuer
+		}
+		rows, err := valueRows(cmd)
 		if err != nil {
 			return err
 		}
-		var prof issue.Profile
-		if err := yaml.Unmarshal(data, &prof); err != nil {
+		if all || len(rows) > 1 {
+			workers, _ := cmd.Flags().GetInt("parallel")
+			return issueAll(cmd, cfg, args, rows, typ, workers)
+		}
+		jobs, err := profileJobs(args[0], rows)
+		if err != nil {
 			return err
 		}
-		return issue.Issue(cfg, prof, typ)
+		prof := jobs[0].Profile
+		if err := issue.Issue(cfg, prof, typ); err != nil {
+			return withCN(prof.CN, err)
+		}
+		paths := certPaths(cfg.Layout, prof.CN)
+		exp := expires(paths.Cert)
+		success(cmd, fmt.Sprintf("✅ %s (Expires: %s)", paths.Cert, exp), result{CN: prof.CN, Type: typ, Expires: exp, Files: certFiles(paths, true)})
+		return nil
 	},
 }
 
+// issueAll は args のディレクトリ・グロブに一致するプロファイルを rows の行ごとに展開して一括発行し、
+// 結果を 1 件ずつ出力します。
+func issueAll(cmd *cobra.Command, cfg issue.Config, args []string, rows []map[string]string, typ string, workers int) error {
+	files, err := profileFiles(args)
+	if err != nil {
+		return configError(err)
+	}
+	var jobs []issue.Job
+	var failed, total int
+	for _, f := range files {
+		js, err := profileJobs(f, rows)
+		if err != nil {
+			failed++
+			total++
+			failure(cmd, f, err)
+			continue
+		}
+		jobs = append(jobs, js...)
+		total += len(js)
+	}
+	for _, r := range issue.IssueAll(cfg, jobs, typ, workers) {
+		if r.Err != nil {
+			failed++
+			failure(cmd, r.Name, r.Err)
+			continue
+		}
+		paths := certPaths(cfg.Layout, r.Profile.CN)
+		exp := expires(paths.Cert)
+		success(cmd, fmt.Sprintf("✅ %s: %s (Expires: %s)", r.Name, paths.Cert, exp), result{CN: r.Profile.CN, Type: typ, Expires: exp, Files: certFiles(paths, true)})
+	}
+	if !jsonOutput() {
+		fmt.Printf("%d issued, %d failed\n", total-failed, failed)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d profiles failed", failed, total)
+	}
+	return nil
+}
+
+// profileJobs は path のプロファイルを rows の行ごとに変数を展開して読み込みます。
+// 行が複数ある場合の名前は "path[行番号]" です。失敗は設定エラーです。
+func profileJobs(path string, rows []map[string]string) ([]issue.Job, error) {
+	m, err := mergedProfile(path)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]issue.Job, 0, len(rows))
+	for i, row := range rows {
+		name := path
+		if len(rows) > 1 {
+			name = fmt.Sprintf("%s[%d]", path, i+1)
+		}
+		r, err := profile.Render(m, row)
+		if err != nil {
+			return nil, configError(fmt.Errorf("%s: %w", name, err))
+		}
+		prof := issue.Profile{Source: profileRef(path)}
+		if err := profile.Decode(r, &prof); err != nil {
+			return nil, configError(fmt.Errorf("%s: %w", name, err))
+		}
+		jobs = append(jobs, issue.Job{Name: name, Profile: prof})
+	}
+	return jobs, nil
+}
+
+// valueRows は --values の各行に --set の値を重ねた変数の一覧です。
+// --values が無い場合は --set の値だけの 1 行です。
+func valueRows(cmd *cobra.Command) ([]map[string]string, error) {
+	sets, _ := cmd.Flags().GetStringArray("set")
+	set := map[string]string{}
+	for _, kv := range sets {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, configError(fmt.Errorf("invalid --set %q: want key=value", kv))
+		}
+		set[strings.TrimSpace(k)] = v
+	}
+	rows := []map[string]string{{}}
+	if path, _ := cmd.Flags().GetString("values"); path != "" {
+		var err error
+		if rows, err = profile.ReadValues(path); err != nil {
+			return nil, configError(err)
+		}
+	}
+	for _, row := range rows {
+		maps.Copy(row, set)
+	}
+	return rows, nil
+}
+
+// profileFiles は引数をプロファイルのパスに展開します。ディレクトリは直下の *.yaml / *.yml、
+// グロブは一致するファイルです。結果は名前順で重複を除きます。
+func profileFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		var matches []string
+		if fi, err := os.Stat(arg); err == nil && fi.IsDir() {
+			for _, pat := range []string{"*.yaml", "*.yml"} {
+				m, _ := filepath.Glob(filepath.Join(arg, pat))
+				matches = append(matches, m...)
+			}
+		} else if m, err := filepath.Glob(arg); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", arg, err)
+		} else {
+			matches = m
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no profiles match %s", arg)
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return slices.Compact(files), nil
+}
+
 func init() {
 	rootCmd.AddCommand(issueCmd)
-	issueCmd.Flags().StringP("type", "t", "server", "select issue type")
+	issueCmd.Flags().StringP("type", "t", "server", "issue type (server|client|both|codesign|smime|timestamp|ocsp)")
+	issueCmd.Flags().String("issuer", "", "signing intermediate CA name (default root CA)")
+	issueCmd.Flags().Bool("all", false, "issue every profile in the given directories or globs")
+	issueCmd.Flags().IntP("parallel", "j", 0, "number of certificates issued at the same time with --all or --values (default CPU count)")
+	addValueFlags(issueCmd)
+}
+
+// addValueFlags はプロファイルの変数を指定するフラグを追加します。
+func addValueFlags(c *cobra.Command) {
+	c.Flags().StringArray("set", nil, "profile variable as key=value (repeatable, overrides --values)")
+	c.Flags().String("values", "", "CSV or YAML file with one set of profile variables per certificate")
 }
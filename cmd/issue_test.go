@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestProfileFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "profiles"), 0755)
+	for _, f := range []string{"b.yaml", "a.yml", "notes.txt"} {
+		os.WriteFile(filepath.Join(dir, "profiles", f), []byte("cn: x\n"), 0644)
+	}
+	a := filepath.Join(dir, "profiles", "a.yml")
+	b := filepath.Join(dir, "profiles", "b.yaml")
+
+	got, err := profileFiles([]string{filepath.Join(dir, "profiles")})
+	if err != nil || !slices.Equal(got, []string{a, b}) {
+		t.Fatalf("dir: %v %v", got, err)
+	}
+	got, err = profileFiles([]string{filepath.Join(dir, "profiles", "*.yaml"), b})
+	if err != nil || !slices.Equal(got, []string{b}) {
+		t.Fatalf("glob: %v %v", got, err)
+	}
+	if _, err := profileFiles([]string{filepath.Join(dir, "none", "*.yaml")}); err == nil {
+		t.Fatal("expected error for no match")
+	}
+}
+
+func TestProfileCN(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "api"), 0755)
+	os.WriteFile(filepath.Join(dir, "web"), []byte("not yaml: ["), 0644)
+	os.WriteFile(filepath.Join(dir, "db.yaml"), []byte("cn: db\nkey_pass: secret\n"), 0644)
+	for _, c := range []struct{ arg, cn, pass string }{
+		{filepath.Join(dir, "api"), filepath.Join(dir, "api"), ""},
+		{filepath.Join(dir, "web"), filepath.Join(dir, "web"), ""},
+		{filepath.Join(dir, "db.yaml"), "db", "secret"},
+		{"mail", "mail", ""},
+	} {
+		cn, pass, err := profileCN(c.arg)
+		if err != nil || cn != c.cn || pass != c.pass {
+			t.Errorf("%s: %q %q %v", c.arg, cn, pass, err)
+		}
+	}
+}
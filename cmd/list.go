@@ -0,0 +1,53 @@
+/*
+Copyright © 2025 ramsesyok
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"orecert/internal/inventory"
+)
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "発行済み証明書の一覧",
+	Long:  `certs/ 配下の証明書の CN・種別・アルゴリズム・シリアル・有効期限・残り日数・失効状態を表示します。`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var cfg inventory.Config
+		if err := loadConfig(&cfg); err != nil {
+			return err
+		}
+		var f inventory.Filter
+		if s, _ := cmd.Flags().GetString("expiring"); s != "" {
+			d, err := parseSpan(s)
+			if err != nil {
+				return configError(err)
+			}
+			f.Expiring = d
+		}
+		f.Type, _ = cmd.Flags().GetString("type")
+		f.Revoked, _ = cmd.Flags().GetBool("revoked")
+		format, _ := cmd.Flags().GetString("output")
+		items, err := inventory.List(cfg, f)
+		if err != nil {
+			return err
+		}
+		if jsonOutput() && !cmd.Flags().Changed("output") {
+			success(cmd, "", result{Data: items})
+			return nil
+		}
+		return inventory.Write(os.Stdout, items, format)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().StringP("output", "o", "table", "output format (table|json|csv)")
+	listCmd.Flags().String("expiring", "", "only certificates expiring within this period (e.g. 30d)")
+	listCmd.Flags().StringP("type", "t", "", "only certificates of this type")
+	listCmd.Flags().Bool("revoked", false, "only revoked certificates")
+}
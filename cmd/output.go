@@ -0,0 +1,343 @@
+/*
+Copyright © 2025 ramsesyok
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+	"software.sslmate.com/src/go-pkcs12"
+
+	"orecert/internal/ca"
+	"orecert/internal/crl"
+	"orecert/internal/db"
+	"orecert/internal/inspect"
+	"orecert/internal/inventory"
+	"orecert/internal/issue"
+	"orecert/internal/ocsp"
+	"orecert/internal/password"
+	"orecert/internal/pkcs8"
+	"orecert/internal/plan"
+	"orecert/internal/profile"
+	"orecert/internal/revoke"
+	"orecert/internal/verify"
+)
+
+// 終了コード (要件 8 章) です。
+const (
+	ExitOK       = 0
+	ExitConfig   = 1
+	ExitGenerate = 2
+	ExitExists   = 3
+	ExitPassword = 4
+	ExitVerify   = 5
+	ExitInternal = 10
+)
+
+// exitError は終了コードを指定したエラーです。
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// cnError は対象の CN を付けたエラーです。JSON 出力のエラーの cn に使います。
+type cnError struct {
+	cn  string
+	err error
+}
+
+func (e *cnError) Error() string { return e.err.Error() }
+func (e *cnError) Unwrap() error { return e.err }
+
+// withCN は err に対象の CN を付けます。err が nil または cn が空の場合は err のままです。
+func withCN(cn string, err error) error {
+	if err == nil || cn == "" {
+		return err
+	}
+	return &cnError{cn: cn, err: err}
+}
+
+// configError は設定・プロファイル・引数の誤りとして終了コード 1 を付与します。
+func configError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: ExitConfig, err: err}
+}
+
+// exitCodes は既知のエラーと終了コードの対応です。
+var exitCodes = []struct {
+	err  error
+	code int
+}{
+	{issue.ErrInvalidCN, ExitConfig},
+	{issue.ErrInvalidType, ExitConfig},
+	{issue.ErrSANMode, ExitConfig},
+	{issue.ErrSANMismatch, ExitConfig},
+	{issue.ErrKeyUsage, ExitConfig},
+	{issue.ErrUnknownUsage, ExitConfig},
+	{issue.ErrInvalidSubject, ExitConfig},
+	{issue.ErrInvalidLayout, ExitConfig},
+	{issue.ErrExternalKey, ExitConfig},
+	{issue.ErrUnknownIssuer, ExitConfig},
+	{ca.ErrInvalidName, ExitConfig},
+	{ca.ErrPathLen, ExitConfig},
+	{ca.ErrUnsupportedBits, ExitConfig},
+	{ca.ErrUnsupportedCurve, ExitConfig},
+	{revoke.ErrInvalidReason, ExitConfig},
+	{revoke.ErrInvalidityDate, ExitConfig},
+	{revoke.ErrInvalidSerial, ExitConfig},
+	{crl.ErrInvalidFormat, ExitConfig},
+	{inventory.ErrInvalidFormat, ExitConfig},
+	{inspect.ErrInvalidFormat, ExitConfig},
+	{ocsp.ErrInvalidSigner, ExitConfig},
+	{plan.ErrDuplicateCN, ExitConfig},
+	{profile.ErrCycle, ExitConfig},
+	{profile.ErrTemplate, ExitConfig},
+	{profile.ErrValues, ExitConfig},
+	{issue.ErrExists, ExitExists},
+	{ca.ErrExists, ExitExists},
+	{password.ErrPassword, ExitPassword},
+	{pkcs8.ErrDecrypt, ExitPassword},
+	{pkcs12.ErrIncorrectPassword, ExitPassword},
+	{pkcs12.ErrDecryption, ExitPassword},
+	{verify.ErrExpired, ExitVerify},
+	{verify.ErrVerify, ExitVerify},
+	{verify.ErrRevoked, ExitVerify},
+	{verify.ErrCRLSignature, ExitVerify},
+	{verify.ErrCRLStale, ExitVerify},
+	{revoke.ErrAlreadyRevoked, ExitVerify},
+	{issue.ErrCSRSignature, ExitVerify},
+	{inspect.ErrUnknownFormat, ExitVerify},
+	{db.ErrNotFound, ExitVerify},
+}
+
+// commandCodes は既知のエラーに該当しない場合のコマンド別の終了コードです。
+// 記載の無いコマンドは ExitConfig です。
+var commandCodes = map[string]int{
+	"init-ca":           ExitGenerate,
+	"init-intermediate": ExitGenerate,
+	"init-ocsp":         ExitGenerate,
+	"issue":             ExitGenerate,
+	"renew":             ExitGenerate,
+	"sign-csr":          ExitVerify,
+	"bundle":            ExitVerify,
+	"verify":            ExitVerify,
+	"revoke":            ExitVerify,
+	"crl":               ExitVerify,
+	"inspect":           ExitVerify,
+}
+
+// exitCode は実行したコマンドとエラーから終了コードを決めます。
+func exitCode(cmd *cobra.Command, err error) int {
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return ee.code
+	}
+	for _, c := range exitCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	var parseErr viper.ConfigParseError
+	var typeErr *yaml.TypeError
+	if errors.As(err, &parseErr) || errors.As(err, &typeErr) {
+		return ExitConfig
+	}
+	if code, ok := commandCodes[topLevel(cmd)]; ok {
+		return code
+	}
+	return ExitConfig
+}
+
+// topLevel は rootCmd 直下のコマンド名を返します。
+func topLevel(cmd *cobra.Command) string {
+	for cmd != nil && cmd.HasParent() && cmd.Parent() != rootCmd {
+		cmd = cmd.Parent()
+	}
+	if cmd == nil || cmd == rootCmd {
+		return ""
+	}
+	return cmd.Name()
+}
+
+// result は json_output 時の 1 行 JSON (要件 12 章) です。
+type result struct {
+	Cmd     string            `json:"cmd"`
+	CN      string            `json:"cn,omitempty"`
+	Type    string            `json:"type,omitempty"`
+	Serial  string            `json:"serial,omitempty"`
+	Status  string            `json:"status"`
+	Expires string            `json:"expires,omitempty"`
+	Files   map[string]string `json:"files,omitempty"`
+	Addr    string            `json:"addr,omitempty"`
+	Data    any               `json:"data,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// jsonOutput は json_output が有効かどうかを返します。
+func jsonOutput() bool {
+	return viper.GetBool("json_output")
+}
+
+// success は text モードでは text を、JSON モードでは res を 1 行で標準出力に書きます。
+func success(cmd *cobra.Command, text string, res result) {
+	if !jsonOutput() {
+		fmt.Println(text)
+		return
+	}
+	res.Cmd = commandName(cmd)
+	if res.Status == "" {
+		res.Status = "ok"
+	}
+	writeJSON(os.Stdout, res)
+}
+
+// failure は処理を続ける複数対象のうち 1 件の失敗を標準エラー出力に書きます。
+func failure(cmd *cobra.Command, cn string, err error) {
+	if !jsonOutput() {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", cn, err)
+		return
+	}
+	writeJSON(os.Stderr, result{Cmd: commandName(cmd), CN: cn, Status: "error", Error: err.Error()})
+}
+
+// printError はコマンドの失敗を標準エラー出力に書きます。
+func printError(cmd *cobra.Command, err error, code int) {
+	if !jsonOutput() {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return
+	}
+	var ce *cnError
+	cn := ""
+	if errors.As(err, &ce) {
+		cn = ce.cn
+	}
+	writeJSON(os.Stderr, struct {
+		Cmd    string `json:"cmd,omitempty"`
+		CN     string `json:"cn,omitempty"`
+		Status string `json:"status"`
+		Code   int    `json:"code"`
+		Error  string `json:"error"`
+	}{commandName(cmd), cn, "error", code, err.Error()})
+}
+
+func writeJSON(f *os.File, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return
+	}
+	f.Write(append(b, '\n'))
+}
+
+// commandName は "crl refresh" のように rootCmd を除いたコマンドパスを返します。
+func commandName(cmd *cobra.Command) string {
+	if cmd == nil || cmd == rootCmd {
+		return ""
+	}
+	return strings.TrimPrefix(cmd.CommandPath(), rootCmd.Name()+" ")
+}
+
+// certPaths は CN の出力ファイルのパスです。レイアウトの誤りは処理本体で報告済みのため無視します。
+func certPaths(l issue.Layout, cn string) issue.Paths {
+	p, _ := l.Paths(cn)
+	return p
+}
+
+// certFiles は issue・sign-csr で出力されるファイルの一覧です。
+func certFiles(p issue.Paths, withKey bool) map[string]string {
+	files := map[string]string{
+		"csr":       p.CSR,
+		"cert":      p.Cert,
+		"fullchain": p.Fullchain,
+		"meta":      p.Meta,
+	}
+	if withKey {
+		files["key"] = p.Key
+	}
+	if p.CA != "" {
+		files["ca"] = p.CA
+	}
+	return files
+}
+
+// expires は証明書の有効期限を YYYY-MM-DD で返します。読み込めない場合は空文字です。
+func expires(certPath string) string {
+	cert, err := issue.ReadCert(certPath)
+	if err != nil {
+		return ""
+	}
+	return cert.NotAfter.Format("2006-01-02")
+}
+
+// loadConfig は設定を cfg に読み込みます。失敗は設定エラーです。
+func loadConfig(cfg any) error {
+	return configError(viper.Unmarshal(cfg))
+}
+
+// readProfile はプロファイル YAML を extends と設定の defaults を重ねて prof に読み込みます。
+// 変数は展開しないため、変数を参照するプロファイルはエラーです。失敗は設定エラーです。
+func readProfile(path string, prof any) error {
+	m, err := mergedProfile(path)
+	if err != nil {
+		return err
+	}
+	if m, err = profile.Render(m, nil); err != nil {
+		return configError(err)
+	}
+	return configError(profile.Decode(m, prof))
+}
+
+// configDir は読み込んだ設定ファイルのディレクトリの絶対パスです。設定ファイルが無い場合は空です。
+func configDir() string {
+	f := viper.ConfigFileUsed()
+	if f == "" {
+		return ""
+	}
+	dir, err := filepath.Abs(filepath.Dir(f))
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+// profileRef は meta.json に記録するプロファイルのパスです。作業ディレクトリによらないよう、
+// 設定ファイルのディレクトリからの相対パス (設定ファイルが無い場合は絶対パス) にします。
+func profileRef(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	if dir := configDir(); dir != "" {
+		if rel, err := filepath.Rel(dir, abs); err == nil {
+			return rel
+		}
+	}
+	return abs
+}
+
+// mergedProfile は extends と設定の defaults を重ねたプロファイルです。失敗は設定エラーです。
+// 旧形式の type キーは警告を表示して取り除きます (用途は -t で指定します)。
+func mergedProfile(path string) (map[string]any, error) {
+	m, err := profile.Load(path, viper.GetStringMap("defaults"))
+	if err != nil {
+		return nil, configError(err)
+	}
+	if _, ok := m[profile.LegacyType]; ok {
+		fmt.Fprintf(os.Stderr, "WARN: %s: type is ignored; use -t\n", path)
+		delete(m, profile.LegacyType)
+	}
+	return m, nil
+}
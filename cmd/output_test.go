@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"orecert/internal/ca"
+	"orecert/internal/issue"
+	"orecert/internal/password"
+	"orecert/internal/verify"
+)
+
+func TestExitCode(t *testing.T) {
+	cases := []struct {
+		cmd  string
+		err  error
+		want int
+	}{
+		{"issue", issue.ErrInvalidCN, ExitConfig},
+		{"issue", fmt.Errorf("wrap: %w", issue.ErrExists), ExitExists},
+		{"init-ca", ca.ErrExists, ExitExists},
+		{"bundle", password.ErrPassword, ExitPassword},
+		{"verify", verify.ErrExpired, ExitVerify},
+		{"issue", errors.New("rsa failure"), ExitGenerate},
+		{"revoke", errors.New("sign failure"), ExitVerify},
+		{"issue", configError(os.ErrNotExist), ExitConfig},
+		{"list", errors.New("other"), ExitConfig},
+		{"issue", fmt.Errorf("issuer: %w", issue.ErrUnknownIssuer), ExitConfig},
+	}
+	for _, c := range cases {
+		cmd, _, err := rootCmd.Find([]string{c.cmd})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := exitCode(cmd, c.err); got != c.want {
+			t.Errorf("%s %v: got %d want %d", c.cmd, c.err, got, c.want)
+		}
+	}
+	sub, _, _ := rootCmd.Find([]string{"crl", "refresh"})
+	if topLevel(sub) != "crl" || commandName(sub) != "crl refresh" {
+		t.Fatalf("unexpected names: %q %q", topLevel(sub), commandName(sub))
+	}
+}
+
+func TestExecute_CodesAndJSON(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	cfg := ca.Config{}
+	cfg.CA.Key = filepath.Join(dir, "certs", "ca", "key.pem")
+	cfg.CA.Cert = filepath.Join(dir, "certs", "ca", "cert.pem")
+	if err := ca.InitCA(cfg); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(".orecert.yaml", []byte("json_output: true\n"), 0644)
+	// 旧形式の type は警告を表示して無視します。
+	os.WriteFile("p.yml", []byte("cn: web\ntype: client\n"), 0644)
+	os.WriteFile("bad.yml", []byte("cn: [\n"), 0644)
+
+	rootCmd.SetArgs([]string{"-c", ".orecert.yaml", "issue", "p.yml", "-t", "server"})
+	stdout, stderr, code := capture(t, execute)
+	if code != ExitOK || !bytes.Contains(stderr, []byte("WARN: p.yml: type is ignored")) {
+		t.Fatalf("issue exit %d: %s", code, stderr)
+	}
+	if bytes.Count(stdout, []byte("\n")) != 1 {
+		t.Fatalf("not one-line json: %q", stdout)
+	}
+	// 要件 12 章のスキーマ (成功)
+	var res map[string]any
+	if err := json.Unmarshal(stdout, &res); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := res["files"].(map[string]any)
+	if res["cmd"] != "issue" || res["cn"] != "web" || res["type"] != "server" || res["status"] != "ok" || files["cert"] != filepath.Join("certs", "web", "cert.pem") {
+		t.Fatalf("unexpected result: %s", stdout)
+	}
+
+	rootCmd.SetArgs([]string{"-c", ".orecert.yaml", "issue", "p.yml"})
+	_, stderr, code = capture(t, execute)
+	if code != ExitExists {
+		t.Fatalf("expected exit %d, got %d", ExitExists, code)
+	}
+	// 要件 12 章のスキーマ (失敗)。警告の行の後の最後の行です。
+	stderr = bytes.TrimSpace(stderr)
+	stderr = stderr[bytes.LastIndexByte(stderr, '\n')+1:]
+	var e map[string]any
+	if err := json.Unmarshal(stderr, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e["cmd"] != "issue" || e["cn"] != "web" || e["status"] != "error" || e["code"] != float64(ExitExists) || e["error"] != issue.ErrExists.Error() {
+		t.Fatalf("unexpected error json: %s", stderr)
+	}
+
+	rootCmd.SetArgs([]string{"-c", ".orecert.yaml", "issue", "bad.yml"})
+	if _, _, code := capture(t, execute); code != ExitConfig {
+		t.Fatalf("expected exit %d, got %d", ExitConfig, code)
+	}
+	rootCmd.SetArgs([]string{"-c", "missing.yaml", "version"})
+	if _, _, code := capture(t, execute); code != ExitConfig {
+		t.Fatalf("expected exit %d for missing config, got %d", ExitConfig, code)
+	}
+}
+
+// capture は fn 実行中の標準出力・標準エラー出力を取得します。
+func capture(t *testing.T, fn func() int) ([]byte, []byte, int) {
+	t.Helper()
+	oldOut, oldErr := os.Stdout, os.Stderr
+	outR, outW, _ := os.Pipe()
+	errR, errW, _ := os.Pipe()
+	os.Stdout, os.Stderr = outW, errW
+	code := fn()
+	os.Stdout, os.Stderr = oldOut, oldErr
+	outW.Close()
+	errW.Close()
+	out, _ := io.ReadAll(outR)
+	errOut, _ := io.ReadAll(errR)
+	return out, errOut, code
+}
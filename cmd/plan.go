@@ -0,0 +1,152 @@
+/*
+Copyright © 2025 ramsesyok
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"orecert/internal/issue"
+	"orecert/internal/plan"
+)
+
+// planCmd represents the plan command
+var planCmd = &cobra.Command{
+	Use:   "plan [dir|glob]...",
+	Short: "プロファイルと発行済み証明書の差分を表示",
+	Long: `プロファイル (既定は profiles/) をあるべき状態として発行済み証明書と比較し、
+未発行 (+)、SAN・アルゴリズム・種別・有効日数の差分や期限切れが近いことによる再発行 (~)、
+指定した範囲のプロファイルから発行され、そのプロファイルが無くなった証明書の失効 (-) を表示します。
+--prune では範囲のプロファイルから発行されていない証明書も失効の対象にします
+(sign-csr・ACME で発行した外部鍵の証明書は対象外)。変更は行いません。
+読めないプロファイルはエラーとして表示し、残りのプロファイルを比較します。`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, changes, failed, err := planChanges(cmd, args)
+		if err != nil {
+			return err
+		}
+		for _, c := range changes {
+			success(cmd, changeLine(c), result{CN: c.CN, Status: c.Action, Data: c})
+		}
+		if !jsonOutput() {
+			fmt.Println(planSummary(changes))
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d profiles failed to load", failed)
+		}
+		return nil
+	},
+}
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply [dir|glob]...",
+	Short: "プロファイルに合わせて発行・再発行・失効",
+	Long: `plan と同じ比較を行い、未発行の証明書を発行、差分のある証明書をプロファイルから再発行
+(期限切れが近いだけの場合は鍵を再利用して更新)、孤立した証明書を失効します。
+失敗した操作があっても残りは続けます。`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, changes, bad, err := planChanges(cmd, args)
+		if err != nil {
+			return err
+		}
+		var failed int
+		for _, c := range changes {
+			if err := plan.Apply(cfg, c); err != nil {
+				failed++
+				failure(cmd, c.CN, err)
+				continue
+			}
+			res := result{CN: c.CN, Status: c.Action}
+			if c.Action != plan.ActionRevoke {
+				paths := certPaths(cfg.Layout, c.CN)
+				res.Expires = expires(paths.Cert)
+				res.Files = map[string]string{"cert": paths.Cert}
+			}
+			success(cmd, "✅ "+changeLine(c), res)
+		}
+		if !jsonOutput() {
+			fmt.Printf("%d applied, %d failed\n", len(changes)-failed, failed+bad)
+		}
+		if failed+bad > 0 {
+			return fmt.Errorf("%d of %d changes failed", failed+bad, len(changes)+bad)
+		}
+		return nil
+	},
+}
+
+// planChanges は設定とプロファイルを読み込んで差分を求めます。
+// 読めないプロファイルはエラーの行として出力して残りを比較し、その件数を返します。
+// 読めないプロファイルから発行された証明書は孤立とみなしません。
+func planChanges(cmd *cobra.Command, args []string) (plan.Config, []plan.Change, int, error) {
+	var cfg plan.Config
+	if err := loadConfig(&cfg); err != nil {
+		return cfg, nil, 0, err
+	}
+	if len(args) == 0 {
+		args = []string{"profiles"}
+	}
+	files, err := profileFiles(args)
+	if err != nil {
+		return cfg, nil, 0, configError(err)
+	}
+	var jobs []issue.Job
+	var skip []string
+	for _, f := range files {
+		var prof issue.Profile
+		if err := readProfile(f, &prof); err != nil {
+			failure(cmd, f, err)
+			skip = append(skip, profileRef(f))
+			continue
+		}
+		prof.Source = profileRef(f)
+		jobs = append(jobs, issue.Job{Name: f, Profile: prof})
+	}
+	opt := plan.Options{Scope: args, Base: configDir(), Skip: skip}
+	opt.Type, _ = cmd.Flags().GetString("type")
+	opt.Prune, _ = cmd.Flags().GetBool("prune")
+	if s, _ := cmd.Flags().GetString("expiring"); s != "" {
+		d, err := parseSpan(s)
+		if err != nil {
+			return cfg, nil, 0, configError(err)
+		}
+		opt.Expiring = d
+	}
+	changes, err := plan.Plan(cfg, jobs, opt)
+	return cfg, changes, len(skip), err
+}
+
+// changeLine は "~ api (profiles/api.yaml): san [...] -> [...]" 形式の 1 行です。
+func changeLine(c plan.Change) string {
+	mark := map[string]string{plan.ActionCreate: "+", plan.ActionReissue: "~", plan.ActionRevoke: "-"}[c.Action]
+	name := c.CN
+	if c.Profile != "" {
+		name += " (" + c.Profile + ")"
+	}
+	return fmt.Sprintf("%s %s: %s", mark, name, strings.Join(c.Reasons, "; "))
+}
+
+// planSummary は操作の種類ごとの件数です。
+func planSummary(changes []plan.Change) string {
+	n := map[string]int{}
+	for _, c := range changes {
+		n[c.Action]++
+	}
+	if len(changes) == 0 {
+		return "No changes. Certificates match the profiles."
+	}
+	return fmt.Sprintf("Plan: %d to create, %d to reissue, %d to revoke.", n[plan.ActionCreate], n[plan.ActionReissue], n[plan.ActionRevoke])
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+	rootCmd.AddCommand(applyCmd)
+	for _, c := range []*cobra.Command{planCmd, applyCmd} {
+		c.Flags().String("expiring", "30d", "reissue certificates expiring within this period")
+		c.Flags().StringP("type", "t", "", "issue type (default the issued type, or server for new certificates)")
+		c.Flags().Bool("prune", false, "also revoke certificates not issued from these profiles (except external keys)")
+	}
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"orecert/internal/ca"
+	"orecert/internal/issue"
+)
+
+// TestPlan_OtherWorkingDir は作業ディレクトリやプロファイルの指定方法が変わっても、
+// 発行済み証明書を範囲外や孤立と誤判定しないことを確認します。
+func TestPlan_OtherWorkingDir(t *testing.T) {
+	dir := t.TempDir()
+	certs := filepath.Join(dir, "certs")
+	cfg := ca.Config{}
+	cfg.CA.Key = filepath.Join(certs, "ca", "key.pem")
+	cfg.CA.Cert = filepath.Join(certs, "ca", "cert.pem")
+	if err := ca.InitCA(cfg); err != nil {
+		t.Fatal(err)
+	}
+	conf := filepath.Join(dir, ".orecert.yaml")
+	os.WriteFile(conf, []byte("json_output: true\ncerts_dir: "+certs+"\n"), 0644)
+	os.Mkdir(filepath.Join(dir, "profiles"), 0755)
+	os.WriteFile(filepath.Join(dir, "profiles", "web.yaml"), []byte("cn: web\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "profiles", "api.yaml"), []byte("cn: api\n"), 0644)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetArgs([]string{"-c", conf, "apply", "profiles/"})
+	if _, stderr, code := capture(t, execute); code != ExitOK {
+		t.Fatalf("apply exit %d: %s", code, stderr)
+	}
+	meta, err := issue.ReadMeta(filepath.Join(certs, "web", "meta.json"))
+	if err != nil || meta.Profile != filepath.Join("profiles", "web.yaml") {
+		t.Fatalf("meta profile: %q %v", meta.Profile, err)
+	}
+
+	// plan は wd で plan を実行し、変更の行とエラー出力、終了コードを返します。
+	plan := func(wd string, args ...string) ([]result, []byte, int) {
+		t.Helper()
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+		rootCmd.SetArgs(append([]string{"-c", conf, "plan"}, args...))
+		stdout, stderr, code := capture(t, execute)
+		var out []result
+		for _, line := range bytes.Split(bytes.TrimSpace(stdout), []byte("\n")) {
+			if len(line) == 0 {
+				continue
+			}
+			var r result
+			if err := json.Unmarshal(line, &r); err != nil {
+				t.Fatalf("plan output %q: %v", line, err)
+			}
+			out = append(out, r)
+		}
+		return out, stderr, code
+	}
+	other := t.TempDir()
+	for _, c := range []struct {
+		wd   string
+		args []string
+	}{
+		{dir, []string{"./profiles"}},
+		{dir, []string{"profiles/*.yaml"}},
+		{other, []string{filepath.Join(dir, "profiles")}},
+	} {
+		if got, stderr, code := plan(c.wd, c.args...); code != ExitOK || len(got) != 0 {
+			t.Errorf("%s %v: exit %d %+v %s", c.wd, c.args, code, got, stderr)
+		}
+	}
+
+	// 読めないプロファイルはエラーの行にして残りを比較し、そこから発行した証明書は孤立としません。
+	web := filepath.Join(dir, "profiles", "web.yaml")
+	os.WriteFile(web, []byte("cn: \"{{.name}}\"\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "profiles", "db.yaml"), []byte("cn: db\n"), 0644)
+	got, stderr, code := plan(other, filepath.Join(dir, "profiles"))
+	if code != ExitConfig || !bytes.Contains(stderr, []byte(`"cn":"`+web+`"`)) {
+		t.Fatalf("profile error: exit %d %s", code, stderr)
+	}
+	if len(got) != 1 || got[0].CN != "db" || got[0].Status != "create" {
+		t.Fatalf("with a broken profile: %+v", got)
+	}
+
+	os.Remove(web)
+	got, _, _ = plan(other, filepath.Join(dir, "profiles"))
+	if len(got) != 2 || got[1].CN != "web" || got[1].Status != "revoke" {
+		t.Fatalf("orphan from another directory: %+v", got)
+	}
+}
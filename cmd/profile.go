@@ -0,0 +1,66 @@
+/*
+Copyright © 2025 ramsesyok
+*/
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"orecert/internal/issue"
+	"orecert/internal/profile"
+)
+
+// profileCmd represents the profile command group
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "プロファイルの確認",
+}
+
+var profileRenderCmd = &cobra.Command{
+	Use:   "render <profile>",
+	Short: "extends と defaults を重ねたプロファイルを表示",
+	Long: `extends の継承元と設定の defaults を重ね、--set / --values の変数を展開したプロファイルを表示します。
+--values に複数の行がある場合は行ごとに "---" で区切って表示します。`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rows, err := valueRows(cmd)
+		if err != nil {
+			return err
+		}
+		m, err := mergedProfile(args[0])
+		if err != nil {
+			return err
+		}
+		for i, row := range rows {
+			r, err := profile.Render(m, row)
+			if err != nil {
+				return configError(err)
+			}
+			// issue と同じ型で読めることを確かめます。
+			var prof issue.Profile
+			if err := profile.Decode(r, &prof); err != nil {
+				return configError(err)
+			}
+			var out strings.Builder
+			if i > 0 {
+				out.WriteString("---\n")
+			}
+			enc := yaml.NewEncoder(&out)
+			enc.SetIndent(2)
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+			success(cmd, strings.TrimSuffix(out.String(), "\n"), result{CN: prof.CN, Files: map[string]string{"profile": args[0]}, Data: r})
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileRenderCmd)
+	addValueFlags(profileRenderCmd)
+}
@@ -0,0 +1,122 @@
+/*
+Copyright © 2025 ramsesyok
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"orecert/internal/issue"
+)
+
+// renewCmd represents the renew command
+var renewCmd = &cobra.Command{
+	Use:   "renew [profile|CN]",
+	Short: "meta.json をもとに証明書を再発行",
+	Long: `certs/<CN>/meta.json に記録された SAN・種別・アルゴリズム・署名 CA で証明書を再発行します。
+既定では既存の鍵を再利用し、--rotate-key で新しい鍵を生成します。
+以前の証明書一式は certs/<CN>/archive/<旧シリアル>/ に保存されます。
+--all では certs/ 配下のすべての証明書が対象です。
+引数は拡張子が .yaml/.yml のファイルであればプロファイル、それ以外は CN とみなします。`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		all, _ := cmd.Flags().GetBool("all")
+		if all == (len(args) == 1) || len(args) > 1 {
+			return configError(fmt.Errorf("profile, CN or --all required"))
+		}
+		var cfg issue.Config
+		if err := loadConfig(&cfg); err != nil {
+			return err
+		}
+		var opt issue.RenewOptions
+		opt.RotateKey, _ = cmd.Flags().GetBool("rotate-key")
+		if s, _ := cmd.Flags().GetString("if-expiring-within"); s != "" {
+			d, err := parseSpan(s)
+			if err != nil {
+				return configError(err)
+			}
+			opt.Within = d
+		}
+
+		var targets []string
+		if all {
+			list, err := issue.Issued(cfg)
+			if err != nil {
+				return err
+			}
+			targets = list
+		} else {
+			cn, pass, err := profileCN(args[0])
+			if err != nil {
+				return err
+			}
+			opt.KeyPass = pass
+			targets = []string{cn}
+		}
+
+		var failed int
+		for _, cn := range targets {
+			renewed, err := issue.Renew(cfg, cn, opt)
+			switch {
+			case err != nil:
+				failed++
+				failure(cmd, cn, err)
+			case renewed:
+				paths := certPaths(cfg.Layout, cn)
+				meta, _ := issue.ReadMeta(paths.Meta)
+				success(cmd, "✅ "+cn, result{CN: cn, Type: meta.Type, Expires: expires(paths.Cert), Files: map[string]string{"cert": paths.Cert}})
+			default:
+				success(cmd, "⏭️  "+cn+" (not expiring)", result{CN: cn, Status: "skipped"})
+			}
+		}
+		if failed > 0 {
+			err := fmt.Errorf("%d of %d renewals failed", failed, len(targets))
+			if len(targets) == 1 {
+				return withCN(targets[0], err)
+			}
+			return err
+		}
+		return nil
+	},
+}
+
+// profileCN は引数がプロファイル YAML であれば CN と key_pass を、それ以外は引数を CN として返します。
+// プロファイルとみなすのは拡張子が .yaml/.yml の通常ファイルだけです。
+func profileCN(arg string) (string, string, error) {
+	ext := filepath.Ext(arg)
+	if fi, err := os.Stat(arg); err != nil || !fi.Mode().IsRegular() || (ext != ".yaml" && ext != ".yml") {
+		return arg, "", nil
+	}
+	var prof issue.Profile
+	if err := readProfile(arg, &prof); err != nil {
+		return "", "", err
+	}
+	return prof.CN, prof.KeyPass, nil
+}
+
+// parseSpan は 30d / 12h / 90m 形式の期間を解析します。単位の無い数値は日数です。
+func parseSpan(s string) (time.Duration, error) {
+	if n, ok := strings.CutSuffix(s, "d"); ok {
+		s = n
+	} else if _, err := strconv.Atoi(s); err != nil {
+		return time.ParseDuration(s)
+	}
+	days, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+func init() {
+	rootCmd.AddCommand(renewCmd)
+	renewCmd.Flags().Bool("all", false, "renew every certificate under certs/")
+	renewCmd.Flags().Bool("rotate-key", false, "generate a new key instead of reusing the current one")
+	renewCmd.Flags().String("if-expiring-within", "", "renew only if the certificate expires within this period (e.g. 30d)")
+}
@@ -5,13 +5,11 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-	"gopkg.in/yaml.v3"
 
+	"orecert/internal/issue"
 	"orecert/internal/revoke"
 )
 
@@ -19,30 +17,76 @@ import (
 var revokeCmd = &cobra.Command{
 	Use:   "revoke [profile]",
 	Short: "証明書失効 & CRL 更新",
+	Long: `プロファイルの CN、--serial で指定したシリアル (台帳に記録済みのもの)、
+または --cert で指定した証明書ファイルを失効させ CRL を更新します。
+プロファイル・--serial・--cert はいずれか 1 つだけ指定します。`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) == 0 {
-			return fmt.Errorf("profile required")
+		serial, _ := cmd.Flags().GetString("serial")
+		certFile, _ := cmd.Flags().GetString("cert")
+		reason, _ := cmd.Flags().GetString("reason")
+		invalidity, _ := cmd.Flags().GetString("invalidity-date")
+		if len(args) == 0 && serial == "" && certFile == "" {
+			return configError(fmt.Errorf("profile required"))
 		}
-		data, err := os.ReadFile(args[0])
-		if err != nil {
-			return err
+		if len(args) > 0 && (serial != "" || certFile != "") {
+			return configError(fmt.Errorf("profile cannot be combined with --serial or --cert"))
 		}
-		var prof revoke.Profile
-		if err := yaml.Unmarshal(data, &prof); err != nil {
-			return err
+		opt := revoke.Options{Reason: reason}
+		if invalidity != "" {
+			t, err := parseDate(invalidity)
+			if err != nil {
+				return configError(err)
+			}
+			opt.InvalidityDate = t
 		}
 		var cfg revoke.Config
-		if err := viper.Unmarshal(&cfg); err != nil {
+		if err := loadConfig(&cfg); err != nil {
 			return err
 		}
-		if err := revoke.Revoke(cfg, prof); err != nil {
-			return err
+		switch {
+		case serial != "":
+			cn, err := revoke.RevokeSerial(cfg, serial, opt)
+			if err != nil {
+				return withCN(cn, err)
+			}
+			success(cmd, "✅ "+serial, result{CN: cn, Serial: serial})
+		case certFile != "":
+			cert, err := issue.ReadCert(certFile)
+			if err != nil {
+				return err
+			}
+			if err := revoke.RevokeCert(cfg, cert, opt); err != nil {
+				return withCN(cert.Subject.CommonName, err)
+			}
+			success(cmd, "✅ "+certFile, result{CN: cert.Subject.CommonName, Files: map[string]string{"cert": certFile}})
+		default:
+			var prof revoke.Profile
+			if err := readProfile(args[0], &prof); err != nil {
+				return err
+			}
+			if err := revoke.RevokeWith(cfg, prof, opt); err != nil {
+				return withCN(prof.CN, err)
+			}
+			cert := certPaths(cfg.Layout, prof.CN).Cert
+			success(cmd, "✅ "+cert, result{CN: prof.CN, Files: map[string]string{"cert": cert}})
 		}
-		fmt.Println("✅", filepath.Join("certs", prof.CN, "cert.pem"))
 		return nil
 	},
 }
 
+// parseDate は RFC3339 または YYYY-MM-DD 形式の日時を解析します。
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
 func init() {
 	rootCmd.AddCommand(revokeCmd)
+	revokeCmd.Flags().String("serial", "", "revoke by serial number (hex) recorded in the database")
+	revokeCmd.Flags().String("cert", "", "revoke the given certificate file")
+	revokeCmd.Flags().String("reason", "", "RFC 5280 reason (keyCompromise, superseded, cessationOfOperation, ...)")
+	revokeCmd.Flags().String("invalidity-date", "", "date the key is known to be compromised (RFC3339 or YYYY-MM-DD)")
+	revokeCmd.MarkFlagsMutuallyExclusive("serial", "cert")
 }
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"orecert/internal/ca"
+	"orecert/internal/db"
+	"orecert/internal/issue"
+)
+
+// TestRevokeCommand_Serial はシリアル指定の失効で台帳の CN を出力し、
+// プロファイルとの同時指定を拒否することを確認します。
+func TestRevokeCommand_Serial(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	cfg := ca.Config{}
+	cfg.CA.Key = filepath.Join(dir, "certs", "ca", "key.pem")
+	cfg.CA.Cert = filepath.Join(dir, "certs", "ca", "cert.pem")
+	if err := ca.InitCA(cfg); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(".orecert.yaml", []byte("json_output: true\n"), 0644)
+	os.WriteFile("s.yml", []byte("cn: s\n"), 0644)
+	rootCmd.SetArgs([]string{"-c", ".orecert.yaml", "issue", "s.yml"})
+	if _, stderr, code := capture(t, execute); code != ExitOK {
+		t.Fatalf("issue exit %d: %s", code, stderr)
+	}
+	cert, err := issue.ReadCert(filepath.Join("certs", "s", "cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial := db.SerialHex(cert.SerialNumber)
+	// rootCmd はフラグの値を保持するため、後続のテストのために戻します。
+	t.Cleanup(func() { revokeCmd.Flags().Set("serial", "") })
+
+	rootCmd.SetArgs([]string{"-c", ".orecert.yaml", "revoke", "s.yml", "--serial", serial})
+	if _, _, code := capture(t, execute); code != ExitConfig {
+		t.Fatalf("profile with --serial: exit %d", code)
+	}
+	rootCmd.SetArgs([]string{"-c", ".orecert.yaml", "revoke", "--serial", serial})
+	stdout, stderr, code := capture(t, execute)
+	if code != ExitOK {
+		t.Fatalf("revoke exit %d: %s", code, stderr)
+	}
+	var res map[string]any
+	if err := json.Unmarshal(bytes.TrimSpace(stdout), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res["cn"] != "s" || res["serial"] != serial {
+		t.Fatalf("unexpected result: %s", stdout)
+	}
+}
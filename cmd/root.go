@@ -16,6 +16,7 @@ limitations under the License.
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -26,24 +27,52 @@ import (
 
 var cfgFile string
 
+// configErr は initConfig での設定ファイル読み込みエラーです。
+var configErr error
+
 var rootCmd = &cobra.Command{
 	Use:   "orecert",
 	Short: "自己署名証明書管理ツール",
 	Long: `orecert はローカル開発向けに自己署名証明書を生成・管理する CLI ツールです。
 YAML で定義したプロファイルをもとに鍵や証明書を作成し、検証・失効・梱包などを行えます。`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return configError(configErr)
+	},
 }
 
-// Execute は rootCmd を実行します。
+// Execute は rootCmd を実行し、失敗時は要件 8 章の終了コードで終了します。
 func Execute() {
-	err := rootCmd.Execute()
-	if err != nil {
-		os.Exit(1)
+	if code := execute(); code != ExitOK {
+		os.Exit(code)
+	}
+}
+
+// execute は rootCmd を実行して終了コードを返します。panic は ExitInternal として復旧します。
+func execute() (code int) {
+	var cmd *cobra.Command
+	defer func() {
+		if r := recover(); r != nil {
+			code = ExitInternal
+			printError(cmd, fmt.Errorf("internal error: %v", r), code)
+		}
+	}()
+	cmd, err := rootCmd.ExecuteC()
+	if err == nil {
+		return ExitOK
 	}
+	code = exitCode(cmd, err)
+	printError(cmd, err, code)
+	return code
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
 	cobra.MousetrapHelpText = ""
+	// エラーは execute が text / JSON に応じて出力します。
+	rootCmd.SilenceErrors = true
+	rootCmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return configError(err)
+	})
 
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "config file (default is $HOME/.orecert.yaml)")
 
@@ -69,7 +98,19 @@ func initConfig() {
 	viper.AutomaticEnv() // 環境変数も読み込みます。
 
 	// 設定ファイルが見つかった場合は読み込みます。
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	configErr = nil
+	err := viper.ReadInConfig()
+	var notFound viper.ConfigFileNotFoundError
+	if err != nil && (cfgFile != "" || !errors.As(err, &notFound)) {
+		configErr = err
+	}
+	if err == nil {
+		if !jsonOutput() {
+			fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+		}
+	}
+	if jsonOutput() {
+		// JSON モードでは標準エラー出力を 1 行 JSON のみにします。
+		rootCmd.SilenceUsage = true
 	}
 }
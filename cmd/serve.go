@@ -0,0 +1,116 @@
+/*
+Copyright © 2025 ramsesyok
+*/
+package cmd
+
+import (
+	"net/http"
+
+	"github.com/spf13/cobra"
+
+	"orecert/internal/acme"
+	"orecert/internal/ocsp"
+	"orecert/internal/pki"
+)
+
+// serveCmd represents the serve command group
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "CA 関連の HTTP サーバを起動",
+}
+
+var serveOCSPCmd = &cobra.Command{
+	Use:   "ocsp",
+	Short: "OCSP レスポンダ (RFC 6960) を起動",
+	Long: `revoke が管理する CRL と証明書台帳をもとに、ルート CA と全中間 CA が発行した
+証明書の OCSP 要求に応答します。--signer delegated では init-ocsp で発行した
+委任証明書で署名します。`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var cfg ocsp.Config
+		if err := loadConfig(&cfg); err != nil {
+			return err
+		}
+		if f := cmd.Flags().Lookup("listen"); f.Changed {
+			cfg.OCSP.Listen = f.Value.String()
+		}
+		if f := cmd.Flags().Lookup("signer"); f.Changed {
+			cfg.OCSP.Signer = f.Value.String()
+		}
+		r, err := ocsp.New(cfg)
+		if err != nil {
+			return err
+		}
+		addr := cfg.OCSP.Listen
+		if addr == "" {
+			addr = ":8888"
+		}
+		success(cmd, "OCSP responder listening on "+addr, result{Status: "listening", Addr: addr})
+		return http.ListenAndServe(addr, r)
+	},
+}
+
+var servePKICmd = &cobra.Command{
+	Use:   "pki",
+	Short: "CA 証明書と CRL を HTTP で公開",
+	Long: `ルート CA と全中間 CA の証明書 (DER/PEM) と CRL (DER) を公開します。
+公開パスは pki.base_url から証明書に埋め込まれる CRL 配布点・caIssuers の URL と一致します。
+
+  /ca.crt  /ca.pem  /ca.crl
+  /intermediates/<name>.crt  /intermediates/<name>.pem  /intermediates/<name>.crl`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var cfg pki.Config
+		if err := loadConfig(&cfg); err != nil {
+			return err
+		}
+		if f := cmd.Flags().Lookup("listen"); f.Changed {
+			cfg.PKI.Listen = f.Value.String()
+		}
+		s := pki.New(cfg)
+		success(cmd, "PKI server listening on "+s.Listen(), result{Status: "listening", Addr: s.Listen()})
+		return http.ListenAndServe(s.Listen(), s)
+	},
+}
+
+var serveACMECmd = &cobra.Command{
+	Use:   "acme",
+	Short: "ACME (RFC 8555) サーバを起動",
+	Long: `orecert の CA で証明書を発行する ACME サーバを起動します。ディレクトリは /directory です。
+認可は http-01 で検証します。--trust-all ではオフラインの開発ネットワーク向けに検証を省略します。
+発行した証明書は issue と同様に certs/<CN>/ と証明書台帳に記録されます。`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var cfg acme.Config
+		if err := loadConfig(&cfg); err != nil {
+			return err
+		}
+		if f := cmd.Flags().Lookup("listen"); f.Changed {
+			cfg.ACME.Listen = f.Value.String()
+		}
+		if trust, _ := cmd.Flags().GetBool("trust-all"); trust {
+			cfg.ACME.TrustAll = true
+		}
+		if issuer, _ := cmd.Flags().GetString("issuer"); issuer != "" {
+			cfg.Issuer = issuer
+		}
+		if typ, _ := cmd.Flags().GetString("type"); typ != "" {
+			cfg.ACME.Type = typ
+		}
+		s, err := acme.New(cfg)
+		if err != nil {
+			return err
+		}
+		success(cmd, "ACME server listening on "+s.Listen(), result{Status: "listening", Addr: s.Listen()})
+		return s.ListenAndServe()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.AddCommand(serveOCSPCmd, servePKICmd, serveACMECmd)
+	serveACMECmd.Flags().String("listen", ":14000", "listen address (default acme.listen)")
+	serveACMECmd.Flags().Bool("trust-all", false, "accept every authorization without validation")
+	serveACMECmd.Flags().String("issuer", "", "signing intermediate CA name (default root CA)")
+	serveACMECmd.Flags().StringP("type", "t", "", "issue type (default acme.type or server)")
+	servePKICmd.Flags().String("listen", ":8080", "listen address (default pki.listen)")
+	serveOCSPCmd.Flags().String("listen", ":8888", "listen address (default ocsp.listen)")
+	serveOCSPCmd.Flags().String("signer", "ca", "response signer (ca|delegated)")
+}
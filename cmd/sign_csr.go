@@ -0,0 +1,80 @@
+/*
+Copyright © 2025 ramsesyok
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"orecert/internal/issue"
+)
+
+// signCsrCmd represents the sign-csr command
+var signCsrCmd = &cobra.Command{
+	Use:   "sign-csr [csr.pem]",
+	Short: "外部 CSR への署名",
+	Long: `外部で生成された CSR の署名を検証し、プロファイルの有効日数・用途・SAN 規則を適用して
+CA 署名した証明書を certs/<CN>/ に保存します。秘密鍵は保存しません。
+用途は issue と同じく -t で指定し、プロファイルの type は無視します。
+CSR の SAN をそのまま署名するのは --profile か --san で規則を指定した場合と、--allow-csr-san を
+指定した場合だけです。`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return configError(fmt.Errorf("csr required"))
+		}
+		typ, _ := cmd.Flags().GetString("type")
+		profilePath, _ := cmd.Flags().GetString("profile")
+		sanMode, _ := cmd.Flags().GetString("san-mode")
+		sans, _ := cmd.Flags().GetStringArray("san")
+		allowCSRSAN, _ := cmd.Flags().GetBool("allow-csr-san")
+		var cfg issue.Config
+		if err := loadConfig(&cfg); err != nil {
+			return err
+		}
+		if issuer, _ := cmd.Flags().GetString("issuer"); issuer != "" {
+			cfg.Issuer = issuer
+		}
+		var prof issue.Profile
+		if profilePath != "" {
+			if err := readProfile(profilePath, &prof); err != nil {
+				return err
+			}
+		}
+		prof.SAN = append(prof.SAN, sans...)
+		csr, err := issue.ReadCSR(args[0])
+		if err != nil {
+			return err
+		}
+		// 規則の無いまま CSR の SAN (URI・メールを含む) をすべて署名しないようにします。
+		if profilePath == "" && len(sans) == 0 && !allowCSRSAN && len(issue.FormatSAN(csr.DNSNames, csr.IPAddresses, csr.URIs, csr.EmailAddresses)) > 0 {
+			return configError(errCSRSAN)
+		}
+		cn := prof.CN
+		if cn == "" {
+			cn = csr.Subject.CommonName
+		}
+		if err := issue.SignCSR(cfg, prof, typ, csr, sanMode); err != nil {
+			return withCN(cn, err)
+		}
+		paths := certPaths(cfg.Layout, cn)
+		exp := expires(paths.Cert)
+		success(cmd, fmt.Sprintf("✅ %s (Expires: %s)", paths.Cert, exp), result{CN: cn, Type: typ, Expires: exp, Files: certFiles(paths, false)})
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(signCsrCmd)
+	signCsrCmd.Flags().StringP("type", "t", "server", "issue type (server|client|both|codesign|smime|timestamp|ocsp)")
+	signCsrCmd.Flags().StringP("profile", "p", "", "profile applied to the csr")
+	signCsrCmd.Flags().String("san-mode", issue.SANIntersect, "san rule when profile has san (intersect|override)")
+	signCsrCmd.Flags().String("issuer", "", "signing intermediate CA name (default root CA)")
+	signCsrCmd.Flags().StringArray("san", nil, "allowed san such as DNS:example.local (repeatable, added to the profile's san)")
+	signCsrCmd.Flags().Bool("allow-csr-san", false, "sign the csr's sans as requested when no profile or --san is given")
+}
+
+// errCSRSAN は規則の指定なしに CSR の SAN を署名しようとした場合のエラーです。
+var errCSRSAN = errors.New("csr has sans: give --profile, --san or --allow-csr-san")
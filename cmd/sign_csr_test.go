@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"orecert/internal/ca"
+	"orecert/internal/issue"
+)
+
+// TestSignCSR_SANRules は規則の指定なしに CSR の SAN を署名しないことを確認します。
+func TestSignCSR_SANRules(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	cfg := ca.Config{}
+	cfg.CA.Key = filepath.Join(dir, "certs", "ca", "key.pem")
+	cfg.CA.Cert = filepath.Join(dir, "certs", "ca", "cert.pem")
+	if err := ca.InitCA(cfg); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(".orecert.yaml", []byte("{}"), 0644)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	u, _ := url.Parse("spiffe://example/ext")
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "ext"},
+		DNSNames: []string{"ext.test", "evil.test"},
+		URIs:     []*url.URL{u},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile("ext.csr", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), 0644)
+
+	rootCmd.SetArgs([]string{"-c", ".orecert.yaml", "sign-csr", "ext.csr"})
+	if _, stderr, code := capture(t, execute); code != ExitConfig {
+		t.Fatalf("without rules: exit %d %s", code, stderr)
+	}
+	rootCmd.SetArgs([]string{"-c", ".orecert.yaml", "sign-csr", "ext.csr", "--san", "DNS:ext.test"})
+	if _, stderr, code := capture(t, execute); code != ExitOK {
+		t.Fatalf("with --san: exit %d %s", code, stderr)
+	}
+	cert, err := issue.ReadCert(filepath.Join("certs", "ext", "cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(cert.DNSNames, []string{"ext.test"}) || len(cert.URIs) != 0 {
+		t.Fatalf("san not restricted: %v %v", cert.DNSNames, cert.URIs)
+	}
+}
@@ -5,12 +5,8 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-	"gopkg.in/yaml.v3"
 
 	"orecert/internal/verify"
 )
@@ -21,24 +17,22 @@ var verifyCmd = &cobra.Command{
 	Short: "証明書 & チェーン検証",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
-			return fmt.Errorf("profile required")
-		}
-		data, err := os.ReadFile(args[0])
-		if err != nil {
-			return err
+			return configError(fmt.Errorf("profile required"))
 		}
 		var prof verify.Profile
-		if err := yaml.Unmarshal(data, &prof); err != nil {
+		if err := readProfile(args[0], &prof); err != nil {
 			return err
 		}
 		var cfg verify.Config
-		if err := viper.Unmarshal(&cfg); err != nil {
+		if err := loadConfig(&cfg); err != nil {
 			return err
 		}
 		if err := verify.Verify(cfg, prof); err != nil {
-			return err
+			return withCN(prof.CN, err)
 		}
-		fmt.Println("✅", filepath.Join("certs", prof.CN, "cert.pem"))
+		cert := certPaths(cfg.Layout, prof.CN).Cert
+		exp := expires(cert)
+		success(cmd, fmt.Sprintf("✅ %s (Expires: %s)", cert, exp), result{CN: prof.CN, Expires: exp, Files: map[string]string{"cert": cert}})
 		return nil
 	},
 }
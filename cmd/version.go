@@ -14,6 +14,10 @@ var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "バージョン表示",
 	Run: func(cmd *cobra.Command, args []string) {
+		if jsonOutput() {
+			success(cmd, "", result{Data: map[string]string{"version": Version}})
+			return
+		}
 		cmd.Println(Version)
 	},
 }
@@ -0,0 +1,878 @@
+// Package acme は orecert の CA を使う RFC 8555 の ACME サーバです。
+// ディレクトリ・アカウント・注文・認可・finalize のフローと http-01 検証を実装し、
+// 証明書は issue.SignCSR (issue.Issue と同じ署名処理) で発行します。
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"orecert/internal/issue"
+)
+
+// Config は acme 用設定です。発行には issue の設定をそのまま使います。
+type Config struct {
+	issue.Config `mapstructure:",squash"`
+	ACME         Settings `mapstructure:"acme"`
+}
+
+// Settings は .orecert.yaml の acme セクションです。
+type Settings struct {
+	// Listen は serve acme の待ち受けアドレスです。
+	Listen string `mapstructure:"listen"`
+	// BaseURL はディレクトリなどの URL の基点です。空の場合は要求の Host から組み立てます。
+	BaseURL string `mapstructure:"base_url"`
+	// TrustAll は認可を検証せずに有効とします。オフラインの開発ネットワーク向けです。
+	TrustAll bool `mapstructure:"trust_all"`
+	// HTTP01Port は http-01 検証で接続するポートです。
+	HTTP01Port int `mapstructure:"http01_port"`
+	// Type は発行する証明書の種別です。issue -t と同じ値を指定できます。
+	Type string `mapstructure:"type"`
+	// TLSCert と TLSKey を指定すると HTTPS で待ち受けます。
+	TLSCert string `mapstructure:"tls_cert"`
+	TLSKey  string `mapstructure:"tls_key"`
+}
+
+// Origin は ACME で発行した証明書の meta.json の origin です。
+const Origin = "acme"
+
+// 注文・認可・チャレンジの状態です (RFC 8555 7.1.6)。
+const (
+	statusPending    = "pending"
+	statusReady      = "ready"
+	statusProcessing = "processing"
+	statusValid      = "valid"
+	statusInvalid    = "invalid"
+)
+
+// 有効期限です。
+const (
+	orderLifetime = 24 * time.Hour
+	nonceLimit    = 10000
+)
+
+// problem は RFC 7807 のエラー応答です。
+type problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	status int
+}
+
+func (p *problem) Error() string { return p.Detail }
+
+func newProblem(status int, typ, format string, args ...any) *problem {
+	return &problem{Type: "urn:ietf:params:acme:error:" + typ, Detail: fmt.Sprintf(format, args...), status: status}
+}
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type account struct {
+	ID         string          `json:"id"`
+	Thumbprint string          `json:"thumbprint"`
+	JWK        json.RawMessage `json:"jwk"`
+	Contact    []string        `json:"contact,omitempty"`
+	Status     string          `json:"status"`
+	CreatedAt  time.Time       `json:"created_at"`
+	key        crypto.PublicKey
+}
+
+type order struct {
+	id          string
+	account     string
+	status      string
+	expires     time.Time
+	identifiers []identifier
+	authzs      []string
+	cert        []byte
+	err         *problem
+}
+
+type authz struct {
+	id         string
+	account    string
+	identifier identifier
+	status     string
+	expires    time.Time
+	token      string
+	chStatus   string
+	validated  *time.Time
+	err        *problem
+}
+
+// Server は ACME サーバの http.Handler です。
+// アカウントは CA ディレクトリの acme/accounts.json に保存し、注文と認可はメモリ上で管理します。
+type Server struct {
+	cfg      Config
+	mu       sync.Mutex
+	nonceMu  sync.Mutex
+	nonces   map[string]bool
+	accounts map[string]*account
+	orders   map[string]*order
+	authzs   map[string]*authz
+	client   *http.Client
+}
+
+// New は保存済みのアカウントを読み込んで Server を作成します。
+func New(cfg Config) (*Server, error) {
+	setDefaults(&cfg)
+	if !issue.ValidType(cfg.ACME.Type) {
+		return nil, issue.ErrInvalidType
+	}
+	if _, err := issue.ResolveIssuer(cfg.CA.Key, cfg.CA.Cert, cfg.Issuer); err != nil {
+		return nil, err
+	}
+	s := &Server{
+		cfg:      cfg,
+		nonces:   map[string]bool{},
+		accounts: map[string]*account{},
+		orders:   map[string]*order{},
+		authzs:   map[string]*authz{},
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 10 {
+					return errors.New("too many redirects")
+				}
+				return nil
+			},
+		},
+	}
+	if err := s.loadAccounts(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Listen は待ち受けアドレスを返します。
+func (s *Server) Listen() string {
+	return s.cfg.ACME.Listen
+}
+
+// ListenAndServe は設定に従って HTTP または HTTPS で待ち受けます。
+func (s *Server) ListenAndServe() error {
+	if s.cfg.ACME.TLSCert != "" {
+		return http.ListenAndServeTLS(s.cfg.ACME.Listen, s.cfg.ACME.TLSCert, s.cfg.ACME.TLSKey, s)
+	}
+	return http.ListenAndServe(s.cfg.ACME.Listen, s)
+}
+
+// ServeHTTP は ACME の各エンドポイントに振り分けます。
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == "/directory" && r.Method == http.MethodGet:
+		s.directory(w, r)
+		return
+	case path == "/acme/new-nonce" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		w.Header().Set("Replay-Nonce", s.nonce())
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	case r.Method != http.MethodPost:
+		s.fail(w, newProblem(http.StatusMethodNotAllowed, "malformed", "method not allowed"))
+		return
+	}
+
+	// ここから先はすべて JWS で署名された POST です。
+	switch {
+	case path == "/acme/new-account":
+		s.newAccount(w, r)
+		return
+	}
+	req, acct, prob := s.authenticate(r)
+	if prob != nil {
+		s.fail(w, prob)
+		return
+	}
+	var err error
+	switch {
+	case path == "/acme/new-order":
+		err = s.newOrder(w, r, acct, req)
+	case strings.HasPrefix(path, "/acme/acct/") && strings.HasSuffix(path, "/orders"):
+		err = s.listOrders(w, r, acct, strings.TrimSuffix(strings.TrimPrefix(path, "/acme/acct/"), "/orders"))
+	case strings.HasPrefix(path, "/acme/acct/"):
+		err = s.getAccount(w, r, acct, strings.TrimPrefix(path, "/acme/acct/"), req)
+	case strings.HasPrefix(path, "/acme/order/") && strings.HasSuffix(path, "/finalize"):
+		err = s.finalize(w, r, acct, strings.TrimSuffix(strings.TrimPrefix(path, "/acme/order/"), "/finalize"), req)
+	case strings.HasPrefix(path, "/acme/order/"):
+		err = s.getOrder(w, r, acct, strings.TrimPrefix(path, "/acme/order/"))
+	case strings.HasPrefix(path, "/acme/authz/"):
+		err = s.getAuthz(w, r, acct, strings.TrimPrefix(path, "/acme/authz/"))
+	case strings.HasPrefix(path, "/acme/chall/"):
+		err = s.challenge(w, r, acct, strings.TrimPrefix(path, "/acme/chall/"))
+	case strings.HasPrefix(path, "/acme/cert/"):
+		err = s.certificate(w, r, acct, strings.TrimPrefix(path, "/acme/cert/"))
+	default:
+		err = newProblem(http.StatusNotFound, "malformed", "unknown resource %s", path)
+	}
+	if err != nil {
+		s.fail(w, err)
+	}
+}
+
+func (s *Server) directory(w http.ResponseWriter, r *http.Request) {
+	base := s.baseURL(r)
+	s.reply(w, r, http.StatusOK, map[string]any{
+		"newNonce":   base + "/acme/new-nonce",
+		"newAccount": base + "/acme/new-account",
+		"newOrder":   base + "/acme/new-order",
+		"meta": map[string]any{
+			"externalAccountRequired": false,
+		},
+	})
+}
+
+// verified は署名検証済みの要求です。
+type verified struct {
+	header  jwsHeader
+	payload []byte
+}
+
+// parse は要求の JWS を読み込み、nonce と url を検証します。署名の検証は呼び出し側で行います。
+func (s *Server) parse(r *http.Request) (jwsMessage, verified, *problem) {
+	var msg jwsMessage
+	var v verified
+	if ct := r.Header.Get("Content-Type"); ct != "application/jose+json" {
+		return msg, v, newProblem(http.StatusUnsupportedMediaType, "malformed", "content type must be application/jose+json")
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return msg, v, newProblem(http.StatusBadRequest, "malformed", "%v", err)
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return msg, v, newProblem(http.StatusBadRequest, "malformed", "invalid jws: %v", err)
+	}
+	h, payload, err := msg.decode()
+	if err != nil {
+		return msg, v, newProblem(http.StatusBadRequest, "malformed", "invalid jws: %v", err)
+	}
+	if !s.useNonce(h.Nonce) {
+		return msg, v, newProblem(http.StatusBadRequest, "badNonce", "invalid or reused nonce")
+	}
+	if want := s.baseURL(r) + r.URL.Path; h.URL != want {
+		return msg, v, newProblem(http.StatusUnauthorized, "unauthorized", "url %q does not match %q", h.URL, want)
+	}
+	return msg, verified{header: h, payload: payload}, nil
+}
+
+// authenticate は kid で指定されたアカウントの鍵で署名を検証します。
+func (s *Server) authenticate(r *http.Request) (verified, *account, *problem) {
+	msg, v, prob := s.parse(r)
+	if prob != nil {
+		return v, nil, prob
+	}
+	if v.header.KID == "" || len(v.header.JWK) > 0 {
+		return v, nil, newProblem(http.StatusBadRequest, "malformed", "kid required")
+	}
+	id := strings.TrimPrefix(v.header.KID, s.baseURL(r)+"/acme/acct/")
+	s.mu.Lock()
+	acct := s.accounts[id]
+	s.mu.Unlock()
+	if acct == nil {
+		return v, nil, newProblem(http.StatusBadRequest, "accountDoesNotExist", "unknown account %s", v.header.KID)
+	}
+	if acct.Status != statusValid {
+		return v, nil, newProblem(http.StatusUnauthorized, "unauthorized", "account is %s", acct.Status)
+	}
+	if err := msg.verify(v.header.Alg, acct.key); err != nil {
+		return v, nil, signatureProblem(err)
+	}
+	return v, acct, nil
+}
+
+func (s *Server) newAccount(w http.ResponseWriter, r *http.Request) {
+	msg, v, prob := s.parse(r)
+	if prob != nil {
+		s.fail(w, prob)
+		return
+	}
+	if len(v.header.JWK) == 0 || v.header.KID != "" {
+		s.fail(w, newProblem(http.StatusBadRequest, "malformed", "jwk required"))
+		return
+	}
+	pub, key, err := parseJWK(v.header.JWK)
+	if err != nil {
+		s.fail(w, newProblem(http.StatusBadRequest, "badPublicKey", "%v", err))
+		return
+	}
+	if err := msg.verify(v.header.Alg, pub); err != nil {
+		s.fail(w, signatureProblem(err))
+		return
+	}
+	var req struct {
+		Contact            []string `json:"contact"`
+		TermsAgreed        bool     `json:"termsOfServiceAgreed"`
+		OnlyReturnExisting bool     `json:"onlyReturnExisting"`
+	}
+	if len(v.payload) > 0 {
+		if err := json.Unmarshal(v.payload, &req); err != nil {
+			s.fail(w, newProblem(http.StatusBadRequest, "malformed", "%v", err))
+			return
+		}
+	}
+
+	tp := key.thumbprint()
+	s.mu.Lock()
+	var acct *account
+	for _, a := range s.accounts {
+		if a.Thumbprint == tp {
+			acct = a
+		}
+	}
+	status := http.StatusOK
+	if acct == nil {
+		if req.OnlyReturnExisting {
+			s.mu.Unlock()
+			s.fail(w, newProblem(http.StatusBadRequest, "accountDoesNotExist", "no account for key"))
+			return
+		}
+		acct = &account{ID: randomID(), Thumbprint: tp, JWK: v.header.JWK, Contact: req.Contact, Status: statusValid, CreatedAt: time.Now().UTC(), key: pub}
+		s.accounts[acct.ID] = acct
+		status = http.StatusCreated
+		if err := s.saveAccounts(); err != nil {
+			delete(s.accounts, acct.ID)
+			s.mu.Unlock()
+			s.fail(w, err)
+			return
+		}
+	}
+	body := s.accountJSON(r, acct)
+	s.mu.Unlock()
+	w.Header().Set("Location", s.baseURL(r)+"/acme/acct/"+acct.ID)
+	s.reply(w, r, status, body)
+}
+
+func (s *Server) getAccount(w http.ResponseWriter, r *http.Request, acct *account, id string, v verified) error {
+	if id != acct.ID {
+		return newProblem(http.StatusUnauthorized, "unauthorized", "account mismatch")
+	}
+	var req struct {
+		Contact []string `json:"contact"`
+		Status  string   `json:"status"`
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(v.payload) > 0 {
+		if err := json.Unmarshal(v.payload, &req); err != nil {
+			return newProblem(http.StatusBadRequest, "malformed", "%v", err)
+		}
+		if req.Contact != nil {
+			acct.Contact = req.Contact
+		}
+		if req.Status == "deactivated" {
+			acct.Status = req.Status
+		}
+		if err := s.saveAccounts(); err != nil {
+			return err
+		}
+	}
+	w.Header().Set("Location", s.baseURL(r)+"/acme/acct/"+acct.ID)
+	s.reply(w, r, http.StatusOK, s.accountJSON(r, acct))
+	return nil
+}
+
+func (s *Server) listOrders(w http.ResponseWriter, r *http.Request, acct *account, id string) error {
+	if id != acct.ID {
+		return newProblem(http.StatusUnauthorized, "unauthorized", "account mismatch")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	urls := []string{}
+	for _, o := range s.orders {
+		if o.account == acct.ID {
+			urls = append(urls, s.baseURL(r)+"/acme/order/"+o.id)
+		}
+	}
+	sort.Strings(urls)
+	s.reply(w, r, http.StatusOK, map[string]any{"orders": urls})
+	return nil
+}
+
+func (s *Server) accountJSON(r *http.Request, acct *account) map[string]any {
+	return map[string]any{
+		"status":  acct.Status,
+		"contact": acct.Contact,
+		"orders":  s.baseURL(r) + "/acme/acct/" + acct.ID + "/orders",
+	}
+}
+
+func (s *Server) newOrder(w http.ResponseWriter, r *http.Request, acct *account, v verified) error {
+	var req struct {
+		Identifiers []identifier `json:"identifiers"`
+	}
+	if err := json.Unmarshal(v.payload, &req); err != nil || len(req.Identifiers) == 0 {
+		return newProblem(http.StatusBadRequest, "malformed", "identifiers required")
+	}
+	for i, id := range req.Identifiers {
+		id.Value = strings.ToLower(id.Value)
+		if ip := net.ParseIP(id.Value); id.Type == "ip" && ip != nil {
+			id.Value = ip.String()
+		}
+		req.Identifiers[i] = id
+		switch {
+		case id.Type == "dns" && id.Value != "" && net.ParseIP(id.Value) == nil:
+			if strings.HasPrefix(id.Value, "*.") && !s.cfg.ACME.TrustAll {
+				return newProblem(http.StatusBadRequest, "rejectedIdentifier", "wildcard %s requires trust_all (http-01 cannot validate it)", id.Value)
+			}
+		case id.Type == "ip" && net.ParseIP(id.Value) != nil:
+		default:
+			return newProblem(http.StatusBadRequest, "rejectedIdentifier", "unsupported identifier %s:%s", id.Type, id.Value)
+		}
+	}
+
+	now := time.Now()
+	o := &order{id: randomID(), account: acct.ID, status: statusPending, expires: now.Add(orderLifetime), identifiers: req.Identifiers}
+	s.mu.Lock()
+	for _, id := range req.Identifiers {
+		a := &authz{id: randomID(), account: acct.ID, identifier: id, status: statusPending, expires: o.expires, token: randomID(), chStatus: statusPending}
+		if s.cfg.ACME.TrustAll {
+			a.status, a.chStatus, a.validated = statusValid, statusValid, &now
+		}
+		s.authzs[a.id] = a
+		o.authzs = append(o.authzs, a.id)
+	}
+	s.orders[o.id] = o
+	s.updateOrder(o)
+	body := s.orderJSON(r, o)
+	s.mu.Unlock()
+	w.Header().Set("Location", s.baseURL(r)+"/acme/order/"+o.id)
+	s.reply(w, r, http.StatusCreated, body)
+	return nil
+}
+
+func (s *Server) getOrder(w http.ResponseWriter, r *http.Request, acct *account, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := s.orders[id]
+	if o == nil || o.account != acct.ID {
+		return newProblem(http.StatusNotFound, "malformed", "order not found")
+	}
+	s.updateOrder(o)
+	s.reply(w, r, http.StatusOK, s.orderJSON(r, o))
+	return nil
+}
+
+// updateOrder は認可の状態から注文の状態を求めます。呼び出し側で mu を保持します。
+func (s *Server) updateOrder(o *order) {
+	if o.status != statusPending && o.status != statusReady {
+		return
+	}
+	if time.Now().After(o.expires) {
+		o.status = statusInvalid
+		return
+	}
+	all := true
+	for _, id := range o.authzs {
+		switch s.authzs[id].status {
+		case statusInvalid:
+			o.status = statusInvalid
+			return
+		case statusValid:
+		default:
+			all = false
+		}
+	}
+	if all {
+		o.status = statusReady
+	}
+}
+
+func (s *Server) orderJSON(r *http.Request, o *order) map[string]any {
+	base := s.baseURL(r)
+	var authzs []string
+	for _, id := range o.authzs {
+		authzs = append(authzs, base+"/acme/authz/"+id)
+	}
+	body := map[string]any{
+		"status":         o.status,
+		"expires":        o.expires.UTC().Format(time.RFC3339),
+		"identifiers":    o.identifiers,
+		"authorizations": authzs,
+		"finalize":       base + "/acme/order/" + o.id + "/finalize",
+	}
+	if o.cert != nil {
+		body["certificate"] = base + "/acme/cert/" + o.id
+	}
+	if o.err != nil {
+		body["error"] = o.err
+	}
+	return body
+}
+
+func (s *Server) getAuthz(w http.ResponseWriter, r *http.Request, acct *account, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.authzs[id]
+	if a == nil || a.account != acct.ID {
+		return newProblem(http.StatusNotFound, "malformed", "authorization not found")
+	}
+	s.reply(w, r, http.StatusOK, s.authzJSON(r, a))
+	return nil
+}
+
+func (s *Server) authzJSON(r *http.Request, a *authz) map[string]any {
+	id := a.identifier
+	body := map[string]any{
+		"status":     a.status,
+		"expires":    a.expires.UTC().Format(time.RFC3339),
+		"identifier": identifier{Type: id.Type, Value: strings.TrimPrefix(id.Value, "*.")},
+		"challenges": []any{s.challengeJSON(r, a)},
+	}
+	if strings.HasPrefix(id.Value, "*.") {
+		body["wildcard"] = true
+	}
+	return body
+}
+
+func (s *Server) challengeJSON(r *http.Request, a *authz) map[string]any {
+	body := map[string]any{
+		"type":   "http-01",
+		"url":    s.baseURL(r) + "/acme/chall/" + a.id,
+		"token":  a.token,
+		"status": a.chStatus,
+	}
+	if a.validated != nil {
+		body["validated"] = a.validated.UTC().Format(time.RFC3339)
+	}
+	if a.err != nil {
+		body["error"] = a.err
+	}
+	return body
+}
+
+// challenge は http-01 の検証を行います。検証は要求を受けた時点で同期的に行い、
+// 結果を反映したチャレンジを返します。
+func (s *Server) challenge(w http.ResponseWriter, r *http.Request, acct *account, id string) error {
+	s.mu.Lock()
+	a := s.authzs[id]
+	if a == nil || a.account != acct.ID {
+		s.mu.Unlock()
+		return newProblem(http.StatusNotFound, "malformed", "challenge not found")
+	}
+	start := a.chStatus == statusPending
+	if start {
+		a.chStatus = statusProcessing
+	}
+	s.mu.Unlock()
+
+	if start {
+		err := s.validate(r.Context(), a.identifier, a.token, acct.Thumbprint)
+		now := time.Now()
+		s.mu.Lock()
+		if err != nil {
+			a.status, a.chStatus = statusInvalid, statusInvalid
+			a.err = err
+		} else {
+			a.status, a.chStatus, a.validated = statusValid, statusValid, &now
+		}
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	body := s.challengeJSON(r, a)
+	s.mu.Unlock()
+	w.Header().Add("Link", fmt.Sprintf("<%s/acme/authz/%s>;rel=\"up\"", s.baseURL(r), a.id))
+	s.reply(w, r, http.StatusOK, body)
+	return nil
+}
+
+// validate は http://<identifier>/.well-known/acme-challenge/<token> が
+// token.thumbprint を返すことを確認します。
+func (s *Server) validate(ctx context.Context, id identifier, token, thumbprint string) *problem {
+	host := net.JoinHostPort(id.Value, strconv.Itoa(s.cfg.ACME.HTTP01Port))
+	url := "http://" + host + "/.well-known/acme-challenge/" + token
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, "connection", "%v", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, "connection", "fetch %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return newProblem(http.StatusForbidden, "unauthorized", "fetch %s: status %d", url, resp.StatusCode)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return newProblem(http.StatusBadRequest, "connection", "%v", err)
+	}
+	if want := token + "." + thumbprint; strings.TrimSpace(string(b)) != want {
+		return newProblem(http.StatusForbidden, "incorrectResponse", "key authorization mismatch at %s", url)
+	}
+	return nil
+}
+
+func (s *Server) finalize(w http.ResponseWriter, r *http.Request, acct *account, id string, v verified) error {
+	var req struct {
+		CSR string `json:"csr"`
+	}
+	if err := json.Unmarshal(v.payload, &req); err != nil {
+		return newProblem(http.StatusBadRequest, "malformed", "%v", err)
+	}
+	der, err := b64(req.CSR)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, "badCSR", "%v", err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, "badCSR", "%v", err)
+	}
+
+	s.mu.Lock()
+	o := s.orders[id]
+	if o == nil || o.account != acct.ID {
+		s.mu.Unlock()
+		return newProblem(http.StatusNotFound, "malformed", "order not found")
+	}
+	s.updateOrder(o)
+	if o.status != statusReady {
+		s.mu.Unlock()
+		return newProblem(http.StatusForbidden, "orderNotReady", "order is %s", o.status)
+	}
+	o.status = statusProcessing
+	idents := o.identifiers
+	s.mu.Unlock()
+
+	cert, prob := s.sign(csr, idents)
+	s.mu.Lock()
+	if prob != nil {
+		// CSR の誤りは再提出できるよう注文を ready に戻します。
+		o.status = statusReady
+		if prob.Type != "urn:ietf:params:acme:error:badCSR" {
+			o.status, o.err = statusInvalid, prob
+		}
+		s.mu.Unlock()
+		return prob
+	}
+	o.status, o.cert = statusValid, cert
+	body := s.orderJSON(r, o)
+	s.mu.Unlock()
+	w.Header().Set("Location", s.baseURL(r)+"/acme/order/"+o.id)
+	s.reply(w, r, http.StatusOK, body)
+	return nil
+}
+
+// sign は CSR の名前が注文の識別子と一致することを確認し、issue.SignCSR で発行して
+// fullchain.pem の内容を返します。
+func (s *Server) sign(csr *x509.CertificateRequest, idents []identifier) ([]byte, *problem) {
+	want := map[string]bool{}
+	var san []string
+	for _, id := range idents {
+		want[id.Type+":"+id.Value] = true
+		if id.Type == "ip" {
+			san = append(san, "IP:"+net.ParseIP(id.Value).String())
+		} else {
+			san = append(san, "DNS:"+id.Value)
+		}
+	}
+	got := map[string]bool{}
+	for _, d := range csr.DNSNames {
+		got["dns:"+strings.ToLower(d)] = true
+	}
+	for _, ip := range csr.IPAddresses {
+		got["ip:"+ip.String()] = true
+	}
+	cn := strings.ToLower(csr.Subject.CommonName)
+	if cn != "" && !want["dns:"+cn] && !want["ip:"+cn] {
+		return nil, newProblem(http.StatusBadRequest, "badCSR", "common name %s is not in the order", cn)
+	}
+	if len(got) != len(want) {
+		return nil, newProblem(http.StatusBadRequest, "badCSR", "csr names do not match the order")
+	}
+	for k := range got {
+		if !want[k] {
+			return nil, newProblem(http.StatusBadRequest, "badCSR", "csr name %s is not in the order", k)
+		}
+	}
+	if cn == "" {
+		cn = idents[0].Value
+	}
+
+	// ACME で発行した証明書だけを置き換え、CLI で発行した同じ CN の証明書と鍵は残します。
+	cfg := s.cfg.Config
+	cfg.Overwrite = false
+	if err := issue.SignCSR(cfg, issue.Profile{CN: cn, SAN: san, Origin: Origin}, s.cfg.ACME.Type, csr, issue.SANOverride); err != nil {
+		if errors.Is(err, issue.ErrCSRSignature) || errors.Is(err, issue.ErrInvalidCN) {
+			return nil, newProblem(http.StatusBadRequest, "badCSR", "%v", err)
+		}
+		if errors.Is(err, issue.ErrExists) {
+			return nil, newProblem(http.StatusForbidden, "unauthorized", "%s exists and was not issued by acme", cn)
+		}
+		return nil, newProblem(http.StatusInternalServerError, "serverInternal", "%v", err)
+	}
+	paths, err := cfg.Paths(cn)
+	if err != nil {
+		return nil, newProblem(http.StatusInternalServerError, "serverInternal", "%v", err)
+	}
+	b, err := os.ReadFile(paths.Fullchain)
+	if err != nil {
+		return nil, newProblem(http.StatusInternalServerError, "serverInternal", "%v", err)
+	}
+	return b, nil
+}
+
+func (s *Server) certificate(w http.ResponseWriter, r *http.Request, acct *account, id string) error {
+	s.mu.Lock()
+	o := s.orders[id]
+	s.mu.Unlock()
+	if o == nil || o.account != acct.ID || o.cert == nil {
+		return newProblem(http.StatusNotFound, "malformed", "certificate not found")
+	}
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	w.Header().Set("Replay-Nonce", s.nonce())
+	w.Header().Add("Link", fmt.Sprintf("<%s/directory>;rel=\"index\"", s.baseURL(r)))
+	w.Write(o.cert)
+	return nil
+}
+
+// reply は Replay-Nonce と index リンクを付けて JSON を返します。
+func (s *Server) reply(w http.ResponseWriter, r *http.Request, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Replay-Nonce", s.nonce())
+	w.Header().Add("Link", fmt.Sprintf("<%s/directory>;rel=\"index\"", s.baseURL(r)))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// fail はエラーを problem+json で返します。
+func (s *Server) fail(w http.ResponseWriter, err error) {
+	var p *problem
+	if !errors.As(err, &p) {
+		p = newProblem(http.StatusInternalServerError, "serverInternal", "%v", err)
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("Replay-Nonce", s.nonce())
+	w.WriteHeader(p.status)
+	json.NewEncoder(w).Encode(p)
+}
+
+func (s *Server) baseURL(r *http.Request) string {
+	if s.cfg.ACME.BaseURL != "" {
+		return strings.TrimSuffix(s.cfg.ACME.BaseURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func (s *Server) nonce() string {
+	n := randomID()
+	s.nonceMu.Lock()
+	if len(s.nonces) >= nonceLimit {
+		// 古い nonce を個別に追跡せず一括で破棄します。クライアントは badNonce で再試行します。
+		s.nonces = map[string]bool{}
+	}
+	s.nonces[n] = true
+	s.nonceMu.Unlock()
+	return n
+}
+
+func (s *Server) useNonce(n string) bool {
+	s.nonceMu.Lock()
+	defer s.nonceMu.Unlock()
+	if !s.nonces[n] {
+		return false
+	}
+	delete(s.nonces, n)
+	return true
+}
+
+// accountsPath はアカウントの保存先です。
+func (s *Server) accountsPath() string {
+	return filepath.Join(filepath.Dir(s.cfg.CA.Cert), "acme", "accounts.json")
+}
+
+func (s *Server) loadAccounts() error {
+	b, err := os.ReadFile(s.accountsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var list []*account
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	for _, a := range list {
+		pub, _, err := parseJWK(a.JWK)
+		if err != nil {
+			return err
+		}
+		a.key = pub
+		s.accounts[a.ID] = a
+	}
+	return nil
+}
+
+// saveAccounts はアカウントを保存します。呼び出し側で mu を保持します。
+func (s *Server) saveAccounts() error {
+	var list []*account
+	for _, a := range s.accounts {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.accountsPath()), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.accountsPath(), b, 0600)
+}
+
+func signatureProblem(err error) *problem {
+	if errors.Is(err, errBadAlgorithm) {
+		return newProblem(http.StatusBadRequest, "badSignatureAlgorithm", "%v", err)
+	}
+	return newProblem(http.StatusUnauthorized, "unauthorized", "%v", err)
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func setDefaults(cfg *Config) {
+	if cfg.ACME.Listen == "" {
+		cfg.ACME.Listen = ":14000"
+	}
+	if cfg.ACME.HTTP01Port == 0 {
+		cfg.ACME.HTTP01Port = 80
+	}
+	if cfg.ACME.Type == "" {
+		cfg.ACME.Type = "server"
+	}
+	if cfg.CA.Key == "" {
+		cfg.CA.Key = cfg.CAPath("key.pem")
+	}
+	if cfg.CA.Cert == "" {
+		cfg.CA.Cert = cfg.CAPath("cert.pem")
+	}
+}
@@ -0,0 +1,209 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	xacme "golang.org/x/crypto/acme"
+
+	"orecert/internal/ca"
+	"orecert/internal/db"
+	"orecert/internal/issue"
+)
+
+func setup(t *testing.T, trustAll bool) (*Server, *xacme.Client) {
+	t.Helper()
+	dir := t.TempDir()
+	os.Chdir(dir)
+	cfg := Config{}
+	cfg.CA.Key = filepath.Join(dir, "certs", "ca", "key.pem")
+	cfg.CA.Cert = filepath.Join(dir, "certs", "ca", "cert.pem")
+	cfg.ACME.TrustAll = trustAll
+	if err := ca.InitCA(ca.Config{CA: cfg.CA}); err != nil {
+		t.Fatalf("init ca: %v", err)
+	}
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c := &xacme.Client{Key: key, DirectoryURL: srv.URL + "/directory"}
+	if _, err := c.Register(context.Background(), &xacme.Account{}, xacme.AcceptTOS); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	return s, c
+}
+
+func csrFor(t *testing.T, cn string, dns []string, ips []net.IP) []byte {
+	t.Helper()
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: cn}, DNSNames: dns, IPAddresses: ips}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestACME_TrustAll(t *testing.T) {
+	_, c := setup(t, true)
+	ctx := context.Background()
+	o, err := c.AuthorizeOrder(ctx, xacme.DomainIDs("app.test", "www.app.test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Status != xacme.StatusReady {
+		t.Fatalf("order should be ready in trust-all mode: %s", o.Status)
+	}
+	ders, _, err := c.CreateOrderCert(ctx, o.FinalizeURL, csrFor(t, "app.test", []string{"app.test", "www.app.test"}, nil), true)
+	if err != nil {
+		t.Fatalf("finalize: %v", err)
+	}
+	if len(ders) != 2 {
+		t.Fatalf("expected leaf and ca, got %d", len(ders))
+	}
+	leaf, _ := x509.ParseCertificate(ders[0])
+	if leaf.Subject.CommonName != "app.test" || len(leaf.DNSNames) != 2 {
+		t.Fatalf("unexpected leaf: %v %v", leaf.Subject, leaf.DNSNames)
+	}
+	if _, err := os.Stat(filepath.Join("certs", "app.test", "meta.json")); err != nil {
+		t.Fatalf("meta.json not written: %v", err)
+	}
+	if _, err := db.Lookup(db.Path(filepath.Join("certs", "ca", "cert.pem")), db.SerialHex(leaf.SerialNumber)); err != nil {
+		t.Fatalf("not recorded: %v", err)
+	}
+}
+
+func TestACME_BadCSR(t *testing.T) {
+	_, c := setup(t, true)
+	ctx := context.Background()
+	o, err := c.AuthorizeOrder(ctx, xacme.DomainIDs("app.test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = c.CreateOrderCert(ctx, o.FinalizeURL, csrFor(t, "evil.test", []string{"evil.test"}, nil), true)
+	var ae *xacme.Error
+	if !errors.As(err, &ae) || ae.ProblemType != "urn:ietf:params:acme:error:badCSR" {
+		t.Fatalf("expected badCSR, got %v", err)
+	}
+}
+
+// TestACME_KeepsCLICert は CLI で発行した CN を ACME で置き換えず、ACME で発行した CN は再発行できることを確認します。
+func TestACME_KeepsCLICert(t *testing.T) {
+	s, c := setup(t, true)
+	if err := issue.Issue(s.cfg.Config, issue.Profile{CN: "cli.test"}, "server"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	finalize := func(name string) error {
+		o, err := c.AuthorizeOrder(ctx, xacme.DomainIDs(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = c.CreateOrderCert(ctx, o.FinalizeURL, csrFor(t, name, []string{name}, nil), true)
+		return err
+	}
+	var ae *xacme.Error
+	if err := finalize("cli.test"); !errors.As(err, &ae) || ae.ProblemType != "urn:ietf:params:acme:error:unauthorized" {
+		t.Fatalf("expected unauthorized, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("certs", "cli.test", "key.pem")); err != nil {
+		t.Fatalf("cli key removed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := finalize("acme.test"); err != nil {
+			t.Fatalf("acme issue %d: %v", i, err)
+		}
+	}
+}
+
+func TestACME_HTTP01(t *testing.T) {
+	s, c := setup(t, false)
+	ctx := context.Background()
+	var keyAuth string
+	var token string
+	web := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == c.HTTP01ChallengePath(token) {
+			w.Write([]byte(keyAuth))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer web.Close()
+	u, _ := url.Parse(web.URL)
+	s.cfg.ACME.HTTP01Port, _ = strconv.Atoi(u.Port())
+
+	o, err := c.AuthorizeOrder(ctx, xacme.IPIDs("127.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Status != xacme.StatusPending {
+		t.Fatalf("order should be pending: %s", o.Status)
+	}
+	z, err := c.GetAuthorization(ctx, o.AuthzURLs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	chal := z.Challenges[0]
+	token = chal.Token
+	keyAuth, _ = c.HTTP01ChallengeResponse(token)
+	if _, err := c.Accept(ctx, chal); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.WaitAuthorization(ctx, z.URI); err != nil {
+		t.Fatalf("authorization: %v", err)
+	}
+	ders, _, err := c.CreateOrderCert(ctx, o.FinalizeURL, csrFor(t, "", nil, []net.IP{net.ParseIP("127.0.0.1")}), false)
+	if err != nil {
+		t.Fatalf("finalize: %v", err)
+	}
+	leaf, _ := x509.ParseCertificate(ders[0])
+	if len(leaf.IPAddresses) != 1 || leaf.Subject.CommonName != "127.0.0.1" {
+		t.Fatalf("unexpected leaf: %v %v", leaf.Subject, leaf.IPAddresses)
+	}
+
+	// 誤った応答では認可が invalid になり、注文も invalid になります。
+	keyAuth = "wrong"
+	o, _ = c.AuthorizeOrder(ctx, xacme.IPIDs("127.0.0.1"))
+	z, _ = c.GetAuthorization(ctx, o.AuthzURLs[0])
+	token = z.Challenges[0].Token
+	c.Accept(ctx, z.Challenges[0])
+	if _, err := c.WaitAuthorization(ctx, z.URI); err == nil {
+		t.Fatal("expected authorization failure")
+	}
+	if o, _ = c.GetOrder(ctx, o.URI); o.Status != xacme.StatusInvalid {
+		t.Fatalf("order should be invalid: %s", o.Status)
+	}
+}
+
+func TestACME_AccountsPersist(t *testing.T) {
+	s, c := setup(t, true)
+	s2, err := New(s.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s2.accounts) != 1 {
+		t.Fatalf("accounts not reloaded: %d", len(s2.accounts))
+	}
+	srv := httptest.NewServer(s2)
+	defer srv.Close()
+	c2 := &xacme.Client{Key: c.Key, DirectoryURL: srv.URL + "/directory"}
+	if _, err := c2.GetReg(context.Background(), ""); err != nil {
+		t.Fatalf("existing account lookup: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	errBadSignature = errors.New("jws signature invalid")
+	errBadAlgorithm = errors.New("unsupported jws algorithm")
+	errBadKey       = errors.New("unsupported jwk")
+)
+
+// jwsMessage は flattened JSON 形式の JWS です (RFC 8555 6.2)。
+type jwsMessage struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// jwsHeader は JWS の protected ヘッダです。jwk と kid はどちらか一方を含みます。
+type jwsHeader struct {
+	Alg   string          `json:"alg"`
+	Nonce string          `json:"nonce"`
+	URL   string          `json:"url"`
+	KID   string          `json:"kid"`
+	JWK   json.RawMessage `json:"jwk"`
+}
+
+// jwk は RSA・EC・OKP (Ed25519) の公開鍵の JSON Web Key です。
+type jwk struct {
+	Kty string `json:"kty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// decode は JWS のヘッダとペイロードを復号します。署名は検証しません。
+func (m jwsMessage) decode() (jwsHeader, []byte, error) {
+	var h jwsHeader
+	b, err := b64(m.Protected)
+	if err != nil {
+		return h, nil, err
+	}
+	if err := json.Unmarshal(b, &h); err != nil {
+		return h, nil, err
+	}
+	payload, err := b64(m.Payload)
+	return h, payload, err
+}
+
+// verify は公開鍵 pub で JWS の署名を検証します。
+func (m jwsMessage) verify(alg string, pub crypto.PublicKey) error {
+	sig, err := b64(m.Signature)
+	if err != nil {
+		return err
+	}
+	input := []byte(m.Protected + "." + m.Payload)
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			return errBadAlgorithm
+		}
+		sum := sha256.Sum256(input)
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) != nil {
+			return errBadSignature
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		var digest []byte
+		switch {
+		case alg == "ES256" && k.Curve == elliptic.P256():
+			sum := sha256.Sum256(input)
+			digest = sum[:]
+		case alg == "ES384" && k.Curve == elliptic.P384():
+			sum := sha512.Sum384(input)
+			digest = sum[:]
+		case alg == "ES512" && k.Curve == elliptic.P521():
+			sum := sha512.Sum512(input)
+			digest = sum[:]
+		default:
+			return errBadAlgorithm
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errBadSignature
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errBadSignature
+		}
+		return nil
+	case ed25519.PublicKey:
+		if alg != "EdDSA" {
+			return errBadAlgorithm
+		}
+		if !ed25519.Verify(k, input, sig) {
+			return errBadSignature
+		}
+		return nil
+	default:
+		return errBadKey
+	}
+}
+
+// parseJWK は JWK を公開鍵に変換します。
+func parseJWK(raw []byte) (crypto.PublicKey, jwk, error) {
+	var k jwk
+	if err := json.Unmarshal(raw, &k); err != nil {
+		return nil, k, err
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err1 := b64(k.N)
+		e, err2 := b64(k.E)
+		if err1 != nil || err2 != nil || len(e) > 4 {
+			return nil, k, errBadKey
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, k, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, k, errBadKey
+		}
+		x, err1 := b64(k.X)
+		y, err2 := b64(k.Y)
+		if err1 != nil || err2 != nil {
+			return nil, k, errBadKey
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, k, errBadKey
+		}
+		return pub, k, nil
+	case "OKP":
+		x, err := b64(k.X)
+		if err != nil || k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, k, errBadKey
+		}
+		return ed25519.PublicKey(x), k, nil
+	default:
+		return nil, k, errBadKey
+	}
+}
+
+// thumbprint は RFC 7638 の JWK サムプリント (SHA-256, base64url) を返します。
+func (k jwk) thumbprint() string {
+	var s string
+	switch k.Kty {
+	case "RSA":
+		s = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, k.E, k.N)
+	case "EC":
+		s = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, k.Crv, k.X, k.Y)
+	default:
+		s = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, k.Crv, k.Kty, k.X)
+	}
+	sum := sha256.Sum256([]byte(s))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// b64 はパディング無しの base64url を復号します。
+func b64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
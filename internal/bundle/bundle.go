@@ -6,16 +6,21 @@ import (
 	"encoding/pem"
 	"errors"
 	"os"
-	"path/filepath"
 	"time"
 
 	keystore "github.com/pavlo-v-chernykh/keystore-go/v4"
 	"software.sslmate.com/src/go-pkcs12"
+
+	"orecert/internal/issue"
+	"orecert/internal/password"
+	"orecert/internal/pkcs8"
 )
 
 // Config は bundle 用の最小設定です。
 type Config struct {
+	issue.Layout   `mapstructure:",squash"`
 	PKCS12Password string `mapstructure:"pkcs12_password"`
+	KeyPass        string `mapstructure:"key_pass"`
 	CA             struct {
 		Cert string `mapstructure:"cert"`
 	} `mapstructure:"ca"`
@@ -24,42 +29,50 @@ type Config struct {
 // Bundle は指定 CN の鍵と証明書を梱包します。
 func Bundle(cfg Config, cn, typ string) error {
 	if cfg.CA.Cert == "" {
-		cfg.CA.Cert = filepath.FromSlash("certs/ca/cert.pem")
+		cfg.CA.Cert = cfg.CAPath("cert.pem")
+	}
+	paths, err := cfg.Paths(cn)
+	if err != nil {
+		return err
 	}
-	base := filepath.Join("certs", cn)
-	keyPath := filepath.Join(base, "key.pem")
-	certPath := filepath.Join(base, "cert.pem")
 
-	key, err := readKey(keyPath)
+	key, err := readKey(paths.Key, password.Cached(cfg.KeyPass))
 	if err != nil {
 		return err
 	}
-	cert, err := readCert(certPath)
+	cert, err := readCert(paths.Cert)
 	if err != nil {
 		return err
 	}
-	caCert, err := readCert(cfg.CA.Cert)
+	chain, err := readChain(paths.Fullchain, cfg.CA.Cert)
 	if err != nil {
 		return err
 	}
 
+	if typ != "pkcs" && typ != "jks" && typ != "all" {
+		return errors.New("unsupported type")
+	}
+	pw, err := password.ResolveNew(cfg.PKCS12Password)
+	if err != nil {
+		return err
+	}
+	defer password.Zero(pw)
+
 	switch typ {
 	case "pkcs", "all":
-		if err := writePKCS12(base, key, cert, caCert, cfg.PKCS12Password); err != nil {
+		if err := writePKCS12(paths.PKCS12, key, cert, chain, string(pw)); err != nil {
 			return err
 		}
 		if typ == "pkcs" {
 			return nil
 		}
 		fallthrough
-	case "jks":
-		return writeJKS(base, key, cert, caCert, cfg.PKCS12Password)
 	default:
-		return errors.New("unsupported type")
+		return writeJKS(paths.JKS, key, cert, chain, string(pw))
 	}
 }
 
-func readKey(path string) (any, error) {
+func readKey(path string, pass password.Source) (any, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -69,6 +82,10 @@ func readKey(path string) (any, error) {
 		return nil, errors.New("invalid key pem")
 	}
 	switch blk.Type {
+	case pkcs8.PEMType:
+		return password.WithRetry(pass, pkcs8.ErrDecrypt, func(pw []byte) (any, error) {
+			return pkcs8.Decrypt(blk.Bytes, pw)
+		})
 	case "RSA PRIVATE KEY":
 		return x509.ParsePKCS1PrivateKey(blk.Bytes)
 	case "EC PRIVATE KEY":
@@ -90,30 +107,63 @@ func readCert(path string) (*x509.Certificate, error) {
 	return x509.ParseCertificate(blk.Bytes)
 }
 
-func writePKCS12(base string, key any, cert, ca *x509.Certificate, password string) error {
-	der, err := pkcs12.Encode(rand.Reader, key, cert, []*x509.Certificate{ca}, password)
+// readChain は fullchain.pem から CA 連鎖を読み込みます。
+// fullchain.pem が無い場合は CA 証明書 1 枚を連鎖とします。
+func readChain(fullchain, caCert string) ([]*x509.Certificate, error) {
+	b, err := os.ReadFile(fullchain)
+	if err != nil {
+		ca, err := readCert(caCert)
+		if err != nil {
+			return nil, err
+		}
+		return []*x509.Certificate{ca}, nil
+	}
+	var chain []*x509.Certificate
+	for {
+		var blk *pem.Block
+		blk, b = pem.Decode(b)
+		if blk == nil {
+			break
+		}
+		c, err := x509.ParseCertificate(blk.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, c)
+	}
+	if len(chain) < 2 {
+		return nil, errors.New("invalid fullchain pem")
+	}
+	return chain[1:], nil
+}
+
+func writePKCS12(out string, key any, cert *x509.Certificate, chain []*x509.Certificate, password string) error {
+	der, err := pkcs12.Encode(rand.Reader, key, cert, chain, password)
 	if err != nil {
 		return err
 	}
-	out := filepath.Join(base, "bundle.p12")
 	return os.WriteFile(out, der, 0644)
 }
 
-func writeJKS(base string, key any, cert, ca *x509.Certificate, password string) error {
+func writeJKS(out string, key any, cert *x509.Certificate, chain []*x509.Certificate, password string) error {
 	ks := keystore.New()
 	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
 	if err != nil {
 		return err
 	}
+	certs := []keystore.Certificate{{Type: "X509", Content: cert.Raw}}
+	for _, c := range chain {
+		certs = append(certs, keystore.Certificate{Type: "X509", Content: c.Raw})
+	}
 	entry := keystore.PrivateKeyEntry{
 		CreationTime:     time.Now(),
 		PrivateKey:       keyDER,
-		CertificateChain: []keystore.Certificate{{Type: "X509", Content: cert.Raw}, {Type: "X509", Content: ca.Raw}},
+		CertificateChain: certs,
 	}
 	if err := ks.SetPrivateKeyEntry("orecert", entry, []byte(password)); err != nil {
 		return err
 	}
-	f, err := os.Create(filepath.Join(base, "bundle.jks"))
+	f, err := os.Create(out)
 	if err != nil {
 		return err
 	}
@@ -15,7 +15,10 @@ import (
 	"testing"
 	"time"
 
+	"software.sslmate.com/src/go-pkcs12"
+
 	"orecert/internal/ca"
+	"orecert/internal/issue"
 )
 
 func generateCert(t *testing.T, dir, cn string) {
@@ -200,15 +203,78 @@ func TestBundle_MissingCA(t *testing.T) {
 }
 
 func TestWritePKCS12_Error(t *testing.T) {
-	err := writePKCS12(t.TempDir(), struct{}{}, &x509.Certificate{}, &x509.Certificate{}, "p")
+	err := writePKCS12(t.TempDir(), struct{}{}, &x509.Certificate{}, []*x509.Certificate{{}}, "p")
 	if err == nil {
 		t.Fatalf("expected error")
 	}
 }
 
 func TestWriteJKS_Error(t *testing.T) {
-	err := writeJKS("/no/such/dir", struct{}{}, &x509.Certificate{}, &x509.Certificate{}, "p")
+	err := writeJKS("/no/such/dir", struct{}{}, &x509.Certificate{}, []*x509.Certificate{{}}, "p")
 	if err == nil {
 		t.Fatalf("expected error")
 	}
 }
+
+func TestBundle_FullChain(t *testing.T) {
+	dir := t.TempDir()
+	cfg := ca.Config{}
+	cfg.CA.Key = filepath.Join(dir, "certs", "ca", "key.pem")
+	cfg.CA.Cert = filepath.Join(dir, "certs", "ca", "cert.pem")
+	if err := ca.InitCA(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.InitIntermediate(cfg, "issuing", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	os.Chdir(dir)
+	icfg := issue.Config{Issuer: "issuing"}
+	icfg.CA = cfg.CA
+	if err := issue.Issue(icfg, issue.Profile{CN: "chain"}, "server"); err != nil {
+		t.Fatal(err)
+	}
+	bcfg := Config{PKCS12Password: "pass"}
+	bcfg.CA.Cert = cfg.CA.Cert
+	if err := Bundle(bcfg, "chain", "pkcs"); err != nil {
+		t.Fatalf("bundle: %v", err)
+	}
+	der, _ := os.ReadFile(filepath.Join("certs", "chain", "bundle.p12"))
+	_, _, cas, err := pkcs12.DecodeChain(der, "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cas) != 2 {
+		t.Fatalf("intermediate and root expected: %d", len(cas))
+	}
+}
+
+func TestBundle_EncryptedKey(t *testing.T) {
+	dir := t.TempDir()
+	cfg := ca.Config{}
+	cfg.CA.Key = filepath.Join(dir, "certs", "ca", "key.pem")
+	cfg.CA.Cert = filepath.Join(dir, "certs", "ca", "cert.pem")
+	if err := ca.InitCA(cfg); err != nil {
+		t.Fatal(err)
+	}
+	os.Chdir(dir)
+	icfg := issue.Config{}
+	icfg.CA = cfg.CA
+	if err := issue.Issue(icfg, issue.Profile{CN: "enc", EncryptKey: true, KeyPass: "keypass"}, "server"); err != nil {
+		t.Fatal(err)
+	}
+	pwFile := filepath.Join(dir, "p12.txt")
+	os.WriteFile(pwFile, []byte("p12pass\n"), 0600)
+	bcfg := Config{PKCS12Password: "file:" + pwFile, KeyPass: "keypass"}
+	bcfg.CA.Cert = cfg.CA.Cert
+	if err := Bundle(bcfg, "enc", "pkcs"); err != nil {
+		t.Fatalf("bundle: %v", err)
+	}
+	der, _ := os.ReadFile(filepath.Join("certs", "enc", "bundle.p12"))
+	if _, _, _, err := pkcs12.DecodeChain(der, "p12pass"); err != nil {
+		t.Fatalf("decode with file password: %v", err)
+	}
+	bcfg.KeyPass = "wrong"
+	if err := Bundle(bcfg, "enc", "pkcs"); err == nil {
+		t.Fatal("expected decrypt error")
+	}
+}
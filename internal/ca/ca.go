@@ -14,20 +14,54 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"orecert/internal/issue"
+	"orecert/internal/lock"
+	"orecert/internal/password"
+	"orecert/internal/stage"
 )
 
 // Config holds minimal settings for CA generation.
 type Config struct {
-	DefaultAlgo string `mapstructure:"default_algo"`
-	DefaultDays int    `mapstructure:"default_days"`
-	Overwrite   bool   `mapstructure:"overwrite"`
-	CA          struct {
+	issue.Layout `mapstructure:",squash"`
+	DefaultAlgo  string  `mapstructure:"default_algo"`
+	DefaultDays  int     `mapstructure:"default_days"`
+	Overwrite    bool    `mapstructure:"overwrite"`
+	CASubject    Subject `mapstructure:"ca_subject"`
+	CARSABits    int     `mapstructure:"ca_rsa_bits"`
+	CACurve      string  `mapstructure:"ca_curve"`
+	CADays       int     `mapstructure:"ca_days"`
+	CAEncryptKey bool    `mapstructure:"ca_encrypt_key"`
+	CAKeyPass    string  `mapstructure:"ca_key_pass"`
+	// LockTimeout は CA ディレクトリのロックを待つ上限です。0 の場合は lock.DefaultTimeout です。
+	LockTimeout time.Duration `mapstructure:"lock_timeout"`
+	OCSP        struct {
+		URL string `mapstructure:"url"`
+	} `mapstructure:"ocsp"`
+	PKI struct {
+		BaseURL string `mapstructure:"base_url"`
+	} `mapstructure:"pki"`
+	CA struct {
 		Key  string `mapstructure:"key"`
 		Cert string `mapstructure:"cert"`
 	} `mapstructure:"ca"`
 }
 
-var ErrExists = errors.New("ca files exist and overwrite disabled")
+// Subject は CA 証明書の識別名 (DN) 設定です。
+type Subject struct {
+	CN string `mapstructure:"cn"`
+	O  string `mapstructure:"o"`
+	OU string `mapstructure:"ou"`
+	C  string `mapstructure:"c"`
+	ST string `mapstructure:"st"`
+	L  string `mapstructure:"l"`
+}
+
+var (
+	ErrExists           = errors.New("ca files exist and overwrite disabled")
+	ErrUnsupportedBits  = errors.New("unsupported rsa bits")
+	ErrUnsupportedCurve = errors.New("unsupported curve")
+)
 
 // InitCA generates CA key and certificate according to config.
 func InitCA(cfg Config) error {
@@ -37,36 +71,37 @@ func InitCA(cfg Config) error {
 	if cfg.DefaultDays == 0 {
 		cfg.DefaultDays = 825
 	}
+	if cfg.CADays == 0 {
+		cfg.CADays = cfg.DefaultDays
+	}
 	if cfg.CA.Key == "" {
-		cfg.CA.Key = filepath.FromSlash("certs/ca/key.pem")
+		cfg.CA.Key = cfg.CAPath("key.pem")
 	}
 	if cfg.CA.Cert == "" {
-		cfg.CA.Cert = filepath.FromSlash("certs/ca/cert.pem")
+		cfg.CA.Cert = cfg.CAPath("cert.pem")
 	}
 
+	l, err := lock.Dir(filepath.Dir(cfg.CA.Cert), cfg.LockTimeout)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
 	if !cfg.Overwrite {
 		if Exists(cfg.CA.Key) || Exists(cfg.CA.Cert) {
 			return ErrExists
 		}
 	}
 
-	if err := os.MkdirAll(filepath.Dir(cfg.CA.Key), 0755); err != nil {
-		return err
-	}
-	if err := os.MkdirAll(filepath.Dir(cfg.CA.Cert), 0755); err != nil {
-		return err
-	}
-
-	priv, pub, err := GenerateKey(cfg.DefaultAlgo)
+	priv, pub, err := GenerateKeyWith(cfg.DefaultAlgo, cfg.CARSABits, cfg.CACurve)
 	if err != nil {
 		return err
 	}
 
 	tmpl := &x509.Certificate{
 		SerialNumber:          randomSerial(),
-		Subject:               PkixName(),
+		Subject:               SubjectName(cfg.CASubject),
 		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(0, 0, cfg.DefaultDays),
+		NotAfter:              time.Now().AddDate(0, 0, cfg.CADays),
 		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 		BasicConstraintsValid: true,
 		IsCA:                  true,
@@ -77,41 +112,68 @@ func InitCA(cfg Config) error {
 		return err
 	}
 
-	if err := WriteKey(cfg.CA.Key, priv); err != nil {
-		return err
-	}
-
-	if err := os.WriteFile(cfg.CA.Cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0644); err != nil {
+	// 鍵・証明書・空の CRL はまとめて置き換え、対にならない鍵と証明書を残さないようにします。
+	st := stage.New()
+	var keyPEM []byte
+	if cfg.CAEncryptKey {
+		pw, err := password.ResolveNew(cfg.CAKeyPass)
+		if err != nil {
+			return err
+		}
+		keyPEM, err = issue.EncodeEncryptedKey(priv, pw)
+		password.Zero(pw)
+		if err != nil {
+			return err
+		}
+	} else if keyPEM, err = issue.EncodeKey(priv); err != nil {
 		return err
 	}
+	st.Write(cfg.CA.Key, keyPEM, 0600)
+	st.Write(cfg.CA.Cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0644)
 
 	crlPath := filepath.Join(filepath.Dir(cfg.CA.Cert), "crl.pem")
 	if !Exists(crlPath) {
-		if err := os.WriteFile(crlPath, []byte("-----BEGIN X509 CRL-----\n-----END X509 CRL-----\n"), 0644); err != nil {
-			return err
-		}
+		st.Write(crlPath, emptyCRL, 0644)
 	}
-
-	return nil
+	return st.Commit()
 }
 
+// emptyCRL は init-ca 直後の空の CRL です。最初の revoke で署名済みの CRL に置き換わります。
+var emptyCRL = []byte("-----BEGIN X509 CRL-----\n-----END X509 CRL-----\n")
+
 // Exists はファイルの有無を確認します。
 func Exists(p string) bool {
 	_, err := os.Stat(p)
 	return err == nil
 }
 
-// GenerateKey は CA 用の鍵ペアを生成します。
+// GenerateKey は CA 用の鍵ペアを既定の鍵長・曲線で生成します。
 func GenerateKey(algo string) (any, any, error) {
+	return GenerateKeyWith(algo, 0, "")
+}
+
+// GenerateKeyWith は RSA 鍵長と ECDSA 曲線を指定して CA 用の鍵ペアを生成します。
+// bits が 0 の場合は 2048、curve が空の場合は P-256 を用います。
+func GenerateKeyWith(algo string, bits int, curve string) (any, any, error) {
 	switch algo {
 	case "rsa", "":
-		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if bits == 0 {
+			bits = 2048
+		}
+		if bits != 2048 && bits != 3072 && bits != 4096 {
+			return nil, nil, ErrUnsupportedBits
+		}
+		priv, err := rsa.GenerateKey(rand.Reader, bits)
 		if err != nil {
 			return nil, nil, err
 		}
 		return priv, &priv.PublicKey, nil
 	case "ecdsa":
-		priv, err := ecdsa.GenerateKey(EllipticP256(), rand.Reader)
+		c, err := Curve(curve)
+		if err != nil {
+			return nil, nil, err
+		}
+		priv, err := ecdsa.GenerateKey(c, rand.Reader)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -129,26 +191,7 @@ func GenerateKey(algo string) (any, any, error) {
 
 // WriteKey は秘密鍵を PEM 形式で保存します。
 func WriteKey(path string, key any) error {
-	var block *pem.Block
-	switch k := key.(type) {
-	case *rsa.PrivateKey:
-		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}
-	case *ecdsa.PrivateKey:
-		b, err := x509.MarshalECPrivateKey(k)
-		if err != nil {
-			return err
-		}
-		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: b}
-	case ed25519.PrivateKey:
-		b, err := x509.MarshalPKCS8PrivateKey(k)
-		if err != nil {
-			return err
-		}
-		block = &pem.Block{Type: "PRIVATE KEY", Bytes: b}
-	default:
-		return errors.New("unknown key type")
-	}
-	return os.WriteFile(path, pem.EncodeToMemory(block), 0600)
+	return issue.WriteKey(path, key)
 }
 
 func randomSerial() *big.Int {
@@ -156,12 +199,48 @@ func randomSerial() *big.Int {
 	return serial
 }
 
-// PkixName は CA 証明書用の固定 Subject を返します。
+// PkixName は CA 証明書用の既定 Subject を返します。
 func PkixName() pkix.Name {
 	return pkix.Name{CommonName: "orecert root CA"}
 }
 
+// SubjectName は設定から CA 証明書用の Subject を組み立てます。
+// CN が未指定の場合は既定の CN を用います。
+func SubjectName(s Subject) pkix.Name {
+	n := PkixName()
+	if s.CN != "" {
+		n.CommonName = s.CN
+	}
+	n.Organization = nonEmpty(s.O)
+	n.OrganizationalUnit = nonEmpty(s.OU)
+	n.Country = nonEmpty(s.C)
+	n.Province = nonEmpty(s.ST)
+	n.Locality = nonEmpty(s.L)
+	return n
+}
+
+func nonEmpty(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return []string{v}
+}
+
 // EllipticP256 は P-256 曲線を返します。
 func EllipticP256() elliptic.Curve {
 	return elliptic.P256()
 }
+
+// Curve は曲線名 (P-256/P-384/P-521) から楕円曲線を返します。空文字は P-256 です。
+func Curve(name string) (elliptic.Curve, error) {
+	switch name {
+	case "", "P-256":
+		return EllipticP256(), nil
+	case "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	default:
+		return nil, ErrUnsupportedCurve
+	}
+}
@@ -1,12 +1,15 @@
 package ca_test
 
 import (
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"orecert/internal/ca"
 )
@@ -170,3 +173,48 @@ func TestWriteKeyError(t *testing.T) {
 		t.Fatal("expected error")
 	}
 }
+
+func TestInitCA_SubjectAndCurve(t *testing.T) {
+	dir := t.TempDir()
+	cfg := ca.Config{DefaultAlgo: "ecdsa", CACurve: "P-384", CADays: 3650, DefaultDays: 10}
+	cfg.CASubject = ca.Subject{CN: "Team A root CA", O: "Example", OU: "Team A", C: "JP", ST: "Tokyo", L: "Chiyoda"}
+	cfg.CA.Key = filepath.Join(dir, "key.pem")
+	cfg.CA.Cert = filepath.Join(dir, "cert.pem")
+	if err := ca.InitCA(cfg); err != nil {
+		t.Fatalf("init ca: %v", err)
+	}
+	pemBytes, _ := os.ReadFile(cfg.CA.Cert)
+	block, _ := pem.Decode(pemBytes)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "Team A root CA" || cert.Subject.OrganizationalUnit[0] != "Team A" || cert.Subject.Country[0] != "JP" {
+		t.Fatalf("subject mismatch: %s", cert.Subject)
+	}
+	if pub, ok := cert.PublicKey.(*ecdsa.PublicKey); !ok || pub.Curve.Params().Name != "P-384" {
+		t.Fatalf("P-384 expected")
+	}
+	if d := cert.NotAfter.Sub(cert.NotBefore); d < 3649*24*time.Hour {
+		t.Fatalf("ca_days not applied: %v", d)
+	}
+}
+
+func TestGenerateKeyWith(t *testing.T) {
+	priv, _, err := ca.GenerateKeyWith("rsa", 3072, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if priv.(*rsa.PrivateKey).N.BitLen() != 3072 {
+		t.Fatal("3072 bits expected")
+	}
+	if _, _, err := ca.GenerateKeyWith("rsa", 1024, ""); err != ca.ErrUnsupportedBits {
+		t.Fatalf("expected ErrUnsupportedBits, got %v", err)
+	}
+	if _, _, err := ca.GenerateKeyWith("ecdsa", 0, "P-521"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ca.GenerateKeyWith("ecdsa", 0, "P-192"); err != ca.ErrUnsupportedCurve {
+		t.Fatalf("expected ErrUnsupportedCurve, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package ca
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"orecert/internal/issue"
+	"orecert/internal/lock"
+	"orecert/internal/password"
+	"orecert/internal/stage"
+)
+
+var (
+	ErrInvalidName = errors.New("invalid intermediate name")
+	ErrPathLen     = errors.New("path length exceeds parent constraint")
+)
+
+// InitIntermediate は parent (空文字はルート CA) が署名する中間 CA を生成します。
+// pathLen が負の場合はパス長制約を付与しません。
+func InitIntermediate(cfg Config, name, parent string, pathLen int) error {
+	if name == "" || strings.Contains(name, "..") || strings.ContainsAny(name, "/\\") {
+		return ErrInvalidName
+	}
+	if cfg.DefaultAlgo == "" {
+		cfg.DefaultAlgo = "rsa"
+	}
+	if cfg.DefaultDays == 0 {
+		cfg.DefaultDays = 825
+	}
+	if cfg.CADays == 0 {
+		cfg.CADays = cfg.DefaultDays
+	}
+	if cfg.CA.Key == "" {
+		cfg.CA.Key = cfg.CAPath("key.pem")
+	}
+	if cfg.CA.Cert == "" {
+		cfg.CA.Cert = cfg.CAPath("cert.pem")
+	}
+
+	dir := issue.IntermediateDir(cfg.CA.Cert, name)
+	keyPath := filepath.Join(dir, "key.pem")
+	certPath := filepath.Join(dir, "cert.pem")
+	chainPath := filepath.Join(dir, "chain.pem")
+	// 中間 CA はルート CA のディレクトリ配下にあるため、ルート CA のディレクトリをロックします。
+	l, err := lock.Dir(filepath.Dir(cfg.CA.Cert), cfg.LockTimeout)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	if !cfg.Overwrite {
+		if Exists(keyPath) || Exists(certPath) {
+			return ErrExists
+		}
+	}
+
+	iss, err := issue.ResolveIssuer(cfg.CA.Key, cfg.CA.Cert, parent)
+	if err != nil {
+		return err
+	}
+	chain, err := iss.Chain()
+	if err != nil {
+		return err
+	}
+	parentCert := chain[0]
+	pass := password.Cached(cfg.CAKeyPass)
+	parentKey, err := issue.ReadKeyWith(iss.Key, pass)
+	if err != nil {
+		return err
+	}
+	if parentCert.MaxPathLenZero || (parentCert.MaxPathLen > 0 && (pathLen < 0 || pathLen >= parentCert.MaxPathLen)) {
+		return ErrPathLen
+	}
+
+	priv, pub, err := GenerateKeyWith(cfg.DefaultAlgo, cfg.CARSABits, cfg.CACurve)
+	if err != nil {
+		return err
+	}
+
+	subject := SubjectName(cfg.CASubject)
+	subject.CommonName = IntermediateName(name).CommonName
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               subject,
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(0, 0, cfg.CADays),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            pathLen,
+		MaxPathLenZero:        pathLen == 0,
+	}
+	if tmpl.NotAfter.After(parentCert.NotAfter) {
+		tmpl.NotAfter = parentCert.NotAfter
+	}
+	issue.SetDistribution(tmpl, iss, cfg.PKI.BaseURL, cfg.OCSP.URL)
+
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, pub, parentKey)
+	if err != nil {
+		return err
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return err
+	}
+
+	st := stage.New()
+	var keyPEM []byte
+	if cfg.CAEncryptKey {
+		pw, err := pass.Get()
+		if err != nil {
+			return err
+		}
+		keyPEM, err = issue.EncodeEncryptedKey(priv, pw)
+		password.Zero(pw)
+		if err != nil {
+			return err
+		}
+	} else if keyPEM, err = issue.EncodeKey(priv); err != nil {
+		return err
+	}
+	st.Write(keyPath, keyPEM, 0600)
+	st.Write(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0644)
+	st.Write(chainPath, issue.EncodeCerts(append([]*x509.Certificate{cert}, chain...)), 0644)
+
+	crlPath := filepath.Join(dir, "crl.pem")
+	if !Exists(crlPath) {
+		st.Write(crlPath, emptyCRL, 0644)
+	}
+	return st.Commit()
+}
+
+// IntermediateName は中間 CA 証明書用の Subject を返します。
+func IntermediateName(name string) pkix.Name {
+	return pkix.Name{CommonName: "orecert intermediate CA " + name}
+}
@@ -0,0 +1,76 @@
+package ca_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"orecert/internal/ca"
+	"orecert/internal/issue"
+)
+
+func initRoot(t *testing.T, dir string) ca.Config {
+	t.Helper()
+	cfg := ca.Config{}
+	cfg.CA.Key = filepath.Join(dir, "certs", "ca", "key.pem")
+	cfg.CA.Cert = filepath.Join(dir, "certs", "ca", "cert.pem")
+	if err := ca.InitCA(cfg); err != nil {
+		t.Fatalf("init ca: %v", err)
+	}
+	return cfg
+}
+
+func TestInitIntermediate_Chain(t *testing.T) {
+	dir := t.TempDir()
+	cfg := initRoot(t, dir)
+	if err := ca.InitIntermediate(cfg, "issuing", "", 1); err != nil {
+		t.Fatalf("intermediate: %v", err)
+	}
+	if err := ca.InitIntermediate(cfg, "leafca", "issuing", 0); err != nil {
+		t.Fatalf("sub intermediate: %v", err)
+	}
+	chain, err := issue.ReadCerts(filepath.Join(issue.IntermediateDir(cfg.CA.Cert, "leafca"), "chain.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 3 {
+		t.Fatalf("chain length 3 expected: %d", len(chain))
+	}
+	if !chain[0].IsCA || !chain[0].MaxPathLenZero {
+		t.Fatalf("path length 0 expected")
+	}
+	if err := chain[0].CheckSignatureFrom(chain[1]); err != nil {
+		t.Fatalf("signature: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(issue.IntermediateDir(cfg.CA.Cert, "leafca"), "crl.pem")); err != nil {
+		t.Fatalf("crl missing: %v", err)
+	}
+}
+
+func TestInitIntermediate_PathLenExceeded(t *testing.T) {
+	dir := t.TempDir()
+	cfg := initRoot(t, dir)
+	if err := ca.InitIntermediate(cfg, "zero", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.InitIntermediate(cfg, "child", "zero", 0); err != ca.ErrPathLen {
+		t.Fatalf("expected ErrPathLen, got %v", err)
+	}
+}
+
+func TestInitIntermediate_Errors(t *testing.T) {
+	dir := t.TempDir()
+	cfg := initRoot(t, dir)
+	if err := ca.InitIntermediate(cfg, "../bad", "", 0); err != ca.ErrInvalidName {
+		t.Fatalf("expected ErrInvalidName, got %v", err)
+	}
+	if err := ca.InitIntermediate(cfg, "x", "none", 0); err != issue.ErrUnknownIssuer {
+		t.Fatalf("expected ErrUnknownIssuer, got %v", err)
+	}
+	if err := ca.InitIntermediate(cfg, "dup", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.InitIntermediate(cfg, "dup", "", 0); err != ca.ErrExists {
+		t.Fatalf("expected ErrExists, got %v", err)
+	}
+}
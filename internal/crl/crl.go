@@ -0,0 +1,230 @@
+package crl
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"orecert/internal/db"
+	"orecert/internal/issue"
+	"orecert/internal/lock"
+	"orecert/internal/revoke"
+)
+
+// Config は crl 用設定です。
+type Config struct {
+	issue.Layout `mapstructure:",squash"`
+	CAKeyPass    string `mapstructure:"ca_key_pass"`
+	CRLDays      int    `mapstructure:"crl_days"`
+	// LockTimeout は CA ディレクトリのロックを待つ上限です。0 の場合は lock.DefaultTimeout です。
+	LockTimeout time.Duration `mapstructure:"lock_timeout"`
+	CA          struct {
+		Key  string `mapstructure:"key"`
+		Cert string `mapstructure:"cert"`
+	} `mapstructure:"ca"`
+}
+
+// clock は現在時刻を返します。テストで期限切れを再現するために置き換えます。
+var clock = time.Now
+
+var (
+	// ErrInvalidFormat は export の出力形式が不正な場合のエラーです。
+	ErrInvalidFormat = errors.New("invalid crl format")
+	// ErrNotSigned は init-ca 直後の空の CRL を DER で出力しようとした場合のエラーです。
+	ErrNotSigned = errors.New("crl is not signed yet (run crl refresh)")
+)
+
+// Entry は CRL の失効エントリの表示用情報です。
+type Entry struct {
+	Serial         string     `json:"serial"`
+	CN             string     `json:"cn,omitempty"`
+	RevokedAt      time.Time  `json:"revoked_at"`
+	Reason         string     `json:"reason"`
+	InvalidityDate *time.Time `json:"invalidity_date,omitempty"`
+	NotAfter       *time.Time `json:"not_after,omitempty"`
+}
+
+// Info は CRL の表示用情報です。
+type Info struct {
+	Issuer     string    `json:"issuer"`
+	Path       string    `json:"path"`
+	Number     string    `json:"number,omitempty"`
+	ThisUpdate time.Time `json:"this_update"`
+	NextUpdate time.Time `json:"next_update"`
+	Entries    []Entry   `json:"entries"`
+}
+
+// Show は署名 CA issuer (空文字はルート CA) の CRL の内容を返します。
+// 台帳に記録があれば CN と有効期限も補います。
+func Show(cfg Config, issuer string) (Info, error) {
+	setDefaults(&cfg)
+	iss, err := issue.ResolveIssuer(cfg.CA.Key, cfg.CA.Cert, issuer)
+	if err != nil {
+		return Info{}, err
+	}
+	info := Info{Issuer: iss.Name, Path: iss.CRLPath(), Entries: []Entry{}}
+	rl, err := revoke.ReadCRL(iss.CRLPath())
+	if err != nil || rl == nil {
+		return info, err
+	}
+	recs, err := db.Load(db.Path(cfg.CA.Cert))
+	if err != nil {
+		return info, err
+	}
+	if rl.Number != nil {
+		info.Number = rl.Number.String()
+	}
+	info.ThisUpdate = rl.ThisUpdate
+	info.NextUpdate = rl.NextUpdate
+	for _, e := range rl.RevokedCertificateEntries {
+		ent := Entry{
+			Serial:    db.SerialHex(e.SerialNumber),
+			RevokedAt: e.RevocationTime,
+			Reason:    revoke.ReasonString(e.ReasonCode),
+		}
+		if d, ok := revoke.InvalidityDate(e); ok {
+			ent.InvalidityDate = &d
+		}
+		if i, ok := db.Find(recs, ent.Serial); ok {
+			ent.CN = recs[i].CN
+			na := recs[i].NotAfter
+			ent.NotAfter = &na
+		}
+		info.Entries = append(info.Entries, ent)
+	}
+	return info, nil
+}
+
+// Refresh は CRL 番号を進め、ThisUpdate/NextUpdate を更新して再署名します。
+func Refresh(cfg Config, issuer string) error {
+	return rewrite(cfg, issuer, func(e []x509.RevocationListEntry) ([]x509.RevocationListEntry, error) {
+		return e, nil
+	})
+}
+
+// Prune は有効期限切れの証明書のエントリを取り除いて再署名し、削除件数を返します。
+// 有効期限は台帳から参照し、台帳に無いエントリは残します。
+func Prune(cfg Config, issuer string) (int, error) {
+	setDefaults(&cfg)
+	now := clock()
+	removed := 0
+	err := rewrite(cfg, issuer, func(entries []x509.RevocationListEntry) ([]x509.RevocationListEntry, error) {
+		// 台帳は CA のロック内で読み込み、同時に失効した証明書の記録を取りこぼさないようにします。
+		recs, err := db.Load(db.Path(cfg.CA.Cert))
+		if err != nil {
+			return nil, err
+		}
+		var kept []x509.RevocationListEntry
+		for _, e := range entries {
+			if i, ok := db.Find(recs, db.SerialHex(e.SerialNumber)); ok && now.After(recs[i].NotAfter) {
+				removed++
+				continue
+			}
+			kept = append(kept, e)
+		}
+		return kept, nil
+	})
+	return removed, err
+}
+
+// Export は CRL を format (pem|der) で out に書き出します。
+// DER は crl.pem を変換したもので、再署名は行いません (CRL 番号を進めるのは crl refresh です)。
+func Export(cfg Config, issuer, format, out string) error {
+	setDefaults(&cfg)
+	iss, err := issue.ResolveIssuer(cfg.CA.Key, cfg.CA.Cert, issuer)
+	if err != nil {
+		return err
+	}
+	if format != "pem" && format != "" && format != "der" {
+		return ErrInvalidFormat
+	}
+	b, err := os.ReadFile(iss.CRLPath())
+	if err != nil {
+		return err
+	}
+	if format == "der" {
+		blk, _ := pem.Decode(b)
+		if blk == nil {
+			return errors.New("invalid crl pem")
+		}
+		if len(blk.Bytes) == 0 {
+			return ErrNotSigned
+		}
+		b = blk.Bytes
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(out, b, 0644)
+}
+
+// Issuers はルート CA と全中間 CA の名前を返します。ルート CA は空文字です。
+func Issuers(cfg Config) ([]string, error) {
+	setDefaults(&cfg)
+	list, err := issue.Issuers(cfg.CA.Key, cfg.CA.Cert)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, iss := range list {
+		out = append(out, iss.Name)
+	}
+	return out, nil
+}
+
+// rewrite はエントリを edit で加工した CRL を新しい番号で再署名します。
+// edit は CA のロック内で呼び出します。
+func rewrite(cfg Config, issuer string, edit func([]x509.RevocationListEntry) ([]x509.RevocationListEntry, error)) error {
+	setDefaults(&cfg)
+	iss, err := issue.ResolveIssuer(cfg.CA.Key, cfg.CA.Cert, issuer)
+	if err != nil {
+		return err
+	}
+	caCert, err := issue.ReadCert(iss.Cert)
+	if err != nil {
+		return err
+	}
+	signer, err := revoke.Signer(iss, cfg.CAKeyPass)
+	if err != nil {
+		return err
+	}
+	l, err := lock.Dir(filepath.Dir(cfg.CA.Cert), cfg.LockTimeout)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	rl, err := revoke.ReadCRL(iss.CRLPath())
+	if err != nil {
+		return err
+	}
+	var entries []x509.RevocationListEntry
+	number := big.NewInt(1)
+	if rl != nil {
+		entries = rl.RevokedCertificateEntries
+		if rl.Number != nil {
+			number = new(big.Int).Add(rl.Number, big.NewInt(1))
+		}
+	}
+	entries, err = edit(entries)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return revoke.WriteCRL(iss.CRLPath(), caCert, signer, entries, number, now, now.AddDate(0, 0, cfg.CRLDays))
+}
+
+func setDefaults(cfg *Config) {
+	if cfg.CRLDays == 0 {
+		cfg.CRLDays = 30
+	}
+	if cfg.CA.Key == "" {
+		cfg.CA.Key = cfg.CAPath("key.pem")
+	}
+	if cfg.CA.Cert == "" {
+		cfg.CA.Cert = cfg.CAPath("cert.pem")
+	}
+}
@@ -0,0 +1,116 @@
+package crl
+
+import (
+	"bytes"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"orecert/internal/ca"
+	"orecert/internal/issue"
+	"orecert/internal/revoke"
+)
+
+func setup(t *testing.T, cns ...string) Config {
+	t.Helper()
+	dir := t.TempDir()
+	os.Chdir(dir)
+	cfg := Config{}
+	cfg.CA.Key = filepath.Join(dir, "certs", "ca", "key.pem")
+	cfg.CA.Cert = filepath.Join(dir, "certs", "ca", "cert.pem")
+	if err := ca.InitCA(ca.Config{CA: cfg.CA}); err != nil {
+		t.Fatalf("init ca: %v", err)
+	}
+	icfg := issue.Config{}
+	icfg.CA = cfg.CA
+	rcfg := revoke.Config{}
+	rcfg.CA = cfg.CA
+	for _, cn := range cns {
+		if err := issue.Issue(icfg, issue.Profile{CN: cn}, "server"); err != nil {
+			t.Fatal(err)
+		}
+		if err := revoke.Revoke(rcfg, revoke.Profile{CN: cn}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cfg
+}
+
+func TestShowRefresh(t *testing.T) {
+	cfg := setup(t, "a", "b")
+	info, err := Show(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Entries) != 2 || info.Entries[0].CN != "a" || info.Number != "2" {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+	cfg.CRLDays = 7
+	if err := Refresh(cfg, ""); err != nil {
+		t.Fatal(err)
+	}
+	info, _ = Show(cfg, "")
+	if info.Number != "3" || len(info.Entries) != 2 {
+		t.Fatalf("refresh: %+v", info)
+	}
+	if d := time.Until(info.NextUpdate); d > 7*24*time.Hour || d < 6*24*time.Hour {
+		t.Fatalf("next update: %v", info.NextUpdate)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	cfg := setup(t)
+	icfg := issue.Config{}
+	icfg.CA = cfg.CA
+	rcfg := revoke.Config{}
+	rcfg.CA = cfg.CA
+	for _, p := range []issue.Profile{{CN: "old", Days: 1}, {CN: "new", Days: 30}} {
+		if err := issue.Issue(icfg, p, "server"); err != nil {
+			t.Fatal(err)
+		}
+		if err := revoke.Revoke(rcfg, revoke.Profile{CN: p.CN}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// old の期限が切れた 2 日後として整理します。
+	clock = func() time.Time { return time.Now().AddDate(0, 0, 2) }
+	t.Cleanup(func() { clock = time.Now })
+	n, err := Prune(cfg, "")
+	if err != nil || n != 1 {
+		t.Fatalf("prune: %d %v", n, err)
+	}
+	info, _ := Show(cfg, "")
+	if len(info.Entries) != 1 || info.Entries[0].CN != "new" {
+		t.Fatalf("unexpected entries: %+v", info.Entries)
+	}
+}
+
+func TestExport(t *testing.T) {
+	cfg := setup(t, "x")
+	out := filepath.Join("out", "ca.crl")
+	if err := Export(cfg, "", "der", out); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(out)
+	rl, err := x509.ParseRevocationList(b)
+	if err != nil || len(rl.RevokedCertificateEntries) != 1 {
+		t.Fatalf("der export: %v", err)
+	}
+	// 出力は crl.pem と同じ CRL で、再署名しません。
+	cur, _ := revoke.ReadCRL(filepath.Join("certs", "ca", "crl.pem"))
+	if !bytes.Equal(b, cur.Raw) {
+		t.Fatalf("der export re-signed the crl: number %v, crl.pem %v", rl.Number, cur.Number)
+	}
+	if err := Export(cfg, "", "pem", out); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = os.ReadFile(out)
+	if !bytes.HasPrefix(b, []byte("-----BEGIN X509 CRL-----")) {
+		t.Fatalf("pem export")
+	}
+	if err := Export(cfg, "", "txt", out); err != ErrInvalidFormat {
+		t.Fatalf("expected ErrInvalidFormat, got %v", err)
+	}
+}
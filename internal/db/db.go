@@ -0,0 +1,163 @@
+// Package db は発行済み証明書の台帳 (OpenSSL の index.txt 相当) を扱います。
+// 台帳は CA ディレクトリの index.json に保存され、再発行で meta.json が
+// 上書きされた後も過去のシリアルを参照できます。
+package db
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 証明書の状態です。
+const (
+	StatusValid   = "valid"
+	StatusRevoked = "revoked"
+	StatusExpired = "expired"
+)
+
+// ErrNotFound は台帳にシリアルが無い場合のエラーです。
+var ErrNotFound = errors.New("serial not found in database")
+
+// Record は台帳の 1 エントリです。
+type Record struct {
+	Serial      string     `json:"serial"`
+	CN          string     `json:"cn"`
+	SAN         []string   `json:"san,omitempty"`
+	Type        string     `json:"type,omitempty"`
+	Issuer      string     `json:"issuer,omitempty"`
+	NotBefore   time.Time  `json:"not_before"`
+	NotAfter    time.Time  `json:"not_after"`
+	Fingerprint string     `json:"fingerprint_sha256,omitempty"`
+	Status      string     `json:"status"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+}
+
+// State は現在時刻 now における状態を返します。失効していない期限切れは expired です。
+func (r Record) State(now time.Time) string {
+	if r.Status == StatusValid && now.After(r.NotAfter) {
+		return StatusExpired
+	}
+	return r.Status
+}
+
+// Path は CA 証明書パスから台帳ファイルのパスを返します。
+func Path(caCert string) string {
+	return filepath.Join(filepath.Dir(caCert), "index.json")
+}
+
+// SerialHex はシリアル番号を meta.json と同じ大文字 16 進表記にします。
+func SerialHex(n *big.Int) string {
+	return strings.ToUpper(n.Text(16))
+}
+
+// FromCert は証明書から有効状態のレコードを作成します。
+func FromCert(cert *x509.Certificate, typ, issuer string, san []string, fingerprint string) Record {
+	return Record{
+		Serial:      SerialHex(cert.SerialNumber),
+		CN:          cert.Subject.CommonName,
+		SAN:         san,
+		Type:        typ,
+		Issuer:      issuer,
+		NotBefore:   cert.NotBefore.UTC(),
+		NotAfter:    cert.NotAfter.UTC(),
+		Fingerprint: fingerprint,
+		Status:      StatusValid,
+	}
+}
+
+// Load は台帳を読み込みます。ファイルが無い場合は空です。
+func Load(path string) ([]Record, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var recs []Record
+	if err := json.Unmarshal(b, &recs); err != nil {
+		return nil, err
+	}
+	return recs, nil
+}
+
+// Encode は台帳を発行順 (NotBefore 順) に並べた JSON にします。
+// 他のファイルとまとめて stage で反映する場合に使います。
+func Encode(recs []Record) ([]byte, error) {
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].NotBefore.Before(recs[j].NotBefore) })
+	return json.MarshalIndent(recs, "", "  ")
+}
+
+// Find はシリアル (16 進、大文字小文字・先頭 0 を無視) に一致するレコードを返します。
+func Find(recs []Record, serial string) (int, bool) {
+	want := normalize(serial)
+	for i, r := range recs {
+		if normalize(r.Serial) == want {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// Put はレコードを recs に追加します。同じシリアルがあれば置き換えます。
+func Put(recs []Record, rec Record) []Record {
+	if i, ok := Find(recs, rec.Serial); ok {
+		recs[i] = rec
+		return recs
+	}
+	return append(recs, rec)
+}
+
+// Lookup はシリアルに一致するレコードを返します。
+func Lookup(path, serial string) (Record, error) {
+	recs, err := Load(path)
+	if err != nil {
+		return Record{}, err
+	}
+	i, ok := Find(recs, serial)
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return recs[i], nil
+}
+
+// SetRevoked は recs のうちシリアルのレコードを失効状態にします。
+func SetRevoked(recs []Record, serial string, at time.Time, reason string) error {
+	i, ok := Find(recs, serial)
+	if !ok {
+		return ErrNotFound
+	}
+	at = at.UTC()
+	recs[i].Status = StatusRevoked
+	recs[i].RevokedAt = &at
+	recs[i].Reason = reason
+	return nil
+}
+
+// ByCN は CN に一致するレコードを発行順に返します。
+func ByCN(recs []Record, cn string) []Record {
+	var out []Record
+	for _, r := range recs {
+		if r.CN == cn {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func normalize(serial string) string {
+	s := strings.ToUpper(strings.ReplaceAll(serial, ":", ""))
+	s = strings.TrimLeft(s, "0")
+	if s == "" {
+		return "0"
+	}
+	return s
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAddLookupRevoke(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ca", "index.json")
+	now := time.Now()
+	if recs, err := Load(path); err != nil || len(recs) != 0 {
+		t.Fatalf("empty db expected: %v %v", recs, err)
+	}
+	a := Record{Serial: "0A1B", CN: "a", NotBefore: now, NotAfter: now.Add(time.Hour), Status: StatusValid}
+	b := Record{Serial: "FF", CN: "a", NotBefore: now.Add(time.Minute), NotAfter: now.Add(-time.Minute), Status: StatusValid}
+	recs := Put(Put(nil, b), a)
+	if err := SetRevoked(recs, "A1B", now, "keyCompromise"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetRevoked(recs, "1234", now, ""); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	data, err := Encode(recs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	recs, _ = Load(path)
+	if len(recs) != 2 || recs[0].Serial != "0A1B" {
+		t.Fatalf("records should be in issue order: %v", recs)
+	}
+	if len(ByCN(recs, "a")) != 2 {
+		t.Fatal("by cn")
+	}
+	if r, err := Lookup(path, "a:1b"); err != nil || r.Serial != "0A1B" {
+		t.Fatalf("lookup normalized serial: %v %v", r, err)
+	}
+	if _, err := Lookup(path, "1234"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	r, _ := Lookup(path, "A1B")
+	if r.State(now) != StatusRevoked || r.RevokedAt == nil || r.Reason != "keyCompromise" {
+		t.Fatalf("revoked expected: %+v", r)
+	}
+	r, _ = Lookup(path, "FF")
+	if r.State(now) != StatusExpired {
+		t.Fatalf("expired expected: %s", r.State(now))
+	}
+}
@@ -0,0 +1,541 @@
+// Package inspect は証明書・CSR・CRL・秘密鍵・PKCS#12・JKS の内容を表示用に解析します。
+package inspect
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	keystore "github.com/pavlo-v-chernykh/keystore-go/v4"
+	"software.sslmate.com/src/go-pkcs12"
+
+	"orecert/internal/db"
+	"orecert/internal/issue"
+	"orecert/internal/password"
+	"orecert/internal/pkcs8"
+	"orecert/internal/revoke"
+)
+
+// 解析したファイルの種類です。
+const (
+	KindCertificate = "certificate"
+	KindCSR         = "csr"
+	KindCRL         = "crl"
+	KindKey         = "key"
+	KindPKCS12      = "pkcs12"
+	KindJKS         = "jks"
+)
+
+// 出力形式です。
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var (
+	// ErrUnknownFormat はどの形式としても解析できない場合のエラーです。
+	ErrUnknownFormat = errors.New("unknown file format")
+	// ErrInvalidFormat は出力形式が不正な場合のエラーです。
+	ErrInvalidFormat = errors.New("invalid output format")
+)
+
+// jksMagic は JKS ファイルの先頭 4 バイトです。
+const jksMagic = 0xFEEDFEED
+
+// Report は 1 ファイルの解析結果です。
+type Report struct {
+	Path         string `json:"path"`
+	Kind         string `json:"kind"`
+	Encoding     string `json:"encoding"`
+	Certificates []Cert `json:"certificates,omitempty"`
+	CSR          *CSR   `json:"csr,omitempty"`
+	CRL          *CRL   `json:"crl,omitempty"`
+	Keys         []Key  `json:"keys,omitempty"`
+}
+
+// Cert は証明書の表示用情報です。
+type Cert struct {
+	Alias              string      `json:"alias,omitempty"`
+	Subject            string      `json:"subject"`
+	Issuer             string      `json:"issuer"`
+	Serial             string      `json:"serial"`
+	NotBefore          time.Time   `json:"not_before"`
+	NotAfter           time.Time   `json:"not_after"`
+	DaysRemaining      int         `json:"days_remaining"`
+	SAN                []string    `json:"san,omitempty"`
+	PublicKey          string      `json:"public_key"`
+	SignatureAlgorithm string      `json:"signature_algorithm"`
+	IsCA               bool        `json:"is_ca"`
+	KeyUsage           []string    `json:"key_usage,omitempty"`
+	ExtKeyUsage        []string    `json:"ext_key_usage,omitempty"`
+	Extensions         []Extension `json:"extensions,omitempty"`
+	SHA1               string      `json:"fingerprint_sha1"`
+	SHA256             string      `json:"fingerprint_sha256"`
+	SPKIPin            string      `json:"spki_sha256"`
+}
+
+// CSR は CSR の表示用情報です。
+type CSR struct {
+	Subject            string      `json:"subject"`
+	SAN                []string    `json:"san,omitempty"`
+	PublicKey          string      `json:"public_key"`
+	SignatureAlgorithm string      `json:"signature_algorithm"`
+	SignatureValid     bool        `json:"signature_valid"`
+	Extensions         []Extension `json:"extensions,omitempty"`
+	SPKIPin            string      `json:"spki_sha256"`
+}
+
+// CRL は CRL の表示用情報です。
+type CRL struct {
+	Issuer     string     `json:"issuer"`
+	Number     string     `json:"number,omitempty"`
+	ThisUpdate time.Time  `json:"this_update"`
+	NextUpdate time.Time  `json:"next_update"`
+	Entries    []CRLEntry `json:"entries"`
+}
+
+// CRLEntry は CRL の失効エントリです。
+type CRLEntry struct {
+	Serial    string    `json:"serial"`
+	RevokedAt time.Time `json:"revoked_at"`
+	Reason    string    `json:"reason"`
+}
+
+// Key は秘密鍵の表示用情報です。秘密情報は含みません。
+type Key struct {
+	Alias     string `json:"alias,omitempty"`
+	Algorithm string `json:"algorithm"`
+	Encrypted bool   `json:"encrypted"`
+	SPKIPin   string `json:"spki_sha256,omitempty"`
+}
+
+// Extension は証明書拡張の OID と名前です。
+type Extension struct {
+	OID      string `json:"oid"`
+	Name     string `json:"name,omitempty"`
+	Critical bool   `json:"critical"`
+}
+
+// Options は inspect の指定です。
+type Options struct {
+	// Password は PKCS#12・JKS のパスワード指定 (prompt: / file:<path> / 直接文字列) です。
+	Password string
+}
+
+// Resolve は引数がファイルであればそのパスを、それ以外は CN とみなして
+// レイアウト上の cert.pem のパスを返します。
+func Resolve(l issue.Layout, arg string) string {
+	if _, err := os.Stat(arg); err == nil {
+		return arg
+	}
+	if strings.Contains(arg, "..") || strings.ContainsAny(arg, "/\\") {
+		return arg
+	}
+	p, err := l.Paths(arg)
+	if err != nil {
+		return arg
+	}
+	return p.Cert
+}
+
+// File は path の形式を判別して解析します。
+func File(path string, opt Options) (Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Report{}, err
+	}
+	r, err := Bytes(data, opt)
+	r.Path = path
+	return r, err
+}
+
+// Bytes は PEM・DER・PKCS#12・JKS を判別して解析します。
+func Bytes(data []byte, opt Options) (Report, error) {
+	if len(data) >= 4 && binary.BigEndian.Uint32(data) == jksMagic {
+		return inspectJKS(data, opt)
+	}
+	if bytes.Contains(data, []byte("-----BEGIN ")) {
+		return inspectPEM(data)
+	}
+	r := Report{Encoding: "der"}
+	if c, err := x509.ParseCertificate(data); err == nil {
+		r.Kind, r.Certificates = KindCertificate, []Cert{certInfo(c, "")}
+		return r, nil
+	}
+	if c, err := x509.ParseCertificateRequest(data); err == nil {
+		r.Kind, r.CSR = KindCSR, csrInfo(c)
+		return r, nil
+	}
+	if rl, err := x509.ParseRevocationList(data); err == nil {
+		r.Kind, r.CRL = KindCRL, crlInfo(rl)
+		return r, nil
+	}
+	if k, err := x509.ParsePKCS8PrivateKey(data); err == nil {
+		r.Kind, r.Keys = KindKey, []Key{keyInfo(k, "")}
+		return r, nil
+	}
+	if isPKCS12(data) {
+		return inspectPKCS12(data, opt)
+	}
+	return r, ErrUnknownFormat
+}
+
+func inspectPEM(data []byte) (Report, error) {
+	r := Report{Encoding: "pem"}
+	for {
+		var blk *pem.Block
+		blk, data = pem.Decode(data)
+		if blk == nil {
+			break
+		}
+		switch blk.Type {
+		case "CERTIFICATE":
+			c, err := x509.ParseCertificate(blk.Bytes)
+			if err != nil {
+				return r, err
+			}
+			r.Certificates = append(r.Certificates, certInfo(c, ""))
+			setKind(&r, KindCertificate)
+		case "CERTIFICATE REQUEST", "NEW CERTIFICATE REQUEST":
+			c, err := x509.ParseCertificateRequest(blk.Bytes)
+			if err != nil {
+				return r, err
+			}
+			r.CSR = csrInfo(c)
+			setKind(&r, KindCSR)
+		case "X509 CRL":
+			if len(blk.Bytes) == 0 {
+				// init-ca 直後の空 CRL です。
+				r.CRL = &CRL{Entries: []CRLEntry{}}
+			} else {
+				rl, err := x509.ParseRevocationList(blk.Bytes)
+				if err != nil {
+					return r, err
+				}
+				r.CRL = crlInfo(rl)
+			}
+			setKind(&r, KindCRL)
+		case pkcs8.PEMType:
+			r.Keys = append(r.Keys, Key{Algorithm: "unknown", Encrypted: true})
+			setKind(&r, KindKey)
+		case "RSA PRIVATE KEY", "EC PRIVATE KEY", "PRIVATE KEY":
+			var k any
+			var err error
+			switch blk.Type {
+			case "RSA PRIVATE KEY":
+				k, err = x509.ParsePKCS1PrivateKey(blk.Bytes)
+			case "EC PRIVATE KEY":
+				k, err = x509.ParseECPrivateKey(blk.Bytes)
+			default:
+				k, err = x509.ParsePKCS8PrivateKey(blk.Bytes)
+			}
+			if err != nil {
+				return r, err
+			}
+			r.Keys = append(r.Keys, keyInfo(k, ""))
+			setKind(&r, KindKey)
+		}
+	}
+	if r.Kind == "" {
+		return r, ErrUnknownFormat
+	}
+	return r, nil
+}
+
+// setKind は最初に見つかったブロックの種類をファイルの種類とします。
+func setKind(r *Report, kind string) {
+	if r.Kind == "" {
+		r.Kind = kind
+	}
+}
+
+func inspectPKCS12(data []byte, opt Options) (Report, error) {
+	r := Report{Kind: KindPKCS12, Encoding: "der"}
+	pw, err := password.Resolve(opt.Password)
+	if err != nil {
+		return r, err
+	}
+	defer password.Zero(pw)
+	key, cert, chain, err := pkcs12.DecodeChain(data, string(pw))
+	if err != nil {
+		// 鍵を含まないトラストストアの場合です。
+		certs, err2 := pkcs12.DecodeTrustStore(data, string(pw))
+		if err2 != nil {
+			return r, err
+		}
+		for _, c := range certs {
+			r.Certificates = append(r.Certificates, certInfo(c, ""))
+		}
+		return r, nil
+	}
+	r.Keys = []Key{keyInfo(key, "")}
+	r.Certificates = append(r.Certificates, certInfo(cert, ""))
+	for _, c := range chain {
+		r.Certificates = append(r.Certificates, certInfo(c, ""))
+	}
+	return r, nil
+}
+
+func inspectJKS(data []byte, opt Options) (Report, error) {
+	r := Report{Kind: KindJKS, Encoding: "jks"}
+	pw, err := password.Resolve(opt.Password)
+	if err != nil {
+		return r, err
+	}
+	defer password.Zero(pw)
+	ks := keystore.New()
+	if err := ks.Load(bytes.NewReader(data), pw); err != nil {
+		return r, err
+	}
+	for _, alias := range ks.Aliases() {
+		var certs []keystore.Certificate
+		if ks.IsPrivateKeyEntry(alias) {
+			if e, err := ks.GetPrivateKeyEntry(alias, pw); err == nil {
+				if k, err := x509.ParsePKCS8PrivateKey(e.PrivateKey); err == nil {
+					r.Keys = append(r.Keys, keyInfo(k, alias))
+				}
+				certs = e.CertificateChain
+			} else if chain, err := ks.GetPrivateKeyEntryCertificateChain(alias); err == nil {
+				r.Keys = append(r.Keys, Key{Alias: alias, Algorithm: "unknown", Encrypted: true})
+				certs = chain
+			}
+		} else if e, err := ks.GetTrustedCertificateEntry(alias); err == nil {
+			certs = []keystore.Certificate{e.Certificate}
+		}
+		for _, kc := range certs {
+			c, err := x509.ParseCertificate(kc.Content)
+			if err != nil {
+				return r, err
+			}
+			r.Certificates = append(r.Certificates, certInfo(c, alias))
+		}
+	}
+	return r, nil
+}
+
+// isPKCS12 は PFX の外側の構造 (SEQUENCE { INTEGER 3, ... }) かどうかを判定します。
+func isPKCS12(data []byte) bool {
+	var pfx struct {
+		Version  int
+		AuthSafe asn1.RawValue
+		MacData  asn1.RawValue `asn1:"optional"`
+	}
+	_, err := asn1.Unmarshal(data, &pfx)
+	return err == nil && pfx.Version == 3
+}
+
+func certInfo(c *x509.Certificate, alias string) Cert {
+	return Cert{
+		Alias:              alias,
+		Subject:            c.Subject.String(),
+		Issuer:             c.Issuer.String(),
+		Serial:             db.SerialHex(c.SerialNumber),
+		NotBefore:          c.NotBefore,
+		NotAfter:           c.NotAfter,
+		DaysRemaining:      int(time.Until(c.NotAfter).Hours() / 24),
+		SAN:                issue.FormatSAN(c.DNSNames, c.IPAddresses, c.URIs, c.EmailAddresses),
+		PublicKey:          issue.KeyAlgoString(c.PublicKey),
+		SignatureAlgorithm: c.SignatureAlgorithm.String(),
+		IsCA:               c.IsCA,
+		KeyUsage:           issue.KeyUsageNames(c.KeyUsage),
+		ExtKeyUsage:        issue.ExtKeyUsageNames(c.ExtKeyUsage, c.UnknownExtKeyUsage),
+		Extensions:         extensions(c.Extensions),
+		SHA1:               colonHex(sha1Sum(c.Raw)),
+		SHA256:             issue.Fingerprint(c.Raw),
+		SPKIPin:            spkiPin(c.RawSubjectPublicKeyInfo),
+	}
+}
+
+func csrInfo(c *x509.CertificateRequest) *CSR {
+	return &CSR{
+		Subject:            c.Subject.String(),
+		SAN:                issue.FormatSAN(c.DNSNames, c.IPAddresses, c.URIs, c.EmailAddresses),
+		PublicKey:          issue.KeyAlgoString(c.PublicKey),
+		SignatureAlgorithm: c.SignatureAlgorithm.String(),
+		SignatureValid:     c.CheckSignature() == nil,
+		Extensions:         extensions(c.Extensions),
+		SPKIPin:            spkiPin(c.RawSubjectPublicKeyInfo),
+	}
+}
+
+func crlInfo(rl *x509.RevocationList) *CRL {
+	out := &CRL{Issuer: rl.Issuer.String(), ThisUpdate: rl.ThisUpdate, NextUpdate: rl.NextUpdate, Entries: []CRLEntry{}}
+	if rl.Number != nil {
+		out.Number = rl.Number.String()
+	}
+	for _, e := range rl.RevokedCertificateEntries {
+		out.Entries = append(out.Entries, CRLEntry{Serial: db.SerialHex(e.SerialNumber), RevokedAt: e.RevocationTime, Reason: revoke.ReasonString(e.ReasonCode)})
+	}
+	return out
+}
+
+func keyInfo(k any, alias string) Key {
+	out := Key{Alias: alias, Algorithm: "unknown"}
+	if s, ok := k.(crypto.Signer); ok {
+		out.Algorithm = issue.KeyAlgoString(s.Public())
+		if der, err := x509.MarshalPKIXPublicKey(s.Public()); err == nil {
+			out.SPKIPin = spkiPin(der)
+		}
+	}
+	return out
+}
+
+// Write は解析結果を format (text|json) で w に書き出します。
+func Write(w io.Writer, r Report, format string) error {
+	switch format {
+	case FormatText, "":
+		writeText(w, r)
+		return nil
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	default:
+		return ErrInvalidFormat
+	}
+}
+
+func writeText(w io.Writer, r Report) {
+	fmt.Fprintf(w, "File:     %s\n", r.Path)
+	fmt.Fprintf(w, "Kind:     %s (%s)\n", r.Kind, r.Encoding)
+	for i, c := range r.Certificates {
+		fmt.Fprintf(w, "\nCertificate #%d", i+1)
+		if c.Alias != "" {
+			fmt.Fprintf(w, " [%s]", c.Alias)
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "  Subject:        %s\n", c.Subject)
+		fmt.Fprintf(w, "  Issuer:         %s\n", c.Issuer)
+		fmt.Fprintf(w, "  Serial:         %s\n", c.Serial)
+		fmt.Fprintf(w, "  Not Before:     %s\n", c.NotBefore.Format(time.RFC3339))
+		fmt.Fprintf(w, "  Not After:      %s (%d days)\n", c.NotAfter.Format(time.RFC3339), c.DaysRemaining)
+		fmt.Fprintf(w, "  Public Key:     %s\n", c.PublicKey)
+		fmt.Fprintf(w, "  Signature:      %s\n", c.SignatureAlgorithm)
+		fmt.Fprintf(w, "  CA:             %t\n", c.IsCA)
+		writeList(w, "SAN", c.SAN)
+		writeList(w, "Key Usage", c.KeyUsage)
+		writeList(w, "Ext Key Usage", c.ExtKeyUsage)
+		writeExtensions(w, c.Extensions)
+		fmt.Fprintf(w, "  SHA-1:          %s\n", c.SHA1)
+		fmt.Fprintf(w, "  SHA-256:        %s\n", c.SHA256)
+		fmt.Fprintf(w, "  SPKI pin:       sha256/%s\n", c.SPKIPin)
+	}
+	if c := r.CSR; c != nil {
+		fmt.Fprintln(w, "\nCertificate Request")
+		fmt.Fprintf(w, "  Subject:        %s\n", c.Subject)
+		fmt.Fprintf(w, "  Public Key:     %s\n", c.PublicKey)
+		fmt.Fprintf(w, "  Signature:      %s (valid: %t)\n", c.SignatureAlgorithm, c.SignatureValid)
+		writeList(w, "SAN", c.SAN)
+		writeExtensions(w, c.Extensions)
+		fmt.Fprintf(w, "  SPKI pin:       sha256/%s\n", c.SPKIPin)
+	}
+	if c := r.CRL; c != nil {
+		fmt.Fprintln(w, "\nCRL")
+		fmt.Fprintf(w, "  Issuer:         %s\n", c.Issuer)
+		fmt.Fprintf(w, "  Number:         %s\n", c.Number)
+		fmt.Fprintf(w, "  This Update:    %s\n", c.ThisUpdate.Format(time.RFC3339))
+		fmt.Fprintf(w, "  Next Update:    %s\n", c.NextUpdate.Format(time.RFC3339))
+		fmt.Fprintf(w, "  Entries:        %d\n", len(c.Entries))
+		for _, e := range c.Entries {
+			fmt.Fprintf(w, "    %s  %s  %s\n", e.Serial, e.RevokedAt.Format(time.RFC3339), e.Reason)
+		}
+	}
+	for i, k := range r.Keys {
+		fmt.Fprintf(w, "\nPrivate Key #%d", i+1)
+		if k.Alias != "" {
+			fmt.Fprintf(w, " [%s]", k.Alias)
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "  Algorithm:      %s\n", k.Algorithm)
+		fmt.Fprintf(w, "  Encrypted:      %t\n", k.Encrypted)
+		if k.SPKIPin != "" {
+			fmt.Fprintf(w, "  SPKI pin:       sha256/%s\n", k.SPKIPin)
+		}
+	}
+}
+
+func writeList(w io.Writer, label string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "  %-16s%s\n", label+":", strings.Join(items, ", "))
+}
+
+func writeExtensions(w io.Writer, exts []Extension) {
+	if len(exts) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "  Extensions:")
+	for _, e := range exts {
+		name := e.Name
+		if name == "" {
+			name = "-"
+		}
+		crit := ""
+		if e.Critical {
+			crit = " (critical)"
+		}
+		fmt.Fprintf(w, "    %s %s%s\n", e.OID, name, crit)
+	}
+}
+
+// spkiPin は HPKP 形式の SPKI ピン (SHA-256 の base64) を返します。
+func spkiPin(spki []byte) string {
+	sum := sha256.Sum256(spki)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func sha1Sum(b []byte) []byte {
+	sum := sha1.Sum(b)
+	return sum[:]
+}
+
+// colonHex は issue.Fingerprint と同じコロン区切りの大文字 16 進表記です。
+func colonHex(b []byte) string {
+	s := strings.ToUpper(hex.EncodeToString(b))
+	var out strings.Builder
+	for i := 0; i < len(s); i += 2 {
+		if i > 0 {
+			out.WriteString(":")
+		}
+		out.WriteString(s[i : i+2])
+	}
+	return out.String()
+}
+
+func extensions(exts []pkix.Extension) []Extension {
+	var out []Extension
+	for _, e := range exts {
+		out = append(out, Extension{OID: e.Id.String(), Name: extensionNames[e.Id.String()], Critical: e.Critical})
+	}
+	return out
+}
+
+var extensionNames = map[string]string{
+	"2.5.29.14":            "subjectKeyIdentifier",
+	"2.5.29.15":            "keyUsage",
+	"2.5.29.17":            "subjectAltName",
+	"2.5.29.19":            "basicConstraints",
+	"2.5.29.30":            "nameConstraints",
+	"2.5.29.31":            "cRLDistributionPoints",
+	"2.5.29.32":            "certificatePolicies",
+	"2.5.29.35":            "authorityKeyIdentifier",
+	"2.5.29.37":            "extKeyUsage",
+	"1.3.6.1.5.5.7.1.1":    "authorityInfoAccess",
+	"1.3.6.1.5.5.7.48.1.5": "ocspNoCheck",
+}
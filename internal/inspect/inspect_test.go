@@ -0,0 +1,160 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"orecert/internal/bundle"
+	"orecert/internal/ca"
+	"orecert/internal/issue"
+	"orecert/internal/revoke"
+)
+
+func setup(t *testing.T) ca.Config {
+	t.Helper()
+	dir := t.TempDir()
+	os.Chdir(dir)
+	cfg := ca.Config{}
+	cfg.CA.Key = filepath.Join(dir, "certs", "ca", "key.pem")
+	cfg.CA.Cert = filepath.Join(dir, "certs", "ca", "cert.pem")
+	if err := ca.InitCA(cfg); err != nil {
+		t.Fatalf("init ca: %v", err)
+	}
+	icfg := issue.Config{}
+	icfg.CA = cfg.CA
+	if err := issue.Issue(icfg, issue.Profile{CN: "api", Days: 30, SAN: []string{"DNS:api.local", "IP:10.0.0.1"}}, "server"); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestInspect_CertificatePEMAndDER(t *testing.T) {
+	setup(t)
+	r, err := File(Resolve(issue.Layout{}, "api"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Kind != KindCertificate || r.Encoding != "pem" || len(r.Certificates) != 1 {
+		t.Fatalf("unexpected report: %+v", r)
+	}
+	c := r.Certificates[0]
+	if c.Subject != "CN=api" || c.PublicKey != "RSA-2048" || c.IsCA {
+		t.Fatalf("unexpected cert: %+v", c)
+	}
+	if strings.Join(c.SAN, ",") != "DNS:api.local,IP:10.0.0.1" {
+		t.Fatalf("san: %v", c.SAN)
+	}
+	if strings.Join(c.ExtKeyUsage, ",") != "serverAuth" || !contains(c.KeyUsage, "digitalSignature") {
+		t.Fatalf("usage: %v %v", c.KeyUsage, c.ExtKeyUsage)
+	}
+	if len(c.SHA1) != 59 || len(c.SHA256) != 95 || c.SPKIPin == "" {
+		t.Fatalf("fingerprints: %q %q %q", c.SHA1, c.SHA256, c.SPKIPin)
+	}
+
+	b, _ := os.ReadFile(filepath.Join("certs", "api", "cert.pem"))
+	blk, _ := pem.Decode(b)
+	d, err := Bytes(blk.Bytes, Options{})
+	if err != nil || d.Kind != KindCertificate || d.Encoding != "der" || d.Certificates[0].SHA256 != c.SHA256 {
+		t.Fatalf("der: %+v %v", d, err)
+	}
+
+	chain, err := File(filepath.Join("certs", "api", "fullchain.pem"), Options{})
+	if err != nil || len(chain.Certificates) != 2 || !chain.Certificates[1].IsCA {
+		t.Fatalf("chain: %+v %v", chain, err)
+	}
+}
+
+func TestInspect_CSRKeyAndCRL(t *testing.T) {
+	cfg := setup(t)
+	r, err := File(filepath.Join("certs", "api", "csr.pem"), Options{})
+	if err != nil || r.Kind != KindCSR || !r.CSR.SignatureValid || r.CSR.Subject != "CN=api" {
+		t.Fatalf("csr: %+v %v", r, err)
+	}
+	k, err := File(filepath.Join("certs", "api", "key.pem"), Options{})
+	if err != nil || k.Kind != KindKey || k.Keys[0].Algorithm != "RSA-2048" || k.Keys[0].SPKIPin != r.CSR.SPKIPin {
+		t.Fatalf("key: %+v %v", k, err)
+	}
+
+	// init-ca 直後の空 CRL
+	crlPath := filepath.Join("certs", "ca", "crl.pem")
+	e, err := File(crlPath, Options{})
+	if err != nil || e.Kind != KindCRL || len(e.CRL.Entries) != 0 {
+		t.Fatalf("empty crl: %+v %v", e, err)
+	}
+	rcfg := revoke.Config{}
+	rcfg.CA = cfg.CA
+	if err := revoke.RevokeWith(rcfg, revoke.Profile{CN: "api"}, revoke.Options{Reason: "keyCompromise"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{crlPath, revoke.DERPath(crlPath)} {
+		c, err := File(p, Options{})
+		if err != nil || c.Kind != KindCRL || len(c.CRL.Entries) != 1 || c.CRL.Entries[0].Reason != "keyCompromise" || c.CRL.Number != "1" {
+			t.Fatalf("crl %s: %+v %v", p, c, err)
+		}
+	}
+}
+
+func TestInspect_Keystores(t *testing.T) {
+	cfg := setup(t)
+	bcfg := bundle.Config{PKCS12Password: "changeit"}
+	bcfg.CA.Cert = cfg.CA.Cert
+	if err := bundle.Bundle(bcfg, "api", "all"); err != nil {
+		t.Fatal(err)
+	}
+	p, err := File(filepath.Join("certs", "api", "bundle.p12"), Options{Password: "changeit"})
+	if err != nil || p.Kind != KindPKCS12 || len(p.Keys) != 1 || len(p.Certificates) != 2 || p.Certificates[0].Subject != "CN=api" {
+		t.Fatalf("pkcs12: %+v %v", p, err)
+	}
+	if _, err := File(filepath.Join("certs", "api", "bundle.p12"), Options{Password: "wrong"}); err == nil {
+		t.Fatal("expected password error")
+	}
+	j, err := File(filepath.Join("certs", "api", "bundle.jks"), Options{Password: "changeit"})
+	if err != nil || j.Kind != KindJKS || len(j.Keys) != 1 || len(j.Certificates) != 2 || j.Certificates[0].Alias != "orecert" {
+		t.Fatalf("jks: %+v %v", j, err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	setup(t)
+	r, err := File(Resolve(issue.Layout{}, "api"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text bytes.Buffer
+	if err := Write(&text, r, FormatText); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Subject:        CN=api", "SHA-256:", "SPKI pin:       sha256/", "2.5.29.17 subjectAltName"} {
+		if !strings.Contains(text.String(), want) {
+			t.Fatalf("missing %q in:\n%s", want, text.String())
+		}
+	}
+	var js bytes.Buffer
+	if err := Write(&js, r, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	var back Report
+	if err := json.Unmarshal(js.Bytes(), &back); err != nil || back.Certificates[0].SHA256 != r.Certificates[0].SHA256 {
+		t.Fatalf("json: %v %s", err, js.String())
+	}
+	if err := Write(&js, r, "xml"); err != ErrInvalidFormat {
+		t.Fatalf("expected ErrInvalidFormat, got %v", err)
+	}
+	if _, err := Bytes([]byte("garbage"), Options{}); err != ErrUnknownFormat {
+		t.Fatalf("expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
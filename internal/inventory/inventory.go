@@ -0,0 +1,182 @@
+// Package inventory は certs/ 配下の発行済み証明書の一覧を作成します。
+package inventory
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"orecert/internal/db"
+	"orecert/internal/issue"
+)
+
+// Config は inventory 用設定です。
+type Config struct {
+	issue.Layout `mapstructure:",squash"`
+	CA           struct {
+		Key  string `mapstructure:"key"`
+		Cert string `mapstructure:"cert"`
+	} `mapstructure:"ca"`
+}
+
+// 出力形式です。
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+)
+
+// ErrInvalidFormat は出力形式が不正な場合のエラーです。
+var ErrInvalidFormat = errors.New("invalid output format")
+
+// StatusError は meta.json を読めなかった証明書の状態です。理由は Item.Error に入ります。
+const StatusError = "error"
+
+// Item は一覧の 1 行です。
+type Item struct {
+	CN            string    `json:"cn"`
+	Type          string    `json:"type"`
+	Algorithm     string    `json:"algorithm"`
+	Serial        string    `json:"serial"`
+	Issuer        string    `json:"issuer,omitempty"`
+	NotAfter      time.Time `json:"not_after"`
+	DaysRemaining int       `json:"days_remaining"`
+	Status        string    `json:"status"`
+	Reason        string    `json:"reason,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// Filter は一覧の絞り込み条件です。ゼロ値は絞り込みなしです。
+type Filter struct {
+	// Expiring が正の場合、残り有効期間が Expiring 以内のもの (期限切れを含む) に限ります。
+	Expiring time.Duration
+	// Type は種別 (server/client/both) です。
+	Type string
+	// Revoked は失効済みのものに限ります。
+	Revoked bool
+}
+
+// List は certs/<CN>/ の証明書を CN 順に返します。
+// シリアルと有効期限は cert.pem から、種別とアルゴリズムは meta.json から、
+// 失効状態は証明書台帳から求めます。
+// meta.json を読めない CN は一覧を止めず、状態 StatusError の行として返します。
+func List(cfg Config, f Filter) ([]Item, error) {
+	setDefaults(&cfg)
+	icfg := issue.Config{Layout: cfg.Layout}
+	icfg.CA = cfg.CA
+	cns, err := issue.Issued(icfg)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := db.Load(db.Path(cfg.CA.Cert))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	items := []Item{}
+	for _, cn := range cns {
+		paths, err := cfg.Paths(cn)
+		if err != nil {
+			return nil, err
+		}
+		it := Item{CN: cn}
+		meta, err := issue.ReadMeta(paths.Meta)
+		if err != nil {
+			it.Error = err.Error()
+		} else {
+			it.Type, it.Algorithm, it.Serial, it.Issuer, it.NotAfter = meta.Type, meta.Algorithm, meta.Serial, meta.Issuer, meta.NotAfter
+		}
+		if cert, err := issue.ReadCert(paths.Cert); err == nil {
+			it.Serial = db.SerialHex(cert.SerialNumber)
+			it.NotAfter = cert.NotAfter
+			it.Algorithm = issue.KeyAlgoString(cert.PublicKey)
+		}
+		if !it.NotAfter.IsZero() {
+			it.DaysRemaining = int(math.Floor(it.NotAfter.Sub(now).Hours() / 24))
+		}
+		it.Status = db.StatusValid
+		if now.After(it.NotAfter) {
+			it.Status = db.StatusExpired
+		}
+		if i, ok := db.Find(recs, it.Serial); ok {
+			it.Status = recs[i].State(now)
+			it.Reason = recs[i].Reason
+		}
+		if it.Error != "" {
+			it.Status, it.Reason = StatusError, ""
+		}
+		if !f.match(it, now) {
+			continue
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+func (f Filter) match(it Item, now time.Time) bool {
+	if f.Expiring > 0 && it.NotAfter.Sub(now) > f.Expiring {
+		return false
+	}
+	if f.Type != "" && it.Type != f.Type {
+		return false
+	}
+	if f.Revoked && it.Status != db.StatusRevoked {
+		return false
+	}
+	return true
+}
+
+// Write は items を format で w に書き出します。
+func Write(w io.Writer, items []Item, format string) error {
+	switch format {
+	case FormatTable, "":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CN\tTYPE\tALGORITHM\tSERIAL\tEXPIRES\tDAYS\tSTATUS")
+		for _, it := range items {
+			status := it.Status
+			if note := cmp.Or(it.Reason, it.Error); note != "" {
+				status += " (" + note + ")"
+			}
+			expires := "-"
+			if !it.NotAfter.IsZero() {
+				expires = it.NotAfter.Format("2006-01-02")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", it.CN, it.Type, it.Algorithm, it.Serial, expires, it.DaysRemaining, status)
+		}
+		return tw.Flush()
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(items)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"cn", "type", "algorithm", "serial", "issuer", "not_after", "days_remaining", "status", "reason", "error"})
+		for _, it := range items {
+			notAfter := ""
+			if !it.NotAfter.IsZero() {
+				notAfter = it.NotAfter.Format(time.RFC3339)
+			}
+			cw.Write([]string{it.CN, it.Type, it.Algorithm, it.Serial, it.Issuer, notAfter, strconv.Itoa(it.DaysRemaining), it.Status, it.Reason, it.Error})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return ErrInvalidFormat
+	}
+}
+
+func setDefaults(cfg *Config) {
+	if cfg.CA.Key == "" {
+		cfg.CA.Key = cfg.CAPath("key.pem")
+	}
+	if cfg.CA.Cert == "" {
+		cfg.CA.Cert = cfg.CAPath("cert.pem")
+	}
+}
@@ -0,0 +1,132 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"orecert/internal/ca"
+	"orecert/internal/db"
+	"orecert/internal/issue"
+	"orecert/internal/revoke"
+)
+
+func setup(t *testing.T) Config {
+	t.Helper()
+	dir := t.TempDir()
+	os.Chdir(dir)
+	cfg := Config{}
+	cfg.CA.Key = filepath.Join(dir, "certs", "ca", "key.pem")
+	cfg.CA.Cert = filepath.Join(dir, "certs", "ca", "cert.pem")
+	if err := ca.InitCA(ca.Config{CA: cfg.CA}); err != nil {
+		t.Fatalf("init ca: %v", err)
+	}
+	icfg := issue.Config{}
+	icfg.CA = cfg.CA
+	profiles := []struct {
+		prof issue.Profile
+		typ  string
+	}{
+		{issue.Profile{CN: "api", Days: 365}, "server"},
+		{issue.Profile{CN: "bot", Algo: "ed25519", Days: 10}, "client"},
+		{issue.Profile{CN: "old", Days: 365}, "server"},
+	}
+	for _, p := range profiles {
+		if err := issue.Issue(icfg, p.prof, p.typ); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rcfg := revoke.Config{}
+	rcfg.CA = cfg.CA
+	if err := revoke.RevokeWith(rcfg, revoke.Profile{CN: "old"}, revoke.Options{Reason: "superseded"}); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestList_Filters(t *testing.T) {
+	cfg := setup(t)
+	items, err := List(cfg, Filter{})
+	if err != nil || len(items) != 3 {
+		t.Fatalf("list: %v %v", items, err)
+	}
+	if items[0].CN != "api" || items[1].Algorithm != "Ed25519" || items[1].DaysRemaining != 9 {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+	if items[2].Status != db.StatusRevoked || items[2].Reason != "superseded" {
+		t.Fatalf("revocation status: %+v", items[2])
+	}
+
+	tests := []struct {
+		f    Filter
+		want string
+	}{
+		{Filter{Expiring: 30 * 24 * time.Hour}, "bot"},
+		{Filter{Type: "client"}, "bot"},
+		{Filter{Revoked: true}, "old"},
+	}
+	for _, tt := range tests {
+		got, err := List(cfg, tt.f)
+		if err != nil || len(got) != 1 || got[0].CN != tt.want {
+			t.Errorf("%+v: %v %v", tt.f, got, err)
+		}
+	}
+}
+
+// TestList_CorruptMeta は meta.json を読めない CN をエラー行として返し、残りの一覧を続けることを確認します。
+func TestList_CorruptMeta(t *testing.T) {
+	cfg := setup(t)
+	paths, _ := cfg.Paths("bot")
+	os.WriteFile(paths.Meta, []byte("{"), 0644)
+	items, err := List(cfg, Filter{})
+	if err != nil || len(items) != 3 {
+		t.Fatalf("list: %v %v", items, err)
+	}
+	bot := items[1]
+	if bot.CN != "bot" || bot.Status != StatusError || bot.Error == "" || bot.Algorithm != "Ed25519" || bot.DaysRemaining != 9 {
+		t.Fatalf("error row: %+v", bot)
+	}
+	if items[0].Status != db.StatusValid || items[2].Status != db.StatusRevoked {
+		t.Fatalf("other rows: %+v", items)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, items, FormatTable); err != nil || !strings.Contains(buf.String(), "error (") {
+		t.Fatalf("table: %s %v", buf.String(), err)
+	}
+}
+
+func TestWrite_Formats(t *testing.T) {
+	cfg := setup(t)
+	items, _ := List(cfg, Filter{})
+
+	var buf bytes.Buffer
+	if err := Write(&buf, items, FormatTable); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "revoked (superseded)") {
+		t.Fatalf("table: %s", buf.String())
+	}
+
+	buf.Reset()
+	Write(&buf, items, FormatJSON)
+	var decoded []Item
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded) != 3 {
+		t.Fatalf("json: %v", err)
+	}
+
+	buf.Reset()
+	Write(&buf, items, FormatCSV)
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil || len(rows) != 4 || rows[0][0] != "cn" {
+		t.Fatalf("csv: %v %v", rows, err)
+	}
+
+	if err := Write(&buf, items, "xml"); err != ErrInvalidFormat {
+		t.Fatalf("expected ErrInvalidFormat, got %v", err)
+	}
+}
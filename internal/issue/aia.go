@@ -0,0 +1,28 @@
+package issue
+
+import (
+	"crypto/x509"
+	"strings"
+)
+
+// PublicPath は serve pki が署名 CA のファイルを公開する URL パスを返します。
+// ext は ".crt" (DER)、".pem"、".crl" (DER) のいずれかです。
+func (iss Issuer) PublicPath(ext string) string {
+	if iss.Name == "" {
+		return "/ca" + ext
+	}
+	return "/intermediates/" + iss.Name + ext
+}
+
+// SetDistribution は iss が署名する証明書 tmpl に CRL 配布点と AIA (caIssuers, OCSP) を設定します。
+// baseURL が空の場合は CRL 配布点と caIssuers を、ocspURL が空の場合は OCSP を設定しません。
+func SetDistribution(tmpl *x509.Certificate, iss Issuer, baseURL, ocspURL string) {
+	if baseURL != "" {
+		base := strings.TrimSuffix(baseURL, "/")
+		tmpl.CRLDistributionPoints = []string{base + iss.PublicPath(".crl")}
+		tmpl.IssuingCertificateURL = []string{base + iss.PublicPath(".crt")}
+	}
+	if ocspURL != "" {
+		tmpl.OCSPServer = []string{ocspURL}
+	}
+}
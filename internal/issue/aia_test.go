@@ -0,0 +1,57 @@
+package issue_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"orecert/internal/ca"
+	"orecert/internal/issue"
+)
+
+func TestIssue_Distribution(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	ccfg := ca.Config{CA: cfg.CA}
+	ccfg.PKI.BaseURL = "http://pki.test/"
+	ccfg.OCSP.URL = "http://ocsp.test"
+	if err := ca.InitIntermediate(ccfg, "issuing", "", 0); err != nil {
+		t.Fatalf("intermediate: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	cfg.PKI.BaseURL = ccfg.PKI.BaseURL
+	cfg.OCSP.URL = ccfg.OCSP.URL
+	if err := issue.Issue(cfg, issue.Profile{CN: "root-leaf"}, "server"); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Issuer = "issuing"
+	if err := issue.Issue(cfg, issue.Profile{CN: "inter-leaf"}, "server"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		crl, aia string
+	}{
+		{filepath.Join("certs", "root-leaf", "cert.pem"), "http://pki.test/ca.crl", "http://pki.test/ca.crt"},
+		{filepath.Join("certs", "inter-leaf", "cert.pem"), "http://pki.test/intermediates/issuing.crl", "http://pki.test/intermediates/issuing.crt"},
+		{filepath.Join(issue.IntermediateDir(cfg.CA.Cert, "issuing"), "cert.pem"), "http://pki.test/ca.crl", "http://pki.test/ca.crt"},
+	}
+	for _, tt := range tests {
+		cert, err := issue.ReadCert(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cert.CRLDistributionPoints) != 1 || cert.CRLDistributionPoints[0] != tt.crl {
+			t.Errorf("%s: crl dp %v", tt.path, cert.CRLDistributionPoints)
+		}
+		if len(cert.IssuingCertificateURL) != 1 || cert.IssuingCertificateURL[0] != tt.aia {
+			t.Errorf("%s: ca issuers %v", tt.path, cert.IssuingCertificateURL)
+		}
+		if len(cert.OCSPServer) != 1 || cert.OCSPServer[0] != "http://ocsp.test" {
+			t.Errorf("%s: ocsp %v", tt.path, cert.OCSPServer)
+		}
+	}
+}
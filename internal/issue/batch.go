@@ -0,0 +1,79 @@
+package issue
+
+import (
+	"runtime"
+	"sync"
+
+	"orecert/internal/password"
+)
+
+// Job は一括発行の 1 件です。
+type Job struct {
+	// Name は結果の表示に使う名前 (プロファイルのパスなど) です。
+	Name    string
+	Profile Profile
+}
+
+// Result は一括発行の 1 件の結果です。Err が nil の場合は発行に成功しています。
+type Result struct {
+	Job
+	Err error
+}
+
+// IssueAll は jobs を最大 workers 件ずつ並列に発行します。workers が 0 以下の場合は CPU 数です。
+// 署名 CA の鍵は CA ごとに最初の 1 回だけ読み込みます。
+// 失敗した発行があっても残りは続け、結果を jobs と同じ順に返します。
+func IssueAll(cfg Config, jobs []Job, typ string, workers int) []Result {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	cfg.keys = &keyCache{pass: password.Cached(cfg.CAKeyPass)}
+	results := make([]Result, len(jobs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(jobs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = Result{Job: jobs[i], Err: Issue(cfg, jobs[i].Profile, typ)}
+			}
+		}()
+	}
+	for i := range jobs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// keyCache は読み込み済みの CA 鍵をパスごとに保持します。
+type keyCache struct {
+	mu   sync.Mutex
+	pass password.Source
+	keys map[string]any
+}
+
+// caKey は署名 CA の鍵を読み込みます。cfg.keys がある場合は読み込んだ鍵を再利用します。
+func (cfg Config) caKey(path string) (any, error) {
+	c := cfg.keys
+	if c == nil {
+		return ReadKeyWith(path, password.Cached(cfg.CAKeyPass))
+	}
+	// 読み込みとパスワードの問い合わせを 1 回にするため、読み込み中も排他します。
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if k, ok := c.keys[path]; ok {
+		return k, nil
+	}
+	k, err := ReadKeyWith(path, c.pass)
+	if err != nil {
+		return nil, err
+	}
+	if c.keys == nil {
+		c.keys = map[string]any{}
+	}
+	c.keys[path] = k
+	return k, nil
+}
@@ -0,0 +1,50 @@
+package issue_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"orecert/internal/issue"
+)
+
+// TestIssueAll は失敗したプロファイルがあっても残りが発行され、結果が入力順であることを確認します。
+func TestIssueAll(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	jobs := []issue.Job{
+		{Name: "a.yaml", Profile: issue.Profile{CN: "a", SAN: []string{"DNS:a.local"}}},
+		{Name: "bad.yaml", Profile: issue.Profile{CN: "../bad"}},
+		{Name: "b.yaml", Profile: issue.Profile{CN: "b", Algo: "ecdsa"}},
+		{Name: "c.yaml", Profile: issue.Profile{CN: "c", Algo: "ed25519"}},
+	}
+	results := issue.IssueAll(cfg, jobs, "server", 2)
+	if len(results) != len(jobs) {
+		t.Fatalf("results: %d", len(results))
+	}
+	for i, r := range results {
+		if r.Name != jobs[i].Name {
+			t.Errorf("order: %d %s", i, r.Name)
+		}
+		if r.Name == "bad.yaml" {
+			if !errors.Is(r.Err, issue.ErrInvalidCN) {
+				t.Errorf("bad: %v", r.Err)
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Errorf("%s: %v", r.Name, r.Err)
+		}
+		if _, err := os.Stat(filepath.Join("certs", r.Profile.CN, "cert.pem")); err != nil {
+			t.Errorf("%s: cert not created", r.Name)
+		}
+	}
+	cns, err := issue.Issued(cfg)
+	if err != nil || len(cns) != 3 {
+		t.Fatalf("issued: %v %v", cns, err)
+	}
+}
@@ -0,0 +1,147 @@
+package issue
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownIssuer は指定された署名 CA が存在しない場合のエラーです。
+var ErrUnknownIssuer = errors.New("unknown issuer")
+
+// Issuer は証明書に署名する CA の鍵と証明書の所在を表します。
+// Name が空の場合はルート CA を意味します。
+type Issuer struct {
+	Name string
+	Key  string
+	Cert string
+}
+
+// IntermediateDir は中間 CA name の格納ディレクトリを返します。
+func IntermediateDir(caCert, name string) string {
+	return filepath.Join(filepath.Dir(caCert), "intermediates", name)
+}
+
+// ResolveIssuer は名前から署名 CA を解決します。空文字はルート CA です。
+func ResolveIssuer(caKey, caCert, name string) (Issuer, error) {
+	if name == "" {
+		return Issuer{Key: caKey, Cert: caCert}, nil
+	}
+	if strings.Contains(name, "..") || strings.ContainsAny(name, "/\\") {
+		return Issuer{}, ErrUnknownIssuer
+	}
+	dir := IntermediateDir(caCert, name)
+	iss := Issuer{Name: name, Key: filepath.Join(dir, "key.pem"), Cert: filepath.Join(dir, "cert.pem")}
+	if !exists(iss.Cert) {
+		return Issuer{}, ErrUnknownIssuer
+	}
+	return iss, nil
+}
+
+// Issuers はルート CA と全中間 CA を名前順に返します。
+func Issuers(caKey, caCert string) ([]Issuer, error) {
+	out := []Issuer{{Key: caKey, Cert: caCert}}
+	entries, err := os.ReadDir(filepath.Join(filepath.Dir(caCert), "intermediates"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return out, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		iss, err := ResolveIssuer(caKey, caCert, n)
+		if err != nil {
+			continue
+		}
+		out = append(out, iss)
+	}
+	return out, nil
+}
+
+// FindIssuer は cert に署名した CA をルート CA と中間 CA から探します。
+func FindIssuer(caKey, caCert string, cert *x509.Certificate) (Issuer, *x509.Certificate, error) {
+	issuers, err := Issuers(caKey, caCert)
+	if err != nil {
+		return Issuer{}, nil, err
+	}
+	for i, iss := range issuers {
+		c, err := ReadCert(iss.Cert)
+		if err != nil {
+			if i == 0 {
+				return Issuer{}, nil, err
+			}
+			continue
+		}
+		if cert.CheckSignatureFrom(c) == nil {
+			return iss, c, nil
+		}
+	}
+	return Issuer{}, nil, ErrUnknownIssuer
+}
+
+// CRLPath は署名 CA の CRL ファイルパスを返します。
+func (i Issuer) CRLPath() string {
+	return filepath.Join(filepath.Dir(i.Cert), "crl.pem")
+}
+
+// ChainPath は署名 CA からルートまでの証明書を連結したファイルのパスを返します。
+// ルート CA の場合は CA 証明書そのものです。
+func (i Issuer) ChainPath() string {
+	if i.Name == "" {
+		return i.Cert
+	}
+	return filepath.Join(filepath.Dir(i.Cert), "chain.pem")
+}
+
+// Chain は署名 CA からルート CA までの証明書を順に返します。
+func (i Issuer) Chain() ([]*x509.Certificate, error) {
+	return ReadCerts(i.ChainPath())
+}
+
+// ReadCerts は PEM ファイル内の全証明書を読み込みます。
+func ReadCerts(path string) ([]*x509.Certificate, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []*x509.Certificate
+	for {
+		var blk *pem.Block
+		blk, b = pem.Decode(b)
+		if blk == nil {
+			break
+		}
+		if blk.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(blk.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	if len(out) == 0 {
+		return nil, errors.New("failed to decode pem")
+	}
+	return out, nil
+}
+
+// EncodeCerts は証明書を PEM で連結します。
+func EncodeCerts(certs []*x509.Certificate) []byte {
+	var out []byte
+	for _, c := range certs {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	return out
+}
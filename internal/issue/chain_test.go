@@ -0,0 +1,75 @@
+package issue_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"orecert/internal/ca"
+	"orecert/internal/db"
+	"orecert/internal/issue"
+)
+
+func TestIssue_Intermediate(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	if err := ca.InitIntermediate(ca.Config{CA: cfg.CA}, "issuing", "", 0); err != nil {
+		t.Fatalf("intermediate: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Issuer = "issuing"
+	if err := issue.Issue(cfg, issue.Profile{CN: "inter", SAN: []string{"DNS:inter"}}, "server"); err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	chain, err := issue.ReadCerts(filepath.Join("certs", "inter", "fullchain.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 3 {
+		t.Fatalf("fullchain should hold leaf, intermediate and root: %d", len(chain))
+	}
+	iss, _, err := issue.FindIssuer(cfg.CA.Key, cfg.CA.Cert, chain[0])
+	if err != nil || iss.Name != "issuing" {
+		t.Fatalf("find issuer: %v %v", iss, err)
+	}
+}
+
+func TestIssue_UnknownIssuer(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Issuer = "none"
+	if err := issue.Issue(cfg, issue.Profile{CN: "x"}, "server"); err != issue.ErrUnknownIssuer {
+		t.Fatalf("expected ErrUnknownIssuer, got %v", err)
+	}
+}
+
+func TestIssue_RecordsDatabase(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	cfg.Overwrite = true
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	prof := issue.Profile{CN: "db", SAN: []string{"DNS:db"}}
+	for i := 0; i < 2; i++ {
+		if err := issue.Issue(cfg, prof, "server"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recs, err := db.Load(db.Path(cfg.CA.Cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.ByCN(recs, "db")) != 2 {
+		t.Fatalf("both issuances should be recorded: %v", recs)
+	}
+	cert, _ := issue.ReadCert(filepath.Join("certs", "db", "cert.pem"))
+	if _, err := db.Lookup(db.Path(cfg.CA.Cert), db.SerialHex(cert.SerialNumber)); err != nil {
+		t.Fatalf("current serial missing: %v", err)
+	}
+}
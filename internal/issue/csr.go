@@ -0,0 +1,226 @@
+package issue
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"orecert/internal/lock"
+	"orecert/internal/stage"
+)
+
+var (
+	ErrCSRSignature = errors.New("csr signature invalid")
+	ErrSANMode      = errors.New("invalid san mode")
+	// ErrSANMismatch は CSR の SAN とプロファイルの SAN に共通するものが無い場合のエラーです。
+	ErrSANMismatch = errors.New("no csr san allowed by profile")
+)
+
+// SAN の決定方法です。
+const (
+	// SANIntersect は CSR の SAN のうちプロファイルに含まれるものだけを採用します。
+	SANIntersect = "intersect"
+	// SANOverride は CSR の SAN を無視してプロファイルの SAN を採用します。
+	SANOverride = "override"
+)
+
+// ReadCSR は PEM 形式の CSR を読み込みます。
+func ReadCSR(path string) (*x509.CertificateRequest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	blk, _ := pem.Decode(b)
+	if blk == nil {
+		return nil, errors.New("failed to decode pem")
+	}
+	return x509.ParseCertificateRequest(blk.Bytes)
+}
+
+// SignCSR は外部で生成された CSR にプロファイルの規則を適用して署名し、
+// certs/<CN>/ に証明書一式を保存します。秘密鍵は保存しません。
+// プロファイルの CN が空の場合は CSR の CN を、SAN が空の場合は CSR の SAN をそのまま用います。
+func SignCSR(cfg Config, prof Profile, typ string, csr *x509.CertificateRequest, sanMode string) error {
+	if !ValidType(typ) {
+		return ErrInvalidType
+	}
+	if sanMode == "" {
+		sanMode = SANIntersect
+	}
+	if sanMode != SANIntersect && sanMode != SANOverride {
+		return ErrSANMode
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return ErrCSRSignature
+	}
+	cn := prof.CN
+	if cn == "" {
+		cn = csr.Subject.CommonName
+	}
+	if cn == "" || strings.Contains(cn, "..") || strings.ContainsAny(cn, "/\\") {
+		return ErrInvalidCN
+	}
+	subject, err := prof.Subject.Name(cn)
+	if err != nil {
+		return err
+	}
+	SetDefaults(&cfg)
+	days := prof.Days
+	if days == 0 {
+		days = cfg.DefaultDays
+	}
+
+	san := FormatSAN(csr.DNSNames, csr.IPAddresses, csr.URIs, csr.EmailAddresses)
+	if len(prof.SAN) > 0 {
+		if sanMode == SANOverride {
+			san = prof.SAN
+		} else {
+			san = intersect(san, prof.SAN)
+		}
+		// プロファイルの SAN の規則から SAN の無い証明書を発行しないようにします。
+		if len(san) == 0 {
+			return ErrSANMismatch
+		}
+	}
+
+	paths, err := cfg.Paths(cn)
+	if err != nil {
+		return err
+	}
+	l, err := lock.Dir(paths.Dir, cfg.LockTimeout)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	if !cfg.Overwrite && !sameOrigin(paths.Meta, prof.Origin) {
+		for _, p := range []string{paths.Key, paths.CSR, paths.Cert, paths.Fullchain, paths.Meta} {
+			if exists(p) {
+				return ErrExists
+			}
+		}
+	}
+
+	algo := keyAlgo(csr.PublicKey)
+	tmpl := &x509.Certificate{
+		SerialNumber:   randomSerial(),
+		Subject:        subject,
+		NotBefore:      time.Now(),
+		NotAfter:       time.Now().AddDate(0, 0, days),
+		DNSNames:       ParseDNS(san),
+		IPAddresses:    ParseIP(san),
+		URIs:           ParseURI(san),
+		EmailAddresses: ParseEmail(san),
+	}
+	if err := applyUsage(tmpl, typ, algo, prof.KeyUsage, prof.ExtKeyUsage); err != nil {
+		return err
+	}
+
+	certDER, chain, iss, err := signCert(cfg, tmpl, csr.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	st := stage.New()
+	// 以前の issue で生成された鍵が残っていると証明書と対にならないため削除します。
+	st.Remove(paths.Key)
+	stageCSR(st, paths.CSR, csr.Raw)
+	stageCert(st, paths, certDER, chain)
+	meta := map[string]any{
+		"cn":                 cn,
+		"type":               typ,
+		"algorithm":          KeyAlgoString(csr.PublicKey),
+		"fingerprint_sha256": Fingerprint(certDER),
+		"not_before":         tmpl.NotBefore.Format(time.RFC3339),
+		"not_after":          tmpl.NotAfter.Format(time.RFC3339),
+		"san":                san,
+		"serial_hex":         strings.ToUpper(tmpl.SerialNumber.Text(16)),
+		"key_encrypted":      false,
+		"issuer":             iss.Name,
+		"external_key":       true,
+	}
+	if prof.Origin != "" {
+		meta["origin"] = prof.Origin
+	}
+	setUsageMeta(meta, prof.KeyUsage, prof.ExtKeyUsage)
+	setSubjectMeta(meta, prof.Subject, subject)
+	if err := stageMeta(st, paths.Meta, meta); err != nil {
+		return err
+	}
+	return commitRecord(st, cfg, certDER, typ, iss.Name, san)
+}
+
+// sameOrigin は既存の meta.json の発行元が origin であることを返します。origin が空の場合は false です。
+func sameOrigin(metaPath, origin string) bool {
+	if origin == "" {
+		return false
+	}
+	meta, err := ReadMeta(metaPath)
+	return err == nil && meta.Origin == origin
+}
+
+// FormatSAN は SAN をプロファイル形式 (`DNS:` などのプレフィクス付き) に変換します。
+func FormatSAN(dns []string, ips []net.IP, uris []*url.URL, emails []string) []string {
+	var out []string
+	for _, d := range dns {
+		out = append(out, "DNS:"+d)
+	}
+	for _, ip := range ips {
+		out = append(out, "IP:"+ip.String())
+	}
+	for _, u := range uris {
+		out = append(out, "URI:"+u.String())
+	}
+	for _, e := range emails {
+		out = append(out, "EMAIL:"+e)
+	}
+	return out
+}
+
+// KeyAlgoString は公開鍵からアルゴリズム表示名を返します。
+func KeyAlgoString(pub any) string {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return AlgoString("rsa", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + strings.ReplaceAll(k.Curve.Params().Name, "-", "")
+	case ed25519.PublicKey:
+		return AlgoString("ed25519", 0)
+	default:
+		return fmt.Sprintf("%T", pub)
+	}
+}
+
+// keyAlgo は公開鍵から usageByType 用のアルゴリズム名を返します。
+func keyAlgo(pub any) string {
+	switch pub.(type) {
+	case *ecdsa.PublicKey:
+		return "ecdsa"
+	case ed25519.PublicKey:
+		return "ed25519"
+	default:
+		return "rsa"
+	}
+}
+
+// intersect は a のうち b にも含まれる要素を返します。大文字小文字は区別しません。
+func intersect(a, b []string) []string {
+	var out []string
+	for _, x := range a {
+		for _, y := range b {
+			if strings.EqualFold(x, y) {
+				out = append(out, x)
+				break
+			}
+		}
+	}
+	return out
+}
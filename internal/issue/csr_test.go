@@ -0,0 +1,120 @@
+package issue_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"orecert/internal/issue"
+)
+
+func newCSR(t *testing.T, cn string, dns ...string) *x509.CertificateRequest {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: cn},
+		DNSNames: dns,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csr
+}
+
+func TestSignCSR_Intersect(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	csr := newCSR(t, "device", "device.local", "evil.example")
+	prof := issue.Profile{SAN: []string{"DNS:device.local", "DNS:other.local"}, Days: 10}
+	if err := issue.SignCSR(cfg, prof, "client", csr, ""); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	cert, err := issue.ReadCert(filepath.Join("certs", "device", "cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.DNSNames) != 1 || cert.DNSNames[0] != "device.local" {
+		t.Fatalf("intersected san expected: %v", cert.DNSNames)
+	}
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth {
+		t.Fatalf("client eku expected")
+	}
+	if _, err := os.Stat(filepath.Join("certs", "device", "key.pem")); !os.IsNotExist(err) {
+		t.Fatalf("key must not be written")
+	}
+	var meta map[string]any
+	b, _ := os.ReadFile(filepath.Join("certs", "device", "meta.json"))
+	json.Unmarshal(b, &meta)
+	if meta["algorithm"] != "ECDSA-P384" {
+		t.Fatalf("algorithm: %v", meta["algorithm"])
+	}
+}
+
+func TestSignCSR_IntersectEmpty(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	csr := newCSR(t, "device", "evil.example")
+	prof := issue.Profile{SAN: []string{"DNS:device.local"}}
+	if err := issue.SignCSR(cfg, prof, "client", csr, issue.SANIntersect); !errors.Is(err, issue.ErrSANMismatch) {
+		t.Fatalf("expected ErrSANMismatch, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("certs", "device", "cert.pem")); !os.IsNotExist(err) {
+		t.Fatalf("cert must not be written")
+	}
+}
+
+func TestSignCSR_Override(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	csr := newCSR(t, "ignored", "a.local")
+	prof := issue.Profile{CN: "forced", SAN: []string{"DNS:b.local"}}
+	if err := issue.SignCSR(cfg, prof, "server", csr, issue.SANOverride); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	cert, err := issue.ReadCert(filepath.Join("certs", "forced", "cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "forced" || len(cert.DNSNames) != 1 || cert.DNSNames[0] != "b.local" {
+		t.Fatalf("override failed: %s %v", cert.Subject, cert.DNSNames)
+	}
+}
+
+func TestSignCSR_Errors(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	csr := newCSR(t, "bad")
+	if err := issue.SignCSR(cfg, issue.Profile{}, "server", csr, "bogus"); err != issue.ErrSANMode {
+		t.Fatalf("expected ErrSANMode, got %v", err)
+	}
+	if err := issue.SignCSR(cfg, issue.Profile{CN: "../x"}, "server", csr, ""); err != issue.ErrInvalidCN {
+		t.Fatalf("expected ErrInvalidCN, got %v", err)
+	}
+	csr.Signature[0] ^= 0xff
+	if err := issue.SignCSR(cfg, issue.Profile{}, "server", csr, ""); err != issue.ErrCSRSignature {
+		t.Fatalf("expected ErrCSRSignature, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package issue_test
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"orecert/internal/ca"
+	"orecert/internal/issue"
+	"orecert/internal/password"
+	"orecert/internal/pkcs8"
+)
+
+func TestIssue_EncryptKey(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	prof := issue.Profile{CN: "enc", EncryptKey: true, KeyPass: "secret"}
+	if err := issue.Issue(cfg, prof, "server"); err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	keyPath := filepath.Join("certs", "enc", "key.pem")
+	b, _ := os.ReadFile(keyPath)
+	blk, _ := pem.Decode(b)
+	if blk == nil || blk.Type != pkcs8.PEMType {
+		t.Fatalf("encrypted key expected")
+	}
+	pass := password.Func(func() ([]byte, error) { return []byte("secret"), nil })
+	if _, err := issue.ReadKeyWith(keyPath, pass); err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	wrong := password.Func(func() ([]byte, error) { return []byte("wrong"), nil })
+	if _, err := issue.ReadKeyWith(keyPath, wrong); err != pkcs8.ErrDecrypt {
+		t.Fatalf("expected ErrDecrypt, got %v", err)
+	}
+	var meta map[string]any
+	mb, _ := os.ReadFile(filepath.Join("certs", "enc", "meta.json"))
+	json.Unmarshal(mb, &meta)
+	if meta["key_encrypted"] != true {
+		t.Fatalf("key_encrypted should be true: %v", meta["key_encrypted"])
+	}
+}
+
+func TestIssue_EncryptedCAKey(t *testing.T) {
+	dir := t.TempDir()
+	cacfg := ca.Config{CAEncryptKey: true, CAKeyPass: "capass"}
+	cacfg.CA.Key = filepath.Join(dir, "certs", "ca", "key.pem")
+	cacfg.CA.Cert = filepath.Join(dir, "certs", "ca", "cert.pem")
+	if err := ca.InitCA(cacfg); err != nil {
+		t.Fatalf("init ca: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	cfg := issue.Config{CAKeyPass: "capass"}
+	cfg.CA = cacfg.CA
+	if err := issue.Issue(cfg, issue.Profile{CN: "viaenc"}, "server"); err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	cfg.CAKeyPass = "wrong"
+	if err := issue.Issue(cfg, issue.Profile{CN: "wrongpass"}, "server"); err != pkcs8.ErrDecrypt {
+		t.Fatalf("expected ErrDecrypt, got %v", err)
+	}
+}
@@ -21,25 +21,57 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"orecert/internal/db"
+	"orecert/internal/lock"
+	"orecert/internal/password"
+	"orecert/internal/pkcs8"
+	"orecert/internal/stage"
 )
 
 type Config struct {
+	Layout      `mapstructure:",squash"`
 	DefaultAlgo string `mapstructure:"default_algo"`
 	DefaultDays int    `mapstructure:"default_days"`
 	Overwrite   bool   `mapstructure:"overwrite"`
-	CA          struct {
+	Issuer      string `mapstructure:"issuer"`
+	CAKeyPass   string `mapstructure:"ca_key_pass"`
+	// LockTimeout は CN と CA ディレクトリのロックを待つ上限です。0 の場合は lock.DefaultTimeout です。
+	LockTimeout time.Duration `mapstructure:"lock_timeout"`
+	OCSP        struct {
+		URL string `mapstructure:"url"`
+	} `mapstructure:"ocsp"`
+	PKI struct {
+		BaseURL string `mapstructure:"base_url"`
+	} `mapstructure:"pki"`
+	CA struct {
 		Key  string `mapstructure:"key"`
 		Cert string `mapstructure:"cert"`
 	} `mapstructure:"ca"`
+
+	// keys は IssueAll が CA 鍵を共有するためのキャッシュです。
+	keys *keyCache
 }
 
 // Profile はプロファイルYAMLの内容を表します。
 type Profile struct {
-	CN      string   `mapstructure:"cn"`
-	SAN     []string `mapstructure:"san"`
-	Algo    string   `mapstructure:"algo"`
-	RSABits int      `mapstructure:"rsa_bits"`
-	Days    int      `mapstructure:"days"`
+	CN         string   `mapstructure:"cn"`
+	SAN        []string `mapstructure:"san"`
+	Algo       string   `mapstructure:"algo"`
+	RSABits    int      `mapstructure:"rsa_bits" yaml:"rsa_bits"`
+	Days       int      `mapstructure:"days"`
+	EncryptKey bool     `mapstructure:"encrypt_key" yaml:"encrypt_key"`
+	KeyPass    string   `mapstructure:"key_pass" yaml:"key_pass"`
+	// Subject は CN 以外の識別名属性です。出力先ディレクトリは CN のままです。
+	Subject Subject `mapstructure:"subject"`
+	// KeyUsage・ExtKeyUsage は用途 (-t) の既定値を置き換えます。EKU には OID も指定できます。
+	KeyUsage    []string `mapstructure:"key_usage" yaml:"key_usage"`
+	ExtKeyUsage []string `mapstructure:"ext_key_usage" yaml:"ext_key_usage"`
+	// Source はプロファイルのパスです。meta.json の profile に記録し、apply が孤立した証明書の判定に使います。
+	Source string `mapstructure:"-" yaml:"-"`
+	// Origin は発行元 (acme など) です。meta.json の origin に記録し、
+	// overwrite が無効でも同じ発行元の証明書だけは置き換えられるようにします。
+	Origin string `mapstructure:"-" yaml:"-"`
 }
 
 var (
@@ -50,26 +82,19 @@ var (
 
 // Issue は鍵と証明書を生成します。
 func Issue(cfg Config, prof Profile, typ string) error {
-	if typ != "server" && typ != "client" && typ != "both" {
+	if !ValidType(typ) {
 		return ErrInvalidType
 	}
 	if prof.CN == "" || strings.Contains(prof.CN, "..") || strings.ContainsAny(prof.CN, "/\\") {
 		return ErrInvalidCN
 	}
-
-	if cfg.DefaultAlgo == "" {
-		cfg.DefaultAlgo = "rsa"
-	}
-	if cfg.DefaultDays == 0 {
-		cfg.DefaultDays = 825
-	}
-	if cfg.CA.Key == "" {
-		cfg.CA.Key = filepath.FromSlash("certs/ca/key.pem")
-	}
-	if cfg.CA.Cert == "" {
-		cfg.CA.Cert = filepath.FromSlash("certs/ca/cert.pem")
+	subject, err := prof.Subject.Name(prof.CN)
+	if err != nil {
+		return err
 	}
 
+	SetDefaults(&cfg)
+
 	algo := prof.Algo
 	if algo == "" {
 		algo = cfg.DefaultAlgo
@@ -83,18 +108,17 @@ func Issue(cfg Config, prof Profile, typ string) error {
 		bits = 2048
 	}
 
-	if err := os.MkdirAll(filepath.Join("certs", prof.CN), 0755); err != nil {
+	paths, err := cfg.Paths(prof.CN)
+	if err != nil {
 		return err
 	}
-
-	keyPath := filepath.Join("certs", prof.CN, "key.pem")
-	csrPath := filepath.Join("certs", prof.CN, "csr.pem")
-	certPath := filepath.Join("certs", prof.CN, "cert.pem")
-	chainPath := filepath.Join("certs", prof.CN, "fullchain.pem")
-	metaPath := filepath.Join("certs", prof.CN, "meta.json")
-
+	l, err := lock.Dir(paths.Dir, cfg.LockTimeout)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
 	if !cfg.Overwrite {
-		for _, p := range []string{keyPath, csrPath, certPath, chainPath, metaPath} {
+		for _, p := range []string{paths.Key, paths.CSR, paths.Cert, paths.Fullchain, paths.Meta} {
 			if exists(p) {
 				return ErrExists
 			}
@@ -107,7 +131,7 @@ func Issue(cfg Config, prof Profile, typ string) error {
 	}
 
 	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
-		Subject:        pkix.Name{CommonName: prof.CN},
+		Subject:        subject,
 		DNSNames:       ParseDNS(prof.SAN),
 		IPAddresses:    ParseIP(prof.SAN),
 		URIs:           ParseURI(prof.SAN),
@@ -117,18 +141,9 @@ func Issue(cfg Config, prof Profile, typ string) error {
 		return err
 	}
 
-	caCert, err := ReadCert(cfg.CA.Cert)
-	if err != nil {
-		return err
-	}
-	caKey, err := ReadKey(cfg.CA.Key)
-	if err != nil {
-		return err
-	}
-
 	tmpl := &x509.Certificate{
 		SerialNumber:   randomSerial(),
-		Subject:        pkix.Name{CommonName: prof.CN},
+		Subject:        subject,
 		NotBefore:      time.Now(),
 		NotAfter:       time.Now().AddDate(0, 0, days),
 		DNSNames:       ParseDNS(prof.SAN),
@@ -136,26 +151,22 @@ func Issue(cfg Config, prof Profile, typ string) error {
 		URIs:           ParseURI(prof.SAN),
 		EmailAddresses: ParseEmail(prof.SAN),
 	}
-	tmpl.ExtKeyUsage, tmpl.KeyUsage = usageByType(typ, algo)
-
-	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, pub, caKey)
-	if err != nil {
+	if err := applyUsage(tmpl, typ, algo, prof.KeyUsage, prof.ExtKeyUsage); err != nil {
 		return err
 	}
 
-	if err := WriteKey(keyPath, priv); err != nil {
-		return err
-	}
-	if err := os.WriteFile(csrPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}), 0644); err != nil {
-		return err
-	}
-	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0644); err != nil {
+	certDER, chain, iss, err := signCert(cfg, tmpl, pub)
+	if err != nil {
 		return err
 	}
-	full := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw})...)
-	if err := os.WriteFile(chainPath, full, 0644); err != nil {
+
+	// 鍵と証明書が対にならない状態を残さないよう、すべての出力をまとめて置き換えます。
+	st := stage.New()
+	if err := stageKey(st, paths.Key, priv, prof.EncryptKey, prof.KeyPass); err != nil {
 		return err
 	}
+	stageCSR(st, paths.CSR, csrDER)
+	stageCert(st, paths, certDER, chain)
 
 	meta := map[string]any{
 		"cn":                 prof.CN,
@@ -166,34 +177,107 @@ func Issue(cfg Config, prof Profile, typ string) error {
 		"not_after":          tmpl.NotAfter.Format(time.RFC3339),
 		"san":                prof.SAN,
 		"serial_hex":         strings.ToUpper(tmpl.SerialNumber.Text(16)),
-		"key_encrypted":      false,
+		"key_encrypted":      prof.EncryptKey,
+		"issuer":             iss.Name,
 	}
-	metaBytes, err := json.MarshalIndent(meta, "", "  ")
+	if prof.Source != "" {
+		meta["profile"] = prof.Source
+	}
+	setUsageMeta(meta, prof.KeyUsage, prof.ExtKeyUsage)
+	setSubjectMeta(meta, prof.Subject, subject)
+	if err := stageMeta(st, paths.Meta, meta); err != nil {
+		return err
+	}
+	return commitRecord(st, cfg, certDER, typ, iss.Name, prof.SAN)
+}
+
+// SetDefaults は未指定の設定項目に既定値を補完します。
+func SetDefaults(cfg *Config) {
+	if cfg.DefaultAlgo == "" {
+		cfg.DefaultAlgo = "rsa"
+	}
+	if cfg.DefaultDays == 0 {
+		cfg.DefaultDays = 825
+	}
+	if cfg.CA.Key == "" {
+		cfg.CA.Key = cfg.CAPath("key.pem")
+	}
+	if cfg.CA.Cert == "" {
+		cfg.CA.Cert = cfg.CAPath("cert.pem")
+	}
+}
+
+// signCert は cfg.Issuer の CA で tmpl に署名し、証明書 DER と CA 連鎖を返します。
+// 配布先の URL が設定されていれば CRL 配布点と AIA を埋め込みます。
+func signCert(cfg Config, tmpl *x509.Certificate, pub any) ([]byte, []*x509.Certificate, Issuer, error) {
+	iss, err := ResolveIssuer(cfg.CA.Key, cfg.CA.Cert, cfg.Issuer)
+	if err != nil {
+		return nil, nil, Issuer{}, err
+	}
+	SetDistribution(tmpl, iss, cfg.PKI.BaseURL, cfg.OCSP.URL)
+	chain, err := iss.Chain()
+	if err != nil {
+		return nil, nil, Issuer{}, err
+	}
+	caKey, err := cfg.caKey(iss.Key)
+	if err != nil {
+		return nil, nil, Issuer{}, err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, chain[0], pub, caKey)
+	if err != nil {
+		return nil, nil, Issuer{}, err
+	}
+	return der, chain, iss, nil
+}
+
+// stageCert は証明書と fullchain を st に追加します。レイアウトに CA があれば CA 連鎖も保存します。
+func stageCert(st *stage.Stage, p Paths, certDER []byte, chain []*x509.Certificate) {
+	st.Write(p.Cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0644)
+	full := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), EncodeCerts(chain)...)
+	st.Write(p.Fullchain, full, 0644)
+	if p.CA != "" {
+		st.Write(p.CA, EncodeCerts(chain), 0644)
+	}
+}
+
+// stageCSR は CSR を PEM にして st に追加します。
+func stageCSR(st *stage.Stage, path string, csrDER []byte) {
+	st.Write(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}), 0644)
+}
+
+// commitRecord は発行した証明書を台帳に登録し、st とまとめて反映します。
+func commitRecord(st *stage.Stage, cfg Config, certDER []byte, typ, issuer string, san []string) error {
+	cert, err := x509.ParseCertificate(certDER)
 	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(metaPath, metaBytes, 0644); err != nil {
+	// 台帳の読み込みから反映までの間、他のプロセスによる台帳・CRL の更新を止めます。
+	l, err := lock.Dir(filepath.Dir(cfg.CA.Cert), cfg.LockTimeout)
+	if err != nil {
 		return err
 	}
-
-	return nil
+	defer l.Release()
+	path := db.Path(cfg.CA.Cert)
+	recs, err := db.Load(path)
+	if err != nil {
+		return err
+	}
+	b, err := db.Encode(db.Put(recs, db.FromCert(cert, typ, issuer, san, Fingerprint(certDER))))
+	if err != nil {
+		return err
+	}
+	st.Write(path, b, 0644)
+	return st.Commit()
 }
 
-func usageByType(t, algo string) ([]x509.ExtKeyUsage, x509.KeyUsage) {
-	var eku []x509.ExtKeyUsage
-	switch t {
-	case "server":
-		eku = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
-	case "client":
-		eku = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
-	case "both":
-		eku = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
-	}
-	ku := x509.KeyUsageDigitalSignature
-	if algo != "ed25519" && t != "client" {
-		ku |= x509.KeyUsageKeyEncipherment
-	}
-	return eku, ku
+// stageMeta は meta.json を st に追加します。
+func stageMeta(st *stage.Stage, path string, meta map[string]any) error {
+	metaBytes, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	st.Write(path, metaBytes, 0644)
+	return nil
 }
 
 // ParseDNS は SAN から DNS エントリを抽出します。
@@ -272,6 +356,15 @@ func GenerateKey(algo string, bits int) (any, any, error) {
 
 // WriteKey は秘密鍵を PEM 形式で保存します。
 func WriteKey(path string, key any) error {
+	b, err := EncodeKey(key)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0600)
+}
+
+// EncodeKey は秘密鍵を PEM 形式にします。
+func EncodeKey(key any) ([]byte, error) {
 	var block *pem.Block
 	switch k := key.(type) {
 	case *rsa.PrivateKey:
@@ -279,19 +372,51 @@ func WriteKey(path string, key any) error {
 	case *ecdsa.PrivateKey:
 		b, err := x509.MarshalECPrivateKey(k)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: b}
 	case ed25519.PrivateKey:
 		b, err := x509.MarshalPKCS8PrivateKey(k)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		block = &pem.Block{Type: "PRIVATE KEY", Bytes: b}
 	default:
-		return errors.New("unknown key type")
+		return nil, errors.New("unknown key type")
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// EncodeEncryptedKey は秘密鍵を暗号化 PKCS#8 の PEM 形式にします。
+func EncodeEncryptedKey(key any, pass []byte) ([]byte, error) {
+	block, err := pkcs8.EncryptPEM(key, pass)
+	if err != nil {
+		return nil, err
 	}
-	return os.WriteFile(path, pem.EncodeToMemory(block), 0600)
+	return pem.EncodeToMemory(block), nil
+}
+
+// stageKey は秘密鍵を st に追加します。encrypt の場合は pass (prompt: など) でパスワードを決めます。
+func stageKey(st *stage.Stage, path string, key any, encrypt bool, pass string) error {
+	if !encrypt {
+		b, err := EncodeKey(key)
+		if err != nil {
+			return err
+		}
+		st.Write(path, b, 0600)
+		return nil
+	}
+	pw, err := password.ResolveNew(pass)
+	if err != nil {
+		return err
+	}
+	b, err := EncodeEncryptedKey(key, pw)
+	password.Zero(pw)
+	if err != nil {
+		return err
+	}
+	st.Write(path, b, 0600)
+	return nil
 }
 
 // ReadCert は PEM 形式の証明書を読み込みます。
@@ -308,7 +433,15 @@ func ReadCert(path string) (*x509.Certificate, error) {
 }
 
 // ReadKey は PEM 形式の秘密鍵を読み込みます。
+// 暗号化されている場合はパスワード入力を求めます。
 func ReadKey(path string) (any, error) {
+	return ReadKeyWith(path, password.Cached("prompt:"))
+}
+
+// ReadKeyWith は PEM 形式の秘密鍵を読み込みます。
+// 暗号化 PKCS#8 の場合のみ pass からパスワードを取得して復号します。
+// pass が prompt: の場合、誤ったパスワードは MaxAttempts 回まで入力し直せます。
+func ReadKeyWith(path string, pass password.Source) (any, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -318,6 +451,10 @@ func ReadKey(path string) (any, error) {
 		return nil, errors.New("failed to decode pem")
 	}
 	switch blk.Type {
+	case pkcs8.PEMType:
+		return password.WithRetry(pass, pkcs8.ErrDecrypt, func(pw []byte) (any, error) {
+			return pkcs8.Decrypt(blk.Bytes, pw)
+		})
 	case "RSA PRIVATE KEY":
 		return x509.ParsePKCS1PrivateKey(blk.Bytes)
 	case "EC PRIVATE KEY":
@@ -368,3 +505,23 @@ func randomSerial() *big.Int {
 	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
 	return serial
 }
+
+// setUsageMeta はプロファイルで指定された KeyUsage・ExtKeyUsage を meta.json に記録します。
+// renew は記録された値で再発行します。
+func setUsageMeta(meta map[string]any, keyUsage, extKeyUsage []string) {
+	if len(keyUsage) > 0 {
+		meta["key_usage"] = keyUsage
+	}
+	if len(extKeyUsage) > 0 {
+		meta["ext_key_usage"] = extKeyUsage
+	}
+}
+
+// setSubjectMeta はプロファイルで指定された識別名属性と DN 文字列を meta.json に記録します。
+func setSubjectMeta(meta map[string]any, s Subject, name pkix.Name) {
+	if s.IsZero() {
+		return
+	}
+	meta["subject"] = s
+	meta["subject_dn"] = name.String()
+}
@@ -3,7 +3,9 @@ package issue_test
 import (
 	"bytes"
 	"crypto/rand"
+	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -259,3 +261,81 @@ func TestErrorBranches(t *testing.T) {
 		t.Fatal("expected read cert error")
 	}
 }
+
+func TestIssue_CustomUsage(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	prof := issue.Profile{
+		CN:          "signer",
+		Algo:        "ed25519",
+		KeyUsage:    []string{"digitalSignature", "contentCommitment"},
+		ExtKeyUsage: []string{"codeSigning", "1.3.6.1.4.1.311.10.3.13"},
+	}
+	if err := issue.Issue(cfg, prof, issue.TypeCodeSign); err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	cert, err := issue.ReadCert(filepath.Join("certs", "signer", "cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.KeyUsage != x509.KeyUsageDigitalSignature|x509.KeyUsageContentCommitment {
+		t.Fatalf("key usage: %v", cert.KeyUsage)
+	}
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageCodeSigning || len(cert.UnknownExtKeyUsage) != 1 {
+		t.Fatalf("ext key usage: %v %v", cert.ExtKeyUsage, cert.UnknownExtKeyUsage)
+	}
+	meta, err := issue.ReadMeta(filepath.Join("certs", "signer", "meta.json"))
+	if err != nil || meta.Type != issue.TypeCodeSign || len(meta.ExtKeyUsage) != 2 {
+		t.Fatalf("meta: %+v %v", meta, err)
+	}
+
+	// renew は meta.json に記録された用途で再発行します。
+	if _, err := issue.Renew(cfg, "signer", issue.RenewOptions{}); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	renewed, _ := issue.ReadCert(filepath.Join("certs", "signer", "cert.pem"))
+	if renewed.KeyUsage != cert.KeyUsage || len(renewed.UnknownExtKeyUsage) != 1 {
+		t.Fatalf("renewed usage: %v %v", renewed.KeyUsage, renewed.UnknownExtKeyUsage)
+	}
+
+	bad := issue.Profile{CN: "bad", Algo: "ed25519", KeyUsage: []string{"keyEncipherment"}}
+	if err := issue.Issue(cfg, bad, issue.TypeServer); !errors.Is(err, issue.ErrKeyUsage) {
+		t.Fatalf("expected ErrKeyUsage, got %v", err)
+	}
+}
+
+// TestIssue_AtomicOnFailure は途中で失敗した場合に以前の鍵と証明書がそのまま残ることを確認します。
+func TestIssue_AtomicOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	cfg.Overwrite = true
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	prof := issue.Profile{CN: "atomic", SAN: []string{"DNS:atomic.local"}}
+	if err := issue.Issue(cfg, prof, "server"); err != nil {
+		t.Fatal(err)
+	}
+	keyBefore, _ := os.ReadFile(filepath.Join("certs", "atomic", "key.pem"))
+	certBefore, _ := os.ReadFile(filepath.Join("certs", "atomic", "cert.pem"))
+
+	// 台帳を読めなくして最後の段階で失敗させます。
+	index := filepath.Join(dir, "certs", "ca", "index.json")
+	if err := os.Remove(index); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(index, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := issue.Issue(cfg, prof, "server"); err == nil {
+		t.Fatal("expected error")
+	}
+	keyAfter, _ := os.ReadFile(filepath.Join("certs", "atomic", "key.pem"))
+	certAfter, _ := os.ReadFile(filepath.Join("certs", "atomic", "cert.pem"))
+	if !bytes.Equal(keyBefore, keyAfter) || !bytes.Equal(certBefore, certAfter) {
+		t.Fatal("files changed after failed issue")
+	}
+}
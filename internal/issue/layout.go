@@ -0,0 +1,123 @@
+package issue
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// ErrInvalidLayout は出力レイアウトのテンプレートが不正な場合のエラーです。
+var ErrInvalidLayout = errors.New("invalid output layout")
+
+// DefaultCertsDir は certs_dir の既定値です。
+const DefaultCertsDir = "certs"
+
+// Layout は証明書一式の出力先の設定です。各パッケージの Config に squash で埋め込みます。
+type Layout struct {
+	// CertsDir は CA と証明書を置くルートディレクトリです。既定は作業ディレクトリの certs/ です。
+	CertsDir string `mapstructure:"certs_dir"`
+	// Files は CN ごとのディレクトリ名とファイル名のテンプレートです。
+	Files Files `mapstructure:"layout"`
+}
+
+// Files は出力ファイル名のテンプレートです。{{.CN}} で CN を参照できます。
+// Dir は CertsDir からの相対パス、その他は Dir からの相対パスです。
+type Files struct {
+	Dir       string `mapstructure:"dir"`
+	Key       string `mapstructure:"key"`
+	CSR       string `mapstructure:"csr"`
+	Cert      string `mapstructure:"cert"`
+	Fullchain string `mapstructure:"fullchain"`
+	// CA は署名 CA からルートまでの証明書の出力先です。空の場合は出力しません。
+	CA     string `mapstructure:"ca"`
+	Meta   string `mapstructure:"meta"`
+	PKCS12 string `mapstructure:"pkcs12"`
+	JKS    string `mapstructure:"jks"`
+}
+
+// Paths は 1 つの CN の出力ファイルのパスです。CA は未設定の場合空文字です。
+type Paths struct {
+	Dir       string
+	Key       string
+	CSR       string
+	Cert      string
+	Fullchain string
+	CA        string
+	Meta      string
+	PKCS12    string
+	JKS       string
+}
+
+// Root は certs_dir を返します。
+func (l Layout) Root() string {
+	if l.CertsDir == "" {
+		return DefaultCertsDir
+	}
+	return l.CertsDir
+}
+
+// CAPath は certs_dir/ca/ 配下のファイルのパスです。ca.key / ca.cert の既定値に使います。
+func (l Layout) CAPath(name string) string {
+	return filepath.Join(l.Root(), "ca", name)
+}
+
+// Paths は CN の出力ファイルのパスをテンプレートから組み立てます。
+// テンプレートの展開結果が certs_dir や CN のディレクトリの外を指す場合はエラーです。
+func (l Layout) Paths(cn string) (Paths, error) {
+	f := l.Files
+	data := struct{ CN string }{cn}
+	dir, err := render(cmp.Or(f.Dir, "{{.CN}}"), data)
+	if err != nil {
+		return Paths{}, err
+	}
+	p := Paths{Dir: filepath.Join(l.Root(), dir)}
+	for _, t := range []struct {
+		dst  *string
+		tmpl string
+	}{
+		{&p.Key, cmp.Or(f.Key, "key.pem")},
+		{&p.CSR, cmp.Or(f.CSR, "csr.pem")},
+		{&p.Cert, cmp.Or(f.Cert, "cert.pem")},
+		{&p.Fullchain, cmp.Or(f.Fullchain, "fullchain.pem")},
+		{&p.CA, f.CA},
+		{&p.Meta, cmp.Or(f.Meta, "meta.json")},
+		{&p.PKCS12, cmp.Or(f.PKCS12, "bundle.p12")},
+		{&p.JKS, cmp.Or(f.JKS, "bundle.jks")},
+	} {
+		if t.tmpl == "" {
+			continue
+		}
+		name, err := render(t.tmpl, data)
+		if err != nil {
+			return Paths{}, err
+		}
+		*t.dst = filepath.Join(p.Dir, name)
+	}
+	return p, nil
+}
+
+// Custom は既定以外のディレクトリ構成かどうかを返します。
+// 既定の構成では certs_dir 直下のディレクトリ名が CN と一致します。
+func (l Layout) Custom() bool {
+	return l.Files.Dir != "" && l.Files.Dir != "{{.CN}}"
+}
+
+// render はテンプレートを展開し、相対パスとして安全かどうかを検証します。
+func render(tmpl string, data any) (string, error) {
+	t, err := template.New("layout").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidLayout, err)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidLayout, err)
+	}
+	out := filepath.FromSlash(b.String())
+	if !filepath.IsLocal(out) {
+		return "", fmt.Errorf("%w: %q is not a relative path inside certs_dir", ErrInvalidLayout, b.String())
+	}
+	return out, nil
+}
@@ -0,0 +1,85 @@
+package issue_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"orecert/internal/issue"
+)
+
+func TestLayout_DefaultPaths(t *testing.T) {
+	var l issue.Layout
+	p, err := l.Paths("api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Dir != filepath.Join("certs", "api") || p.Cert != filepath.Join("certs", "api", "cert.pem") || p.Key != filepath.Join("certs", "api", "key.pem") {
+		t.Fatalf("unexpected paths: %+v", p)
+	}
+	if p.CA != "" {
+		t.Fatalf("ca should be empty: %q", p.CA)
+	}
+	if l.CAPath("cert.pem") != filepath.Join("certs", "ca", "cert.pem") {
+		t.Fatalf("ca path: %s", l.CAPath("cert.pem"))
+	}
+}
+
+func TestLayout_Invalid(t *testing.T) {
+	for _, f := range []issue.Files{
+		{Dir: "../{{.CN}}"},
+		{Cert: "/etc/{{.CN}}.pem"},
+		{Key: "{{.Name}}.key"},
+		{Cert: "{{.CN"},
+	} {
+		l := issue.Layout{Files: f}
+		if _, err := l.Paths("api"); !errors.Is(err, issue.ErrInvalidLayout) {
+			t.Errorf("%+v: got %v", f, err)
+		}
+	}
+}
+
+// TestIssue_KubernetesLayout は certs_dir と tls.crt/tls.key/ca.crt 形式のレイアウトで発行・更新できることを確認します。
+func TestIssue_KubernetesLayout(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	cfg.CertsDir = filepath.Join(dir, "out")
+	cfg.Files = issue.Files{Dir: "staging/{{.CN}}", Key: "tls.key", Cert: "tls.crt", CA: "ca.crt"}
+
+	if err := issue.Issue(cfg, issue.Profile{CN: "web", SAN: []string{"DNS:web.local"}}, "server"); err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.Join(dir, "out", "staging", "web")
+	for _, name := range []string{"tls.key", "tls.crt", "ca.crt", "fullchain.pem", "meta.json"} {
+		if _, err := os.Stat(filepath.Join(base, name)); err != nil {
+			t.Errorf("%s not created", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "certs", "web")); !os.IsNotExist(err) {
+		t.Fatalf("default dir should not be used: %v", err)
+	}
+
+	cns, err := issue.Issued(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cns) != 1 || cns[0] != "web" {
+		t.Fatalf("issued: %v", cns)
+	}
+
+	renewed, err := issue.Renew(cfg, "web", issue.RenewOptions{})
+	if err != nil || !renewed {
+		t.Fatalf("renew: %v %v", renewed, err)
+	}
+	entries, err := os.ReadDir(filepath.Join(base, "archive"))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("archive: %v %v", entries, err)
+	}
+	if _, err := os.Stat(filepath.Join(base, "archive", entries[0].Name(), "tls.crt")); err != nil {
+		t.Fatalf("archived cert: %v", err)
+	}
+}
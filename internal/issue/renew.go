@@ -0,0 +1,301 @@
+package issue
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"orecert/internal/db"
+	"orecert/internal/lock"
+	"orecert/internal/password"
+	"orecert/internal/stage"
+)
+
+var (
+	ErrNoMeta      = errors.New("meta.json not found")
+	ErrExternalKey = errors.New("key is managed externally; rotate is not possible")
+)
+
+// Meta は meta.json の内容です。
+type Meta struct {
+	CN           string    `json:"cn"`
+	Type         string    `json:"type"`
+	Algorithm    string    `json:"algorithm"`
+	Fingerprint  string    `json:"fingerprint_sha256"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	SAN          []string  `json:"san"`
+	Serial       string    `json:"serial_hex"`
+	KeyEncrypted bool      `json:"key_encrypted"`
+	Issuer       string    `json:"issuer"`
+	ExternalKey  bool      `json:"external_key,omitempty"`
+	KeyUsage     []string  `json:"key_usage,omitempty"`
+	ExtKeyUsage  []string  `json:"ext_key_usage,omitempty"`
+	Subject      Subject   `json:"subject,omitempty"`
+	// Profile は発行に使ったプロファイルのパスです。
+	Profile string `json:"profile,omitempty"`
+	// Origin は発行元 (acme など) です。
+	Origin string `json:"origin,omitempty"`
+}
+
+// ReadMeta は meta.json を読み込みます。
+func ReadMeta(path string) (Meta, error) {
+	var m Meta
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, ErrNoMeta
+		}
+		return m, err
+	}
+	err = json.Unmarshal(b, &m)
+	return m, err
+}
+
+// ParseAlgoString は AlgoString の表示名からアルゴリズム名と RSA 鍵長を返します。
+func ParseAlgoString(s string) (string, int) {
+	switch {
+	case strings.HasPrefix(s, "RSA-"):
+		bits, _ := strconv.Atoi(strings.TrimPrefix(s, "RSA-"))
+		return "rsa", bits
+	case strings.HasPrefix(s, "ECDSA"):
+		return "ecdsa", 0
+	case s == "Ed25519":
+		return "ed25519", 0
+	default:
+		return s, 0
+	}
+}
+
+// RenewOptions は renew の指定です。
+type RenewOptions struct {
+	// RotateKey は新しい鍵を生成します。false の場合は既存の鍵 (外部鍵は csr.pem) を再利用します。
+	RotateKey bool
+	// Within が正の場合、残り有効期間が Within を超える証明書は更新しません。
+	Within time.Duration
+	// KeyPass は暗号化された鍵の読み込み・新しい鍵の暗号化に使うパスワード指定です。
+	KeyPass string
+}
+
+// Renew は CN の meta.json に記録された SAN・種別・アルゴリズム・署名 CA で証明書を再発行します。
+// 以前の証明書一式は CN のディレクトリの archive/<旧シリアル>/ に保存します。
+// opt.Within により更新を見送った場合は false を返します。
+func Renew(cfg Config, cn string, opt RenewOptions) (bool, error) {
+	if cn == "" || strings.Contains(cn, "..") || strings.ContainsAny(cn, "/\\") {
+		return false, ErrInvalidCN
+	}
+	SetDefaults(&cfg)
+	paths, err := cfg.Paths(cn)
+	if err != nil {
+		return false, err
+	}
+	// 存在しない CN のディレクトリをロックのために作らないよう、先に確認します。
+	if !exists(paths.Meta) {
+		return false, ErrNoMeta
+	}
+	l, err := lock.Dir(paths.Dir, cfg.LockTimeout)
+	if err != nil {
+		return false, err
+	}
+	defer l.Release()
+
+	meta, err := ReadMeta(paths.Meta)
+	if err != nil {
+		return false, err
+	}
+	old, err := ReadCert(paths.Cert)
+	if err != nil {
+		return false, err
+	}
+	if opt.Within > 0 && time.Until(old.NotAfter) > opt.Within {
+		return false, nil
+	}
+	if meta.ExternalKey && opt.RotateKey {
+		return false, ErrExternalKey
+	}
+	subject, err := meta.Subject.Name(cn)
+	if err != nil {
+		return false, err
+	}
+
+	// 鍵と CSR を用意します。外部鍵の場合は以前の CSR の公開鍵に署名します。
+	var priv crypto.PrivateKey
+	var pub any
+	var csrDER []byte
+	algo, bits := ParseAlgoString(meta.Algorithm)
+	switch {
+	case meta.ExternalKey:
+		csr, err := ReadCSR(paths.CSR)
+		if err != nil {
+			return false, err
+		}
+		pub, csrDER = csr.PublicKey, csr.Raw
+	case opt.RotateKey:
+		priv, pub, err = GenerateKey(algo, bits)
+		if err != nil {
+			return false, err
+		}
+	default:
+		priv, err = ReadKeyWith(paths.Key, password.Cached(opt.KeyPass))
+		if err != nil {
+			return false, err
+		}
+		signer, ok := priv.(crypto.Signer)
+		if !ok {
+			return false, errors.New("key is not signer")
+		}
+		pub = signer.Public()
+	}
+	if csrDER == nil {
+		csrDER, err = x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject:        subject,
+			DNSNames:       ParseDNS(meta.SAN),
+			IPAddresses:    ParseIP(meta.SAN),
+			URIs:           ParseURI(meta.SAN),
+			EmailAddresses: ParseEmail(meta.SAN),
+		}, priv)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// 以前と同じ有効期間で発行します。
+	validity := old.NotAfter.Sub(old.NotBefore)
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:   randomSerial(),
+		Subject:        subject,
+		NotBefore:      now,
+		NotAfter:       now.Add(validity),
+		DNSNames:       ParseDNS(meta.SAN),
+		IPAddresses:    ParseIP(meta.SAN),
+		URIs:           ParseURI(meta.SAN),
+		EmailAddresses: ParseEmail(meta.SAN),
+	}
+	if err := applyUsage(tmpl, meta.Type, keyAlgo(pub), meta.KeyUsage, meta.ExtKeyUsage); err != nil {
+		return false, err
+	}
+	cfg.Issuer = meta.Issuer
+	certDER, chain, iss, err := signCert(cfg, tmpl, pub)
+	if err != nil {
+		return false, err
+	}
+
+	st := stage.New()
+	if err := stageArchive(st, paths, meta.Serial, opt.RotateKey); err != nil {
+		return false, err
+	}
+	if opt.RotateKey {
+		if err := stageKey(st, paths.Key, priv, meta.KeyEncrypted, opt.KeyPass); err != nil {
+			return false, err
+		}
+	}
+	stageCSR(st, paths.CSR, csrDER)
+	stageCert(st, paths, certDER, chain)
+	m := map[string]any{
+		"cn":                 cn,
+		"type":               meta.Type,
+		"algorithm":          KeyAlgoString(pub),
+		"fingerprint_sha256": Fingerprint(certDER),
+		"not_before":         tmpl.NotBefore.Format(time.RFC3339),
+		"not_after":          tmpl.NotAfter.Format(time.RFC3339),
+		"san":                meta.SAN,
+		"serial_hex":         strings.ToUpper(tmpl.SerialNumber.Text(16)),
+		"key_encrypted":      meta.KeyEncrypted,
+		"issuer":             iss.Name,
+		"renewed_from":       meta.Serial,
+	}
+	if meta.ExternalKey {
+		m["external_key"] = true
+	}
+	if meta.Profile != "" {
+		m["profile"] = meta.Profile
+	}
+	if meta.Origin != "" {
+		m["origin"] = meta.Origin
+	}
+	setUsageMeta(m, meta.KeyUsage, meta.ExtKeyUsage)
+	setSubjectMeta(m, meta.Subject, subject)
+	if err := stageMeta(st, paths.Meta, m); err != nil {
+		return false, err
+	}
+	return true, commitRecord(st, cfg, certDER, meta.Type, iss.Name, meta.SAN)
+}
+
+// Issued は meta.json を持つ CN を名前順に返します。CA ディレクトリは除きます。
+// certs_dir 直下のディレクトリ名に加え、既定以外のレイアウトでは台帳の CN も候補にします。
+func Issued(cfg Config) ([]string, error) {
+	SetDefaults(&cfg)
+	entries, err := os.ReadDir(cfg.Root())
+	if err != nil {
+		return nil, err
+	}
+	caDir, _ := filepath.Abs(filepath.Dir(cfg.CA.Cert))
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if abs, _ := filepath.Abs(filepath.Join(cfg.Root(), e.Name())); abs == caDir {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	if cfg.Custom() {
+		recs, err := db.Load(db.Path(cfg.CA.Cert))
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range recs {
+			names = append(names, r.CN)
+		}
+	}
+	sort.Strings(names)
+	var out []string
+	for i, cn := range names {
+		if cn == "" || (i > 0 && names[i-1] == cn) {
+			continue
+		}
+		if p, err := cfg.Paths(cn); err == nil && exists(p.Meta) {
+			out = append(out, cn)
+		}
+	}
+	return out, nil
+}
+
+// stageArchive は証明書一式を CN のディレクトリの archive/<serial>/ に退避する書き込みを st に追加します。
+// 置き換えと同じ Commit で反映するため、失敗した更新の退避は残りません。
+// withKey が false の場合、鍵は引き続き使うため退避しません。
+func stageArchive(st *stage.Stage, p Paths, serial string, withKey bool) error {
+	if serial == "" {
+		serial = time.Now().UTC().Format("20060102T150405Z")
+	}
+	dst := filepath.Join(p.Dir, "archive", serial)
+	files := []string{p.Cert, p.Fullchain, p.CSR, p.Meta}
+	if withKey {
+		files = append(files, p.Key)
+	}
+	for _, src := range files {
+		b, err := os.ReadFile(src)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		perm := os.FileMode(0644)
+		if src == p.Key {
+			perm = 0600
+		}
+		st.Write(filepath.Join(dst, filepath.Base(src)), b, perm)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package issue_test
+
+import (
+	"bytes"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"orecert/internal/db"
+	"orecert/internal/issue"
+)
+
+func TestRenew_KeepAndRotate(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	prof := issue.Profile{CN: "svc", SAN: []string{"DNS:svc", "IP:10.0.0.1"}, Algo: "ecdsa", Days: 10}
+	if err := issue.Issue(cfg, prof, "both"); err != nil {
+		t.Fatal(err)
+	}
+	old, _ := issue.ReadCert(filepath.Join("certs", "svc", "cert.pem"))
+
+	ok, err := issue.Renew(cfg, "svc", issue.RenewOptions{})
+	if err != nil || !ok {
+		t.Fatalf("renew: %v %v", ok, err)
+	}
+	cur, _ := issue.ReadCert(filepath.Join("certs", "svc", "cert.pem"))
+	if cur.SerialNumber.Cmp(old.SerialNumber) == 0 {
+		t.Fatal("serial not changed")
+	}
+	if !bytes.Equal(cur.RawSubjectPublicKeyInfo, old.RawSubjectPublicKeyInfo) {
+		t.Fatal("key should be kept")
+	}
+	if len(cur.IPAddresses) != 1 || len(cur.DNSNames) != 1 || len(cur.ExtKeyUsage) != 2 {
+		t.Fatalf("san/type not reused: %v %v %v", cur.DNSNames, cur.IPAddresses, cur.ExtKeyUsage)
+	}
+	if d := cur.NotAfter.Sub(cur.NotBefore); d != 10*24*time.Hour {
+		t.Fatalf("validity not reused: %v", d)
+	}
+	archived := filepath.Join("certs", "svc", "archive", db.SerialHex(old.SerialNumber))
+	if _, err := os.Stat(filepath.Join(archived, "cert.pem")); err != nil {
+		t.Fatalf("archive missing: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(archived, "key.pem")); !os.IsNotExist(err) {
+		t.Fatal("kept key should not be archived")
+	}
+
+	if _, err := issue.Renew(cfg, "svc", issue.RenewOptions{RotateKey: true}); err != nil {
+		t.Fatal(err)
+	}
+	rot, _ := issue.ReadCert(filepath.Join("certs", "svc", "cert.pem"))
+	if bytes.Equal(rot.RawSubjectPublicKeyInfo, cur.RawSubjectPublicKeyInfo) {
+		t.Fatal("key should be rotated")
+	}
+	if rot.PublicKeyAlgorithm != x509.ECDSA {
+		t.Fatalf("algorithm not reused: %v", rot.PublicKeyAlgorithm)
+	}
+	meta, err := issue.ReadMeta(filepath.Join("certs", "svc", "meta.json"))
+	if err != nil || meta.Type != "both" || meta.Algorithm != "ECDSA-P256" {
+		t.Fatalf("meta: %+v %v", meta, err)
+	}
+}
+
+func TestRenew_WithinAndTargets(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := issue.Issue(cfg, issue.Profile{CN: "long", Days: 90}, "server"); err != nil {
+		t.Fatal(err)
+	}
+	if err := issue.Issue(cfg, issue.Profile{CN: "short", Days: 5}, "server"); err != nil {
+		t.Fatal(err)
+	}
+	targets, err := issue.Issued(cfg)
+	if err != nil || len(targets) != 2 {
+		t.Fatalf("targets: %v %v", targets, err)
+	}
+	for _, cn := range targets {
+		ok, err := issue.Renew(cfg, cn, issue.RenewOptions{Within: 30 * 24 * time.Hour})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != (cn == "short") {
+			t.Fatalf("%s: renewed=%v", cn, ok)
+		}
+	}
+}
+
+func TestRenew_ExternalKey(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	csr := newCSR(t, "ext", "ext.local")
+	if err := issue.SignCSR(cfg, issue.Profile{}, "server", csr, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issue.Renew(cfg, "ext", issue.RenewOptions{RotateKey: true}); err != issue.ErrExternalKey {
+		t.Fatalf("expected ErrExternalKey, got %v", err)
+	}
+	if _, err := issue.Renew(cfg, "ext", issue.RenewOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	cur, _ := issue.ReadCert(filepath.Join("certs", "ext", "cert.pem"))
+	if !bytes.Equal(cur.RawSubjectPublicKeyInfo, csr.RawSubjectPublicKeyInfo) {
+		t.Fatal("csr key should be reused")
+	}
+}
+
+// TestRenew_ArchiveOnFailure は更新に失敗した場合に退避先が残らないことを確認します。
+func TestRenew_ArchiveOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := issue.Issue(cfg, issue.Profile{CN: "svc"}, "server"); err != nil {
+		t.Fatal(err)
+	}
+	// 台帳を読めなくして反映の直前で失敗させます。
+	index := filepath.Join("certs", "ca", "index.json")
+	os.Remove(index)
+	os.Mkdir(index, 0755)
+	if _, err := issue.Renew(cfg, "svc", issue.RenewOptions{}); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := os.Stat(filepath.Join("certs", "svc", "archive")); !os.IsNotExist(err) {
+		t.Fatalf("archive left behind: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package issue
+
+import (
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidSubject はプロファイルの subject が不正な場合のエラーです。
+var ErrInvalidSubject = errors.New("invalid subject")
+
+// Subject はプロファイルの識別名 (DN) 設定です。CN はプロファイルの cn を用います。
+// Extra には任意の属性を "OID=値" 形式で指定します (例: 2.5.4.12=Engineer)。
+type Subject struct {
+	O            string   `mapstructure:"o" yaml:"o" json:"o,omitempty"`
+	OU           string   `mapstructure:"ou" yaml:"ou" json:"ou,omitempty"`
+	C            string   `mapstructure:"c" yaml:"c" json:"c,omitempty"`
+	ST           string   `mapstructure:"st" yaml:"st" json:"st,omitempty"`
+	L            string   `mapstructure:"l" yaml:"l" json:"l,omitempty"`
+	Street       string   `mapstructure:"street" yaml:"street" json:"street,omitempty"`
+	PostalCode   string   `mapstructure:"postal_code" yaml:"postal_code" json:"postal_code,omitempty"`
+	SerialNumber string   `mapstructure:"serial_number" yaml:"serial_number" json:"serial_number,omitempty"`
+	Extra        []string `mapstructure:"extra" yaml:"extra" json:"extra,omitempty"`
+}
+
+// IsZero は属性が 1 つも指定されていないかどうかを返します。
+func (s Subject) IsZero() bool {
+	return s.O == "" && s.OU == "" && s.C == "" && s.ST == "" && s.L == "" &&
+		s.Street == "" && s.PostalCode == "" && s.SerialNumber == "" && len(s.Extra) == 0
+}
+
+// Name は cn と subject から証明書・CSR の Subject を組み立てます。
+func (s Subject) Name(cn string) (pkix.Name, error) {
+	n := pkix.Name{
+		CommonName:         cn,
+		Organization:       nonEmpty(s.O),
+		OrganizationalUnit: nonEmpty(s.OU),
+		Country:            nonEmpty(s.C),
+		Province:           nonEmpty(s.ST),
+		Locality:           nonEmpty(s.L),
+		StreetAddress:      nonEmpty(s.Street),
+		PostalCode:         nonEmpty(s.PostalCode),
+		SerialNumber:       s.SerialNumber,
+	}
+	if s.C != "" && len(s.C) != 2 {
+		return n, fmt.Errorf("%w: country must be a 2-letter code: %s", ErrInvalidSubject, s.C)
+	}
+	for _, e := range s.Extra {
+		k, v, ok := strings.Cut(e, "=")
+		if !ok || v == "" {
+			return n, fmt.Errorf("%w: %s (want OID=value)", ErrInvalidSubject, e)
+		}
+		oid, err := parseOID(strings.TrimSpace(k))
+		if err != nil {
+			return n, fmt.Errorf("%w: %s", ErrInvalidSubject, e)
+		}
+		n.ExtraNames = append(n.ExtraNames, pkix.AttributeTypeAndValue{Type: oid, Value: v})
+	}
+	return n, nil
+}
+
+func nonEmpty(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return []string{v}
+}
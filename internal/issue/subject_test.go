@@ -0,0 +1,88 @@
+package issue_test
+
+import (
+	"encoding/asn1"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"orecert/internal/issue"
+)
+
+func TestIssue_Subject(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	prof := issue.Profile{
+		CN: "mainframe",
+		Subject: issue.Subject{
+			O:            "Example Corp",
+			OU:           "Payments",
+			C:            "JP",
+			ST:           "Tokyo",
+			L:            "Chiyoda",
+			Street:       "1-1 Marunouchi",
+			PostalCode:   "100-0005",
+			SerialNumber: "EMP-0042",
+			Extra:        []string{"2.5.4.12=Batch Operator"},
+		},
+	}
+	if err := issue.Issue(cfg, prof, "client"); err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	certPath := filepath.Join("certs", "mainframe", "cert.pem")
+	cert, err := issue.ReadCert(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cert.Subject
+	if s.CommonName != "mainframe" || s.Organization[0] != "Example Corp" || s.OrganizationalUnit[0] != "Payments" ||
+		s.Country[0] != "JP" || s.Province[0] != "Tokyo" || s.Locality[0] != "Chiyoda" ||
+		s.StreetAddress[0] != "1-1 Marunouchi" || s.PostalCode[0] != "100-0005" || s.SerialNumber != "EMP-0042" {
+		t.Fatalf("unexpected subject: %v", s)
+	}
+	title := false
+	for _, n := range s.Names {
+		if n.Type.Equal(asn1.ObjectIdentifier{2, 5, 4, 12}) && n.Value == "Batch Operator" {
+			title = true
+		}
+	}
+	if !title {
+		t.Fatalf("extra attribute missing: %v", s.Names)
+	}
+	csr, err := issue.ReadCSR(filepath.Join("certs", "mainframe", "csr.pem"))
+	if err != nil || csr.Subject.String() != s.String() {
+		t.Fatalf("csr subject: %v %v", csr.Subject, err)
+	}
+	meta, err := issue.ReadMeta(filepath.Join("certs", "mainframe", "meta.json"))
+	if err != nil || meta.Subject.OU != "Payments" || len(meta.Subject.Extra) != 1 {
+		t.Fatalf("meta: %+v %v", meta, err)
+	}
+
+	// renew は meta.json の subject で再発行します。
+	if _, err := issue.Renew(cfg, "mainframe", issue.RenewOptions{}); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	renewed, _ := issue.ReadCert(certPath)
+	if renewed.Subject.String() != s.String() {
+		t.Fatalf("renewed subject: %v", renewed.Subject)
+	}
+}
+
+func TestSubject_Invalid(t *testing.T) {
+	for _, s := range []issue.Subject{
+		{C: "Japan"},
+		{Extra: []string{"2.5.4.12"}},
+		{Extra: []string{"title=Engineer"}},
+	} {
+		if _, err := s.Name("x"); !errors.Is(err, issue.ErrInvalidSubject) {
+			t.Errorf("%+v: expected ErrInvalidSubject, got %v", s, err)
+		}
+	}
+	if !(issue.Subject{}).IsZero() || (issue.Subject{O: "x"}).IsZero() {
+		t.Fatal("IsZero")
+	}
+}
@@ -0,0 +1,234 @@
+package issue
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 証明書の用途 (-t) です。
+const (
+	TypeServer    = "server"
+	TypeClient    = "client"
+	TypeBoth      = "both"
+	TypeCodeSign  = "codesign"
+	TypeSMIME     = "smime"
+	TypeTimestamp = "timestamp"
+	TypeOCSP      = "ocsp"
+)
+
+// Types は issue・sign-csr で指定できる用途の一覧です。
+var Types = []string{TypeServer, TypeClient, TypeBoth, TypeCodeSign, TypeSMIME, TypeTimestamp, TypeOCSP}
+
+var (
+	ErrUnknownUsage = errors.New("unknown key usage")
+	ErrKeyUsage     = errors.New("key usage not allowed for key algorithm")
+)
+
+// ValidType は t が用途として指定できるかどうかを返します。
+func ValidType(t string) bool {
+	for _, v := range Types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// keyUsageNames は x509.KeyUsage のビット順の名前です (RFC 5280 4.2.1.3)。
+var keyUsageNames = []string{
+	"digitalSignature",
+	"contentCommitment",
+	"keyEncipherment",
+	"dataEncipherment",
+	"keyAgreement",
+	"keyCertSign",
+	"cRLSign",
+	"encipherOnly",
+	"decipherOnly",
+}
+
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "any",
+	x509.ExtKeyUsageServerAuth:      "serverAuth",
+	x509.ExtKeyUsageClientAuth:      "clientAuth",
+	x509.ExtKeyUsageCodeSigning:     "codeSigning",
+	x509.ExtKeyUsageEmailProtection: "emailProtection",
+	x509.ExtKeyUsageIPSECEndSystem:  "ipsecEndSystem",
+	x509.ExtKeyUsageIPSECTunnel:     "ipsecTunnel",
+	x509.ExtKeyUsageIPSECUser:       "ipsecUser",
+	x509.ExtKeyUsageTimeStamping:    "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:     "OCSPSigning",
+}
+
+// KeyUsageNames は KeyUsage のビットを名前の一覧にします。
+func KeyUsageNames(ku x509.KeyUsage) []string {
+	var out []string
+	for i, name := range keyUsageNames {
+		if ku&(1<<i) != 0 {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// ExtKeyUsageNames は EKU を名前の一覧にします。未知の EKU は OID で表します。
+func ExtKeyUsageNames(eku []x509.ExtKeyUsage, unknown []asn1.ObjectIdentifier) []string {
+	var out []string
+	for _, u := range eku {
+		if name, ok := extKeyUsageNames[u]; ok {
+			out = append(out, name)
+		} else {
+			out = append(out, fmt.Sprintf("eku(%d)", u))
+		}
+	}
+	for _, oid := range unknown {
+		out = append(out, oid.String())
+	}
+	return out
+}
+
+// ParseKeyUsage は KeyUsage の名前 (大文字小文字は区別しません) をビットに変換します。
+// nonRepudiation は contentCommitment の別名です。
+func ParseKeyUsage(names []string) (x509.KeyUsage, error) {
+	var ku x509.KeyUsage
+	for _, n := range names {
+		if strings.EqualFold(n, "nonRepudiation") {
+			n = "contentCommitment"
+		}
+		found := false
+		for i, name := range keyUsageNames {
+			if strings.EqualFold(n, name) {
+				ku |= 1 << i
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("%w: %s", ErrUnknownUsage, n)
+		}
+	}
+	return ku, nil
+}
+
+// ParseExtKeyUsage は EKU の名前または OID (1.3.6.1.5.5.7.3.x など) を変換します。
+// Go が名前を持たない OID は UnknownExtKeyUsage として返します。
+func ParseExtKeyUsage(names []string) ([]x509.ExtKeyUsage, []asn1.ObjectIdentifier, error) {
+	var eku []x509.ExtKeyUsage
+	var unknown []asn1.ObjectIdentifier
+next:
+	for _, n := range names {
+		for u, name := range extKeyUsageNames {
+			if strings.EqualFold(n, name) {
+				eku = append(eku, u)
+				continue next
+			}
+		}
+		oid, err := parseOID(n)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %s", ErrUnknownUsage, n)
+		}
+		unknown = append(unknown, oid)
+	}
+	return eku, unknown, nil
+}
+
+// parseOID はドット区切りの OID を解析します。
+func parseOID(s string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return nil, errors.New("invalid oid")
+	}
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, errors.New("invalid oid")
+		}
+		oid[i] = n
+	}
+	if oid[0] > 2 || (oid[0] < 2 && oid[1] > 39) {
+		return nil, errors.New("invalid oid")
+	}
+	return oid, nil
+}
+
+func usageByType(t, algo string) ([]x509.ExtKeyUsage, x509.KeyUsage) {
+	var eku []x509.ExtKeyUsage
+	switch t {
+	case TypeServer:
+		eku = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	case TypeClient:
+		eku = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	case TypeBoth:
+		eku = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	case TypeCodeSign:
+		eku = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+	case TypeSMIME:
+		eku = []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}
+	case TypeTimestamp:
+		eku = []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}
+	case TypeOCSP:
+		eku = []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning}
+	}
+	ku := x509.KeyUsageDigitalSignature
+	switch {
+	case algo == "ed25519":
+		// Ed25519 は署名専用です。
+	case t == TypeServer || t == TypeBoth:
+		ku |= x509.KeyUsageKeyEncipherment
+	case t == TypeSMIME && algo == "rsa":
+		ku |= x509.KeyUsageKeyEncipherment
+	case t == TypeSMIME && algo == "ecdsa":
+		ku |= x509.KeyUsageKeyAgreement
+	}
+	return eku, ku
+}
+
+// applyUsage は用途 t の既定値に、プロファイルで指定された key_usage / ext_key_usage を
+// 上書きして tmpl に設定します。鍵アルゴリズムに適さない組み合わせはエラーです。
+func applyUsage(tmpl *x509.Certificate, t, algo string, keyUsage, extKeyUsage []string) error {
+	tmpl.ExtKeyUsage, tmpl.KeyUsage = usageByType(t, algo)
+	if len(keyUsage) > 0 {
+		ku, err := ParseKeyUsage(keyUsage)
+		if err != nil {
+			return err
+		}
+		if err := checkKeyUsage(ku, algo); err != nil {
+			return err
+		}
+		tmpl.KeyUsage = ku
+	}
+	if len(extKeyUsage) > 0 {
+		eku, unknown, err := ParseExtKeyUsage(extKeyUsage)
+		if err != nil {
+			return err
+		}
+		tmpl.ExtKeyUsage, tmpl.UnknownExtKeyUsage = eku, unknown
+	}
+	return nil
+}
+
+// checkKeyUsage は鍵アルゴリズムと KeyUsage の組み合わせを検証します。
+// CA 用の keyCertSign / cRLSign はリーフ証明書には指定できません。
+func checkKeyUsage(ku x509.KeyUsage, algo string) error {
+	var deny x509.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	switch algo {
+	case "ed25519":
+		// 署名専用のため暗号化・鍵合意はできません。
+		deny |= x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment | x509.KeyUsageKeyAgreement
+	case "ecdsa":
+		deny |= x509.KeyUsageDataEncipherment
+	case "rsa":
+		deny |= x509.KeyUsageKeyAgreement
+	}
+	if ku&x509.KeyUsageKeyAgreement == 0 {
+		deny |= x509.KeyUsageEncipherOnly | x509.KeyUsageDecipherOnly
+	}
+	if bad := ku & deny; bad != 0 {
+		return fmt.Errorf("%w: %s with %s", ErrKeyUsage, strings.Join(KeyUsageNames(bad), ", "), algo)
+	}
+	return nil
+}
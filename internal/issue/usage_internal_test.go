@@ -2,6 +2,7 @@ package issue
 
 import (
 	"crypto/x509"
+	"errors"
 	"testing"
 )
 
@@ -31,3 +32,61 @@ func TestUsageByType(t *testing.T) {
 		t.Fatalf("both key usage")
 	}
 }
+
+// TestUsageByType_NewTypes は codesign / smime / timestamp / ocsp の既定値を確認します。
+func TestUsageByType_NewTypes(t *testing.T) {
+	cases := []struct {
+		typ, algo string
+		eku       x509.ExtKeyUsage
+		ku        x509.KeyUsage
+	}{
+		{TypeCodeSign, "rsa", x509.ExtKeyUsageCodeSigning, x509.KeyUsageDigitalSignature},
+		{TypeSMIME, "rsa", x509.ExtKeyUsageEmailProtection, x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment},
+		{TypeSMIME, "ecdsa", x509.ExtKeyUsageEmailProtection, x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement},
+		{TypeSMIME, "ed25519", x509.ExtKeyUsageEmailProtection, x509.KeyUsageDigitalSignature},
+		{TypeTimestamp, "ecdsa", x509.ExtKeyUsageTimeStamping, x509.KeyUsageDigitalSignature},
+		{TypeOCSP, "rsa", x509.ExtKeyUsageOCSPSigning, x509.KeyUsageDigitalSignature},
+	}
+	for _, c := range cases {
+		eku, ku := usageByType(c.typ, c.algo)
+		if len(eku) != 1 || eku[0] != c.eku || ku != c.ku {
+			t.Errorf("%s/%s: eku=%v ku=%v", c.typ, c.algo, eku, ku)
+		}
+	}
+}
+
+// TestApplyUsage はプロファイル指定の上書きと鍵アルゴリズムによる拒否を確認します。
+func TestApplyUsage(t *testing.T) {
+	var tmpl x509.Certificate
+	err := applyUsage(&tmpl, TypeServer, "rsa", []string{"digitalSignature", "nonRepudiation"}, []string{"serverAuth", "1.3.6.1.4.1.311.10.3.12"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.KeyUsage != x509.KeyUsageDigitalSignature|x509.KeyUsageContentCommitment {
+		t.Fatalf("key usage: %v", tmpl.KeyUsage)
+	}
+	if len(tmpl.ExtKeyUsage) != 1 || len(tmpl.UnknownExtKeyUsage) != 1 || tmpl.UnknownExtKeyUsage[0].String() != "1.3.6.1.4.1.311.10.3.12" {
+		t.Fatalf("ext key usage: %v %v", tmpl.ExtKeyUsage, tmpl.UnknownExtKeyUsage)
+	}
+
+	bad := []struct {
+		algo string
+		ku   []string
+		eku  []string
+		want error
+	}{
+		{"ed25519", []string{"digitalSignature", "keyEncipherment"}, nil, ErrKeyUsage},
+		{"ed25519", []string{"keyAgreement"}, nil, ErrKeyUsage},
+		{"rsa", []string{"keyAgreement"}, nil, ErrKeyUsage},
+		{"ecdsa", []string{"encipherOnly"}, nil, ErrKeyUsage},
+		{"rsa", []string{"keyCertSign"}, nil, ErrKeyUsage},
+		{"rsa", []string{"signEverything"}, nil, ErrUnknownUsage},
+		{"rsa", nil, []string{"notAnOID"}, ErrUnknownUsage},
+		{"rsa", nil, []string{"3.1"}, ErrUnknownUsage},
+	}
+	for _, b := range bad {
+		if err := applyUsage(&tmpl, TypeServer, b.algo, b.ku, b.eku); !errors.Is(err, b.want) {
+			t.Errorf("%s %v %v: got %v want %v", b.algo, b.ku, b.eku, err, b.want)
+		}
+	}
+}
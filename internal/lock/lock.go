@@ -0,0 +1,106 @@
+// Package lock はディレクトリ単位の排他ロック (advisory lock) を扱います。
+// ロックはディレクトリの .lock ファイルに対する OS のファイルロックで、
+// プロセスが異常終了した場合も OS により解放されます。
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout はロック待ちの既定の上限です。
+const DefaultTimeout = 10 * time.Second
+
+// FileName はロックファイルの名前です。
+const FileName = ".lock"
+
+// ErrLocked は待ち時間内にロックを取得できなかった場合のエラーです。
+var ErrLocked = errors.New("locked")
+
+// interval はロックを再試行する間隔です。
+var interval = 100 * time.Millisecond
+
+// LockedError はロックを保持しているプロセスを示すエラーです。
+type LockedError struct {
+	Path string
+	// PID はロックを保持しているプロセス ID です。読み取れない場合は 0 です。
+	PID int
+}
+
+func (e *LockedError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("%s: locked by another process", e.Path)
+	}
+	return fmt.Sprintf("%s: locked by pid %d", e.Path, e.PID)
+}
+
+func (e *LockedError) Unwrap() error { return ErrLocked }
+
+// Lock は取得済みのロックです。
+type Lock struct {
+	f *os.File
+}
+
+// Dir は dir をロックします。ディレクトリが無い場合は作成します。
+// 他のプロセスが保持している場合は timeout まで待ちます。timeout が 0 の場合は
+// DefaultTimeout、負の場合は待たずに LockedError を返します。
+func Dir(dir string, timeout time.Duration) (*Lock, error) {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, FileName)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, &LockedError{Path: dir, PID: holder(path)}
+		}
+		time.Sleep(interval)
+	}
+	// 取得できなかった側が保持者を表示できるよう PID を書き込みます。
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &Lock{f: f}, nil
+}
+
+// Release はロックを解放します。nil に対しては何もしません。
+// ロックファイルは削除しません (削除と取得が競合するため)。
+func (l *Lock) Release() {
+	if l == nil || l.f == nil {
+		return
+	}
+	unlock(l.f)
+	l.f.Close()
+	l.f = nil
+}
+
+// holder はロックファイルに記録された PID を返します。
+func holder(path string) int {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	return pid
+}
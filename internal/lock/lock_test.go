@@ -0,0 +1,59 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDir_Locked(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "ca")
+	l, err := Dir(dir, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = Dir(dir, 200*time.Millisecond)
+	var le *LockedError
+	if !errors.As(err, &le) || !errors.Is(err, ErrLocked) {
+		t.Fatalf("got %v", err)
+	}
+	if le.PID != os.Getpid() || le.Error() != dir+": locked by pid "+strconv.Itoa(os.Getpid()) {
+		t.Fatalf("unexpected error: %v", le)
+	}
+	if time.Since(start) < 200*time.Millisecond {
+		t.Fatal("did not wait for timeout")
+	}
+	if _, err := Dir(dir, -1); !errors.Is(err, ErrLocked) {
+		t.Fatalf("negative timeout: %v", err)
+	}
+
+	l.Release()
+	l.Release()
+	l2, err := Dir(dir, -1)
+	if err != nil {
+		t.Fatalf("after release: %v", err)
+	}
+	l2.Release()
+}
+
+// TestDir_Wait は解放を待ってロックを取得できることを確認します。
+func TestDir_Wait(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Dir(dir, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		l.Release()
+	}()
+	l2, err := Dir(dir, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2.Release()
+}
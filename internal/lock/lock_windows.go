@@ -0,0 +1,28 @@
+//go:build windows
+
+package lock
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// region はロックするバイト範囲です。PID を読めるよう内容の外側 (4GiB 位置) を使います。
+func region() *windows.Overlapped {
+	return &windows.Overlapped{OffsetHigh: 1}
+}
+
+// tryLock は待たずに排他ロックを試みます。他が保持している場合は false です。
+func tryLock(f *os.File) (bool, error) {
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, region())
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlock(f *os.File) {
+	windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, region())
+}
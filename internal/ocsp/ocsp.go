@@ -0,0 +1,382 @@
+// Package ocsp は revoke が管理する失効情報に基づいて RFC 6960 の OCSP 要求に応答します。
+package ocsp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	xocsp "golang.org/x/crypto/ocsp"
+
+	"orecert/internal/db"
+	"orecert/internal/issue"
+	"orecert/internal/lock"
+	"orecert/internal/revoke"
+	"orecert/internal/stage"
+)
+
+// 応答の署名方式です。
+const (
+	// SignerCA は発行 CA の鍵で直接署名します。
+	SignerCA = "ca"
+	// SignerDelegated は InitSigner で発行した OCSP 署名用の委任証明書で署名します。
+	SignerDelegated = "delegated"
+)
+
+// Config は ocsp 用設定です。
+type Config struct {
+	issue.Layout `mapstructure:",squash"`
+	DefaultAlgo  string   `mapstructure:"default_algo"`
+	CAKeyPass    string   `mapstructure:"ca_key_pass"`
+	Overwrite    bool     `mapstructure:"overwrite"`
+	OCSP         Settings `mapstructure:"ocsp"`
+	// LockTimeout は CA ディレクトリのロックを待つ上限です。0 の場合は lock.DefaultTimeout です。
+	LockTimeout time.Duration `mapstructure:"lock_timeout"`
+	CA          struct {
+		Key  string `mapstructure:"key"`
+		Cert string `mapstructure:"cert"`
+	} `mapstructure:"ca"`
+}
+
+// Settings は .orecert.yaml の ocsp セクションです。
+type Settings struct {
+	// URL は issue が AIA に埋め込むレスポンダの URL です。
+	URL string `mapstructure:"url"`
+	// Listen は serve ocsp の待ち受けアドレスです。
+	Listen string `mapstructure:"listen"`
+	// Signer は ca または delegated です。
+	Signer string `mapstructure:"signer"`
+	// Validity は応答の ThisUpdate から NextUpdate までの期間です。
+	Validity time.Duration `mapstructure:"validity"`
+	// SignerDays は委任証明書の有効日数です。
+	SignerDays int `mapstructure:"signer_days"`
+}
+
+var (
+	ErrInvalidSigner = errors.New("invalid ocsp signer")
+	ErrNoSigner      = errors.New("delegated ocsp signer not found (run init-ocsp)")
+)
+
+// OIDNoCheck は id-pkix-ocsp-nocheck 拡張の OID です。
+var OIDNoCheck = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5}
+
+// SignerDir は署名 CA の委任証明書の保存先を返します。
+func SignerDir(iss issue.Issuer) string {
+	return filepath.Join(filepath.Dir(iss.Cert), "ocsp")
+}
+
+// InitSigner は issuer (空文字はルート CA) が署名する OCSP 署名用の委任証明書を生成します。
+// 証明書には OCSPSigning の EKU と id-pkix-ocsp-nocheck 拡張を付与します。
+// 既存の委任証明書は overwrite が有効な場合のみ置き換え、鍵と証明書はまとめて書き込みます。
+// OCSP 応答は Ed25519 で署名できないため、default_algo が ed25519 の場合は ECDSA P-256 の鍵を使います。
+func InitSigner(cfg Config, issuer string) (string, error) {
+	setDefaults(&cfg)
+	iss, err := issue.ResolveIssuer(cfg.CA.Key, cfg.CA.Cert, issuer)
+	if err != nil {
+		return "", err
+	}
+	// 中間 CA の場合も revoke・crl と同じルート CA ディレクトリのロックを使います。
+	l, err := lock.Dir(filepath.Dir(cfg.CA.Cert), cfg.LockTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer l.Release()
+	dir := SignerDir(iss)
+	keyPath, certPath := filepath.Join(dir, "key.pem"), filepath.Join(dir, "cert.pem")
+	if !cfg.Overwrite {
+		for _, p := range []string{keyPath, certPath} {
+			if _, err := os.Stat(p); err == nil {
+				return "", issue.ErrExists
+			}
+		}
+	}
+	caCert, err := issue.ReadCert(iss.Cert)
+	if err != nil {
+		return "", err
+	}
+	caKey, err := revoke.Signer(iss, cfg.CAKeyPass)
+	if err != nil {
+		return "", err
+	}
+	algo := cfg.DefaultAlgo
+	if algo == "ed25519" {
+		algo = "ecdsa"
+	}
+	priv, pub, err := issue.GenerateKey(algo, 2048)
+	if err != nil {
+		return "", err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	notAfter := now.AddDate(0, 0, cfg.OCSP.SignerDays)
+	if notAfter.After(caCert.NotAfter) {
+		notAfter = caCert.NotAfter
+	}
+	name := "orecert OCSP responder"
+	if iss.Name != "" {
+		name += " " + iss.Name
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:    serial,
+		Subject:         pkix.Name{CommonName: name},
+		NotBefore:       now,
+		NotAfter:        notAfter,
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+		ExtraExtensions: []pkix.Extension{{Id: OIDNoCheck, Value: asn1.NullBytes}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, pub, caKey)
+	if err != nil {
+		return "", err
+	}
+	keyPEM, err := issue.EncodeKey(priv)
+	if err != nil {
+		return "", err
+	}
+	st := stage.New()
+	st.Write(keyPath, keyPEM, 0600)
+	st.Write(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	return certPath, st.Commit()
+}
+
+// responder は 1 つの署名 CA に対する応答用の鍵と証明書です。
+type responder struct {
+	iss     issue.Issuer
+	caCert  *x509.Certificate
+	keyHash []byte // SPKI の公開鍵ビット列 (ハッシュ前)
+	cert    *x509.Certificate
+	signer  crypto.Signer
+	embed   *x509.Certificate
+}
+
+// Responder はルート CA と全中間 CA の証明書について OCSP 応答を返す http.Handler です。
+type Responder struct {
+	cfg        Config
+	responders []responder
+	now        func() time.Time
+}
+
+// New は設定に従って全署名 CA の署名鍵を読み込みます。
+func New(cfg Config) (*Responder, error) {
+	setDefaults(&cfg)
+	if cfg.OCSP.Signer != SignerCA && cfg.OCSP.Signer != SignerDelegated {
+		return nil, ErrInvalidSigner
+	}
+	list, err := issue.Issuers(cfg.CA.Key, cfg.CA.Cert)
+	if err != nil {
+		return nil, err
+	}
+	r := &Responder{cfg: cfg, now: time.Now}
+	for _, iss := range list {
+		caCert, err := issue.ReadCert(iss.Cert)
+		if err != nil {
+			return nil, err
+		}
+		var spki struct {
+			Algorithm pkix.AlgorithmIdentifier
+			PublicKey asn1.BitString
+		}
+		if _, err := asn1.Unmarshal(caCert.RawSubjectPublicKeyInfo, &spki); err != nil {
+			return nil, err
+		}
+		rs := responder{iss: iss, caCert: caCert, keyHash: spki.PublicKey.RightAlign(), cert: caCert}
+		if cfg.OCSP.Signer == SignerDelegated {
+			dir := SignerDir(iss)
+			cert, err := issue.ReadCert(filepath.Join(dir, "cert.pem"))
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil, ErrNoSigner
+				}
+				return nil, err
+			}
+			key, err := issue.ReadKey(filepath.Join(dir, "key.pem"))
+			if err != nil {
+				return nil, err
+			}
+			signer, ok := key.(crypto.Signer)
+			if !ok {
+				return nil, ErrInvalidSigner
+			}
+			rs.cert, rs.embed, rs.signer = cert, cert, signer
+		} else {
+			rs.signer, err = revoke.Signer(iss, cfg.CAKeyPass)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := checkSigner(rs.signer); err != nil {
+			return nil, fmt.Errorf("%s: %w", rs.cert.Subject.CommonName, err)
+		}
+		r.responders = append(r.responders, rs)
+	}
+	return r, nil
+}
+
+// checkSigner は OCSP 応答に使える鍵 (RSA または ECDSA) であることを確認します。
+// Ed25519 の CA では signer: delegated と init-ocsp を使います。
+func checkSigner(s crypto.Signer) error {
+	switch s.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return nil
+	}
+	return fmt.Errorf("%w: %s key cannot sign OCSP responses (use signer: delegated)", ErrInvalidSigner, issue.KeyAlgoString(s.Public()))
+}
+
+// ServeHTTP は POST (application/ocsp-request) と GET (base64 のパス) の要求に応答します。
+func (r *Responder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var body []byte
+	switch req.Method {
+	case http.MethodPost:
+		b, err := io.ReadAll(io.LimitReader(req.Body, 64<<10))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = b
+	case http.MethodGet:
+		p, err := url.PathUnescape(strings.TrimPrefix(req.URL.EscapedPath(), "/"))
+		if err == nil {
+			body, err = base64.StdEncoding.DecodeString(p)
+		}
+		if err != nil {
+			body = nil
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resp := r.Respond(body)
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	w.Write(resp)
+}
+
+// Respond は DER の OCSP 要求に対する応答を返します。
+// 不正な要求や未知の CA 宛ての要求には RFC 6960 のエラー応答を返します。
+func (r *Responder) Respond(der []byte) []byte {
+	req, err := xocsp.ParseRequest(der)
+	if err != nil {
+		return xocsp.MalformedRequestErrorResponse
+	}
+	rs, ok := r.match(req)
+	if !ok {
+		return xocsp.UnauthorizedErrorResponse
+	}
+	now := r.now()
+	tmpl := xocsp.Response{
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(r.cfg.OCSP.Validity),
+		IssuerHash:   req.HashAlgorithm,
+		Certificate:  rs.embed,
+	}
+	if err := r.status(rs, req.SerialNumber, &tmpl); err != nil {
+		return xocsp.InternalErrorErrorResponse
+	}
+	resp, err := xocsp.CreateResponse(rs.caCert, rs.cert, tmpl, rs.signer)
+	if err != nil {
+		return xocsp.InternalErrorErrorResponse
+	}
+	return resp
+}
+
+// match は要求の issuerNameHash と issuerKeyHash に一致する署名 CA を返します。
+func (r *Responder) match(req *xocsp.Request) (responder, bool) {
+	if !req.HashAlgorithm.Available() {
+		return responder{}, false
+	}
+	for _, rs := range r.responders {
+		h := req.HashAlgorithm.New()
+		h.Write(rs.caCert.RawSubject)
+		name := h.Sum(nil)
+		h.Reset()
+		h.Write(rs.keyHash)
+		key := h.Sum(nil)
+		if bytes.Equal(name, req.IssuerNameHash) && bytes.Equal(key, req.IssuerKeyHash) {
+			return rs, true
+		}
+	}
+	return responder{}, false
+}
+
+// status は CRL と台帳から証明書の状態を求めます。
+// CRL にあれば revoked、台帳に同じ CA の記録があれば good、どちらにも無ければ unknown です。
+func (r *Responder) status(rs responder, serial *big.Int, tmpl *xocsp.Response) error {
+	rl, err := revoke.ReadCRL(rs.iss.CRLPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if rl != nil {
+		for _, e := range rl.RevokedCertificateEntries {
+			if e.SerialNumber.Cmp(serial) == 0 {
+				tmpl.Status = xocsp.Revoked
+				tmpl.RevokedAt = e.RevocationTime
+				tmpl.RevocationReason = e.ReasonCode
+				return nil
+			}
+		}
+	}
+	recs, err := db.Load(db.Path(r.cfg.CA.Cert))
+	if err != nil {
+		return err
+	}
+	i, ok := db.Find(recs, db.SerialHex(serial))
+	if !ok || recs[i].Issuer != rs.iss.Name {
+		tmpl.Status = xocsp.Unknown
+		return nil
+	}
+	rec := recs[i]
+	// CRL の整理 (crl prune) で消えた失効エントリは台帳の記録で補います。
+	if rec.Status == db.StatusRevoked && rec.RevokedAt != nil {
+		tmpl.Status = xocsp.Revoked
+		tmpl.RevokedAt = *rec.RevokedAt
+		tmpl.RevocationReason = revoke.Reasons[rec.Reason]
+		return nil
+	}
+	tmpl.Status = xocsp.Good
+	return nil
+}
+
+func setDefaults(cfg *Config) {
+	if cfg.DefaultAlgo == "" {
+		cfg.DefaultAlgo = "rsa"
+	}
+	if cfg.OCSP.Listen == "" {
+		cfg.OCSP.Listen = ":8888"
+	}
+	if cfg.OCSP.Signer == "" {
+		cfg.OCSP.Signer = SignerCA
+	}
+	if cfg.OCSP.Validity == 0 {
+		cfg.OCSP.Validity = 24 * time.Hour
+	}
+	if cfg.OCSP.SignerDays == 0 {
+		cfg.OCSP.SignerDays = 90
+	}
+	if cfg.CA.Key == "" {
+		cfg.CA.Key = cfg.CAPath("key.pem")
+	}
+	if cfg.CA.Cert == "" {
+		cfg.CA.Cert = cfg.CAPath("cert.pem")
+	}
+}
@@ -0,0 +1,171 @@
+package ocsp
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	xocsp "golang.org/x/crypto/ocsp"
+
+	"orecert/internal/ca"
+	"orecert/internal/issue"
+	"orecert/internal/revoke"
+)
+
+func setup(t *testing.T) (Config, *x509.Certificate) {
+	t.Helper()
+	return setupAlgo(t, "")
+}
+
+// setupAlgo は鍵アルゴリズム algo の CA と、good・bad (失効済み) の証明書を作成します。
+func setupAlgo(t *testing.T, algo string) (Config, *x509.Certificate) {
+	t.Helper()
+	dir := t.TempDir()
+	os.Chdir(dir)
+	cfg := Config{DefaultAlgo: algo}
+	cfg.CA.Key = filepath.Join(dir, "certs", "ca", "key.pem")
+	cfg.CA.Cert = filepath.Join(dir, "certs", "ca", "cert.pem")
+	if err := ca.InitCA(ca.Config{CA: cfg.CA, DefaultAlgo: algo}); err != nil {
+		t.Fatalf("init ca: %v", err)
+	}
+	icfg := issue.Config{}
+	icfg.CA = cfg.CA
+	icfg.OCSP.URL = "http://ocsp.test"
+	for _, cn := range []string{"good", "bad"} {
+		if err := issue.Issue(icfg, issue.Profile{CN: cn}, "server"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rcfg := revoke.Config{}
+	rcfg.CA = cfg.CA
+	if err := revoke.RevokeWith(rcfg, revoke.Profile{CN: "bad"}, revoke.Options{Reason: "keyCompromise"}); err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := issue.ReadCert(cfg.CA.Cert)
+	return cfg, caCert
+}
+
+func query(t *testing.T, r *Responder, cn string, caCert *x509.Certificate) *xocsp.Response {
+	t.Helper()
+	cert, _ := issue.ReadCert(filepath.Join("certs", cn, "cert.pem"))
+	if len(cert.OCSPServer) != 1 || cert.OCSPServer[0] != "http://ocsp.test" {
+		t.Fatalf("aia not embedded: %v", cert.OCSPServer)
+	}
+	req, _ := xocsp.CreateRequest(cert, caCert, nil)
+	resp, err := xocsp.ParseResponseForCert(r.Respond(req), cert, caCert)
+	if err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	return resp
+}
+
+func TestRespond_CA(t *testing.T) {
+	cfg, caCert := setup(t)
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := query(t, r, "good", caCert); resp.Status != xocsp.Good {
+		t.Fatalf("expected good, got %d", resp.Status)
+	}
+	resp := query(t, r, "bad", caCert)
+	if resp.Status != xocsp.Revoked || resp.RevocationReason != xocsp.KeyCompromise {
+		t.Fatalf("expected revoked, got %d reason=%d", resp.Status, resp.RevocationReason)
+	}
+}
+
+func TestRespond_Delegated(t *testing.T) {
+	cfg, caCert := setup(t)
+	cfg.OCSP.Signer = SignerDelegated
+	if _, err := New(cfg); err != ErrNoSigner {
+		t.Fatalf("expected ErrNoSigner, got %v", err)
+	}
+	if _, err := InitSigner(cfg, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InitSigner(cfg, ""); !errors.Is(err, issue.ErrExists) {
+		t.Fatalf("expected ErrExists, got %v", err)
+	}
+	cfg.Overwrite = true
+	if _, err := InitSigner(cfg, ""); err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := query(t, r, "good", caCert)
+	if resp.Status != xocsp.Good || resp.Certificate == nil {
+		t.Fatalf("delegated response: status=%d cert=%v", resp.Status, resp.Certificate)
+	}
+	if resp.Certificate.ExtKeyUsage[0] != x509.ExtKeyUsageOCSPSigning {
+		t.Fatalf("delegated cert lacks OCSPSigning")
+	}
+}
+
+// TestRespond_Ed25519CA は Ed25519 の CA で CA 署名の応答を拒否し、委任証明書を ECDSA で生成して応答することを確認します。
+func TestRespond_Ed25519CA(t *testing.T) {
+	cfg, caCert := setupAlgo(t, "ed25519")
+	if _, err := New(cfg); !errors.Is(err, ErrInvalidSigner) {
+		t.Fatalf("expected ErrInvalidSigner, got %v", err)
+	}
+	cfg.OCSP.Signer = SignerDelegated
+	if _, err := InitSigner(cfg, ""); err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := query(t, r, "bad", caCert)
+	if resp.Status != xocsp.Revoked || resp.Certificate.PublicKeyAlgorithm != x509.ECDSA {
+		t.Fatalf("delegated response: status=%d algo=%v", resp.Status, resp.Certificate.PublicKeyAlgorithm)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	cfg, caCert := setup(t)
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	cert, _ := issue.ReadCert(filepath.Join("certs", "bad", "cert.pem"))
+	req, _ := xocsp.CreateRequest(cert, caCert, nil)
+
+	post, err := http.Post(srv.URL, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(post.Body)
+	post.Body.Close()
+	if post.Header.Get("Content-Type") != "application/ocsp-response" {
+		t.Fatalf("content type: %s", post.Header.Get("Content-Type"))
+	}
+	if resp, err := xocsp.ParseResponseForCert(body, cert, caCert); err != nil || resp.Status != xocsp.Revoked {
+		t.Fatalf("post: %v", err)
+	}
+
+	get, err := http.Get(srv.URL + "/" + url.PathEscape(base64.StdEncoding.EncodeToString(req)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(get.Body)
+	get.Body.Close()
+	if resp, err := xocsp.ParseResponseForCert(body, cert, caCert); err != nil || resp.Status != xocsp.Revoked {
+		t.Fatalf("get: %v", err)
+	}
+
+	if out := r.Respond([]byte("junk")); !bytes.Equal(out, xocsp.MalformedRequestErrorResponse) {
+		t.Fatalf("expected malformed response")
+	}
+}
@@ -0,0 +1,193 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// MaxAttempts はプロンプト入力の最大試行回数です。
+const MaxAttempts = 3
+
+// ErrPassword はパスワードを取得できなかった場合のエラーです。
+var ErrPassword = errors.New("password not provided")
+
+// 端末入出力はテストで差し替えられるよう変数にしています。
+var (
+	stdin    io.Reader = os.Stdin
+	stderr   io.Writer = os.Stderr
+	isTerm             = func() bool { return term.IsTerminal(int(os.Stdin.Fd())) }
+	readTerm           = func() ([]byte, error) { return term.ReadPassword(int(os.Stdin.Fd())) }
+)
+
+// Resolve はパスワード供給元からパスワードを取得します。
+// 供給元は `prompt:` (非エコー入力) / `file:<path>` / 直接文字列 のいずれかで、
+// 空文字は `prompt:` と同じ扱いです。
+func Resolve(src string) ([]byte, error) {
+	return resolve(src, false)
+}
+
+// ResolveNew は新しく設定するパスワードを取得します。
+// `prompt:` の場合は確認のため 2 回入力を求めます。
+func ResolveNew(src string) ([]byte, error) {
+	return resolve(src, true)
+}
+
+// Source はパスワードの供給元です。
+type Source interface {
+	Get() ([]byte, error)
+}
+
+// Func は関数をパスワードの供給元として使います。再入力はできません。
+type Func func() ([]byte, error)
+
+// Get は f を呼び出します。
+func (f Func) Get() ([]byte, error) { return f() }
+
+// Cache は初回の Get でのみ Resolve し、以降は同じパスワードを返す供給元です。
+// 暗号化されていない鍵の読み込みで不要なプロンプトを出さないために使います。
+type Cache struct {
+	src   string
+	mu    sync.Mutex
+	done  bool
+	pw    []byte
+	err   error
+	tries int
+}
+
+// Cached は src を供給元とする Cache を返します。
+func Cached(src string) *Cache {
+	return &Cache{src: src}
+}
+
+// Get はパスワードの複製を返します。呼び出し側は使用後に Zero で消去できます。
+func (c *Cache) Get() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.done {
+		c.pw, c.err = Resolve(c.src)
+		c.done = true
+		c.tries++
+	}
+	return bytes.Clone(c.pw), c.err
+}
+
+// Retry は保持したパスワードを消去して破棄します。供給元が prompt: で入力が MaxAttempts 回未満の場合は
+// true を返し、次の Get で入力し直します。
+func (c *Cache) Retry() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	Zero(c.pw)
+	c.pw, c.err, c.done = nil, nil, false
+	if (c.src != "" && c.src != "prompt:") || c.tries >= MaxAttempts {
+		return false
+	}
+	fmt.Fprintln(stderr, "WARN: incorrect password")
+	return true
+}
+
+// WithRetry は s のパスワードで fn を呼び出し、使用後にパスワードを消去します。
+// fn が bad を返し、s が再入力できる供給元 (prompt: の Cache) の場合は入力し直して繰り返します。
+func WithRetry[T any](s Source, bad error, fn func(pw []byte) (T, error)) (T, error) {
+	for {
+		var zero T
+		pw, err := s.Get()
+		if err != nil {
+			return zero, err
+		}
+		v, err := fn(pw)
+		Zero(pw)
+		if !errors.Is(err, bad) {
+			return v, err
+		}
+		if c, ok := s.(interface{ Retry() bool }); !ok || !c.Retry() {
+			return v, err
+		}
+	}
+}
+
+// Zero はパスワードのバイト列をゼロで上書きします。
+func Zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func resolve(src string, confirm bool) ([]byte, error) {
+	switch {
+	case src == "" || src == "prompt:":
+		return prompt(confirm)
+	case strings.HasPrefix(src, "file:"):
+		b, err := os.ReadFile(strings.TrimPrefix(src, "file:"))
+		if err != nil {
+			return nil, err
+		}
+		b = bytes.TrimRight(b, "\r\n")
+		if len(b) == 0 {
+			return nil, ErrPassword
+		}
+		return b, nil
+	default:
+		return []byte(src), nil
+	}
+}
+
+func prompt(confirm bool) ([]byte, error) {
+	for i := 0; i < MaxAttempts; i++ {
+		fmt.Fprint(stderr, "Password: ")
+		pw, err := readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(pw) == 0 {
+			fmt.Fprintln(stderr, "WARN: empty password")
+			continue
+		}
+		if confirm {
+			fmt.Fprint(stderr, "Confirm: ")
+			again, err := readLine()
+			if err != nil {
+				Zero(pw)
+				return nil, err
+			}
+			ok := bytes.Equal(pw, again)
+			Zero(again)
+			if !ok {
+				Zero(pw)
+				fmt.Fprintln(stderr, "WARN: passwords do not match")
+				continue
+			}
+		}
+		return pw, nil
+	}
+	return nil, ErrPassword
+}
+
+// readLine は端末なら非エコーで、それ以外は標準入力から 1 行読み込みます。
+func readLine() ([]byte, error) {
+	if isTerm() {
+		b, err := readTerm()
+		fmt.Fprintln(stderr)
+		return b, err
+	}
+	r, ok := stdin.(*bufio.Reader)
+	if !ok {
+		r = bufio.NewReader(stdin)
+		stdin = r
+	}
+	line, err := r.ReadBytes('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		if err == io.EOF {
+			return nil, ErrPassword
+		}
+		return nil, err
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
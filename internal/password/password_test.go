@@ -0,0 +1,117 @@
+package password
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func withInput(t *testing.T, in string) {
+	t.Helper()
+	oldIn, oldErr, oldTerm := stdin, stderr, isTerm
+	stdin, stderr, isTerm = strings.NewReader(in), io.Discard, func() bool { return false }
+	t.Cleanup(func() { stdin, stderr, isTerm = oldIn, oldErr, oldTerm })
+}
+
+func TestResolve_Literal(t *testing.T) {
+	pw, err := Resolve("secret")
+	if err != nil || string(pw) != "secret" {
+		t.Fatalf("literal: %q %v", pw, err)
+	}
+}
+
+func TestResolve_File(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "pw")
+	os.WriteFile(f, []byte("fromfile\n"), 0600)
+	pw, err := Resolve("file:" + f)
+	if err != nil || string(pw) != "fromfile" {
+		t.Fatalf("file: %q %v", pw, err)
+	}
+	os.WriteFile(f, []byte("\n"), 0600)
+	if _, err := Resolve("file:" + f); err != ErrPassword {
+		t.Fatalf("expected ErrPassword, got %v", err)
+	}
+	if _, err := Resolve("file:" + filepath.Join(t.TempDir(), "none")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestResolve_PromptRetry(t *testing.T) {
+	withInput(t, "\n\nfinally\n")
+	pw, err := Resolve("prompt:")
+	if err != nil || string(pw) != "finally" {
+		t.Fatalf("prompt: %q %v", pw, err)
+	}
+}
+
+func TestResolve_PromptExhausted(t *testing.T) {
+	withInput(t, "\n\n\nlate\n")
+	if _, err := Resolve(""); err != ErrPassword {
+		t.Fatalf("expected ErrPassword, got %v", err)
+	}
+}
+
+func TestResolveNew_Confirm(t *testing.T) {
+	withInput(t, "a\nb\nsame\nsame\n")
+	pw, err := ResolveNew("prompt:")
+	if err != nil || string(pw) != "same" {
+		t.Fatalf("confirm: %q %v", pw, err)
+	}
+}
+
+func TestCached(t *testing.T) {
+	withInput(t, "once\n")
+	c := Cached("prompt:")
+	a, _ := c.Get()
+	b, err := c.Get()
+	if err != nil || !bytes.Equal(a, b) || string(a) != "once" {
+		t.Fatalf("cached: %q %q %v", a, b, err)
+	}
+}
+
+var errBad = errors.New("bad password")
+
+// TestWithRetry は誤ったパスワードを破棄して入力し直し、MaxAttempts 回で諦めることを確認します。
+func TestWithRetry(t *testing.T) {
+	check := func(pw []byte) (string, error) {
+		if string(pw) != "right" {
+			return "", errBad
+		}
+		return string(pw), nil
+	}
+	withInput(t, "wrong\nright\n")
+	var used []byte
+	v, err := WithRetry(Cached("prompt:"), errBad, func(pw []byte) (string, error) {
+		used = pw
+		return check(pw)
+	})
+	if err != nil || v != "right" {
+		t.Fatalf("retry: %q %v", v, err)
+	}
+	if !bytes.Equal(used, make([]byte, len(used))) {
+		t.Errorf("password not zeroed: %q", used)
+	}
+
+	withInput(t, "a\nb\nc\nright\n")
+	if _, err := WithRetry(Cached("prompt:"), errBad, check); !errors.Is(err, errBad) {
+		t.Fatalf("exhausted: %v", err)
+	}
+
+	// prompt: 以外の供給元は入力し直せません。
+	withInput(t, "right\n")
+	if _, err := WithRetry(Cached("wrong"), errBad, check); !errors.Is(err, errBad) {
+		t.Fatalf("literal: %v", err)
+	}
+}
+
+func TestZero(t *testing.T) {
+	b := []byte("abc")
+	Zero(b)
+	if !bytes.Equal(b, []byte{0, 0, 0}) {
+		t.Fatal("not zeroed")
+	}
+}
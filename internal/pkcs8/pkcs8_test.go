@@ -0,0 +1,50 @@
+package pkcs8
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	for _, k := range []any{rsaKey, ecKey, edKey} {
+		der, err := Encrypt(k, []byte("pass"))
+		if err != nil {
+			t.Fatalf("encrypt: %v", err)
+		}
+		got, err := Decrypt(der, []byte("pass"))
+		if err != nil {
+			t.Fatalf("decrypt: %v", err)
+		}
+		if eq, ok := got.(interface{ Equal(crypto.PrivateKey) bool }); !ok || !eq.Equal(k) {
+			t.Fatalf("key mismatch: %T", got)
+		}
+		if _, err := Decrypt(der, []byte("wrong")); err != ErrDecrypt {
+			t.Fatalf("expected ErrDecrypt, got %v", err)
+		}
+	}
+}
+
+func TestDecrypt_Garbage(t *testing.T) {
+	if _, err := Decrypt([]byte("bad"), []byte("p")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestEncryptPEM(t *testing.T) {
+	_, k, _ := ed25519.GenerateKey(rand.Reader)
+	blk, err := EncryptPEM(k, []byte("p"))
+	if err != nil || blk.Type != PEMType {
+		t.Fatalf("pem: %v", err)
+	}
+	if _, err := EncryptPEM(struct{}{}, []byte("p")); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,163 @@
+// Package pki は CA 証明書・中間 CA 証明書・CRL を HTTP で公開します。
+// 公開パスは issue.Issuer.PublicPath と一致し、証明書に埋め込まれた
+// CRL 配布点と caIssuers の URL からそのまま取得できます。
+package pki
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"orecert/internal/issue"
+	"orecert/internal/revoke"
+)
+
+// Config は pki 用設定です。
+type Config struct {
+	issue.Layout `mapstructure:",squash"`
+	PKI          struct {
+		BaseURL string `mapstructure:"base_url"`
+		Listen  string `mapstructure:"listen"`
+	} `mapstructure:"pki"`
+	CA struct {
+		Key  string `mapstructure:"key"`
+		Cert string `mapstructure:"cert"`
+	} `mapstructure:"ca"`
+}
+
+// 公開するファイルの Content-Type です。
+const (
+	ContentTypeCert = "application/pkix-cert"
+	ContentTypeCRL  = "application/pkix-crl"
+	ContentTypePEM  = "application/x-pem-file"
+)
+
+// certMaxAge は CA 証明書の Cache-Control max-age (秒) です。
+const certMaxAge = 24 * 60 * 60
+
+// Server はルート CA と全中間 CA のファイルを公開する http.Handler です。
+// ファイルは要求のたびに読み込むため、revoke や crl refresh の結果が即座に反映されます。
+type Server struct {
+	cfg Config
+	now func() time.Time
+}
+
+// New は Server を作成します。
+func New(cfg Config) *Server {
+	setDefaults(&cfg)
+	return &Server{cfg: cfg, now: time.Now}
+}
+
+// Listen は待ち受けアドレスを返します。
+func (s *Server) Listen() string {
+	return s.cfg.PKI.Listen
+}
+
+// ServeHTTP は /ca.crt, /ca.pem, /ca.crl および /intermediates/<name>.{crt,pem,crl} に応答します。
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Path == "/" {
+		s.index(w)
+		return
+	}
+	list, err := issue.Issuers(s.cfg.CA.Key, s.cfg.CA.Cert)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, iss := range list {
+		switch r.URL.Path {
+		case iss.PublicPath(".crt"):
+			s.cert(w, r, iss, false)
+			return
+		case iss.PublicPath(".pem"):
+			s.cert(w, r, iss, true)
+			return
+		case iss.PublicPath(".crl"):
+			s.crl(w, r, iss)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// index は公開中のファイルの一覧をテキストで返します。
+func (s *Server) index(w http.ResponseWriter) {
+	list, err := issue.Issuers(s.cfg.CA.Key, s.cfg.CA.Cert)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var b strings.Builder
+	for _, iss := range list {
+		for _, ext := range []string{".crt", ".pem", ".crl"} {
+			fmt.Fprintln(&b, strings.TrimSuffix(s.cfg.PKI.BaseURL, "/")+iss.PublicPath(ext))
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+func (s *Server) cert(w http.ResponseWriter, r *http.Request, iss issue.Issuer, asPEM bool) {
+	cert, err := issue.ReadCert(iss.Cert)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body, typ := cert.Raw, ContentTypeCert
+	if asPEM {
+		body, typ = issue.EncodeCerts([]*x509.Certificate{cert}), ContentTypePEM
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", certMaxAge))
+	serve(w, r, typ, cert.NotBefore, body)
+}
+
+func (s *Server) crl(w http.ResponseWriter, r *http.Request, iss issue.Issuer) {
+	rl, err := revoke.ReadCRL(iss.CRLPath())
+	if err != nil && !os.IsNotExist(err) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rl == nil {
+		http.Error(w, "crl not issued yet", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Expires", rl.NextUpdate.UTC().Format(http.TimeFormat))
+	if age := int(rl.NextUpdate.Sub(s.now()).Seconds()); age > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", age))
+	} else {
+		// NextUpdate を過ぎた CRL はキャッシュさせず、再署名後すぐに取得できるようにします。
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	serve(w, r, ContentTypeCRL, rl.ThisUpdate, rl.Raw)
+}
+
+// serve は ETag と Last-Modified を付けて body を返します。条件付き要求にも対応します。
+func serve(w http.ResponseWriter, r *http.Request, typ string, modified time.Time, body []byte) {
+	sum := sha256.Sum256(body)
+	w.Header().Set("Content-Type", typ)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+	http.ServeContent(w, r, "", modified, bytes.NewReader(body))
+}
+
+func setDefaults(cfg *Config) {
+	if cfg.PKI.Listen == "" {
+		cfg.PKI.Listen = ":8080"
+	}
+	if cfg.CA.Key == "" {
+		cfg.CA.Key = cfg.CAPath("key.pem")
+	}
+	if cfg.CA.Cert == "" {
+		cfg.CA.Cert = cfg.CAPath("cert.pem")
+	}
+}
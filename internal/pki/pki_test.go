@@ -0,0 +1,115 @@
+package pki
+
+import (
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"orecert/internal/ca"
+	"orecert/internal/issue"
+	"orecert/internal/revoke"
+)
+
+func setup(t *testing.T) (*httptest.Server, *x509.Certificate) {
+	t.Helper()
+	dir := t.TempDir()
+	os.Chdir(dir)
+	cfg := Config{}
+	cfg.CA.Key = filepath.Join(dir, "certs", "ca", "key.pem")
+	cfg.CA.Cert = filepath.Join(dir, "certs", "ca", "cert.pem")
+	cfg.PKI.BaseURL = "http://pki.test"
+	ccfg := ca.Config{CA: cfg.CA}
+	if err := ca.InitCA(ccfg); err != nil {
+		t.Fatalf("init ca: %v", err)
+	}
+	if err := ca.InitIntermediate(ccfg, "issuing", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	icfg := issue.Config{}
+	icfg.CA = cfg.CA
+	icfg.PKI.BaseURL = cfg.PKI.BaseURL
+	if err := issue.Issue(icfg, issue.Profile{CN: "leaf"}, "server"); err != nil {
+		t.Fatal(err)
+	}
+	rcfg := revoke.Config{}
+	rcfg.CA = cfg.CA
+	if err := revoke.Revoke(rcfg, revoke.Profile{CN: "leaf"}); err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := issue.ReadCert(filepath.Join("certs", "leaf", "cert.pem"))
+	srv := httptest.NewServer(New(cfg))
+	t.Cleanup(srv.Close)
+	return srv, leaf
+}
+
+func get(t *testing.T, url string) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp, b
+}
+
+func TestServe_DistributionPoints(t *testing.T) {
+	srv, leaf := setup(t)
+	crlURL := strings.Replace(leaf.CRLDistributionPoints[0], "http://pki.test", srv.URL, 1)
+	resp, body := get(t, crlURL)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != ContentTypeCRL {
+		t.Fatalf("crl: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	rl, err := x509.ParseRevocationList(body)
+	if err != nil || len(rl.RevokedCertificateEntries) != 1 {
+		t.Fatalf("crl body: %v", err)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Cache-Control"), "public, max-age=") || resp.Header.Get("Expires") == "" {
+		t.Fatalf("cache headers: %v", resp.Header)
+	}
+
+	resp, body = get(t, strings.Replace(leaf.IssuingCertificateURL[0], "http://pki.test", srv.URL, 1))
+	if resp.Header.Get("Content-Type") != ContentTypeCert {
+		t.Fatalf("cert content type: %s", resp.Header.Get("Content-Type"))
+	}
+	caCert, err := x509.ParseCertificate(body)
+	if err != nil || leaf.CheckSignatureFrom(caCert) != nil {
+		t.Fatalf("ca cert: %v", err)
+	}
+
+	resp, _ = get(t, crlURL)
+	req, _ := http.NewRequest(http.MethodGet, crlURL, nil)
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	cond, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cond.Body.Close()
+	if cond.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", cond.StatusCode)
+	}
+}
+
+func TestServe_Intermediates(t *testing.T) {
+	srv, _ := setup(t)
+	resp, body := get(t, srv.URL+"/intermediates/issuing.pem")
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(string(body), "-----BEGIN CERTIFICATE-----") {
+		t.Fatalf("intermediate pem: %d", resp.StatusCode)
+	}
+	// 失効の無い中間 CA の CRL はまだ署名されていません。
+	if resp, _ := get(t, srv.URL+"/intermediates/issuing.crl"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.StatusCode)
+	}
+	if resp, _ := get(t, srv.URL+"/intermediates/none.crt"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.StatusCode)
+	}
+	_, body = get(t, srv.URL+"/")
+	if !strings.Contains(string(body), "http://pki.test/intermediates/issuing.crl") {
+		t.Fatalf("index: %s", body)
+	}
+}
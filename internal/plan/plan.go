@@ -0,0 +1,306 @@
+// Package plan はプロファイルをあるべき状態として発行済み証明書と比較し、
+// 必要な発行・再発行・失効を求めて適用します。
+package plan
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"orecert/internal/db"
+	"orecert/internal/issue"
+	"orecert/internal/revoke"
+)
+
+// Config は plan / apply 用設定です。
+type Config struct {
+	issue.Config `mapstructure:",squash"`
+	CRLDays      int `mapstructure:"crl_days"`
+}
+
+// 操作の種類です。
+const (
+	ActionCreate  = "create"
+	ActionReissue = "reissue"
+	ActionRevoke  = "revoke"
+)
+
+// DefaultExpiring は期限切れが近いとみなす残り期間の既定値です。
+const DefaultExpiring = 30 * 24 * time.Hour
+
+// ErrDuplicateCN は複数のプロファイルが同じ CN を持つ場合のエラーです。
+var ErrDuplicateCN = errors.New("duplicate cn in profiles")
+
+// Options は比較の条件です。
+type Options struct {
+	// Expiring は残り有効期間がこれ以下の証明書を再発行の対象にします。0 の場合は DefaultExpiring です。
+	Expiring time.Duration
+	// Type は用途 (-t) です。プロファイルの type は無視するため、空の場合は発行済みの用途のまま、
+	// 未発行なら server です。
+	Type string
+	// Scope は比較するプロファイルの範囲 (ディレクトリ・グロブ) です。
+	// 範囲内のプロファイルから発行され、そのプロファイルが無くなった証明書を孤立として失効します。
+	Scope []string
+	// Base は meta.json の profile が相対パスの場合の基準ディレクトリ (設定ファイルのディレクトリ) です。
+	// 空の場合は作業ディレクトリです。
+	Base string
+	// Skip は読み込めなかったプロファイルのパス (meta.json の profile と同じ形式) です。
+	// これらのプロファイルから発行された証明書は孤立とみなしません。
+	Skip []string
+	// Prune は範囲内のプロファイルから発行されていない証明書も失効します。
+	// 外部鍵 (sign-csr・ACME) の証明書は Prune でも失効しません。
+	Prune bool
+}
+
+// Change は 1 つの CN に必要な操作です。
+type Change struct {
+	CN string `json:"cn"`
+	// Profile はプロファイルの名前 (パス) です。孤立した証明書では空です。
+	Profile string `json:"profile,omitempty"`
+	Action  string `json:"action"`
+	// Reasons は操作が必要な理由です (missing, san ..., expires in ... など)。
+	Reasons []string `json:"reasons"`
+	// Renew は期限切れが近いだけで設定の差分が無いことを示します。鍵を再利用して更新します。
+	Renew bool `json:"-"`
+
+	prof issue.Profile
+	typ  string
+}
+
+// Plan は jobs (プロファイル) と発行済み証明書を比較し、必要な操作を CN 順に返します。
+// 差分の無い CN は含みません。
+func Plan(cfg Config, jobs []issue.Job, opt Options) ([]Change, error) {
+	if opt.Expiring == 0 {
+		opt.Expiring = DefaultExpiring
+	}
+	icfg := cfg.Config
+	issue.SetDefaults(&icfg)
+	recs, err := db.Load(db.Path(icfg.CA.Cert))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var out []Change
+	seen := map[string]bool{}
+	for _, j := range jobs {
+		if seen[j.Profile.CN] {
+			return nil, fmt.Errorf("%w: %s (%s)", ErrDuplicateCN, j.Profile.CN, j.Name)
+		}
+		seen[j.Profile.CN] = true
+		c, err := compare(icfg, j, opt.Type, opt.Expiring, now)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", j.Name, err)
+		}
+		if c.Action != "" {
+			out = append(out, c)
+		}
+	}
+
+	cns, err := issue.Issued(icfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, cn := range cns {
+		if seen[cn] {
+			continue
+		}
+		paths, err := icfg.Paths(cn)
+		if err != nil {
+			return nil, err
+		}
+		meta, err := issue.ReadMeta(paths.Meta)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cn, err)
+		}
+		// 外部鍵の証明書は sign-csr や ACME で発行したもので、プロファイルで管理しません。
+		if meta.ExternalKey {
+			continue
+		}
+		var reason string
+		switch {
+		case meta.Profile != "" && skipped(opt, meta.Profile):
+			continue
+		case meta.Profile != "" && inScope(resolve(opt.Base, meta.Profile), opt.Scope):
+			reason = "orphaned (issued from " + meta.Profile + ")"
+		case opt.Prune:
+			reason = "unmanaged (prune)"
+		default:
+			continue
+		}
+		cert, err := issue.ReadCert(paths.Cert)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cn, err)
+		}
+		// 失効済み・期限切れの証明書は失効の必要がありません。
+		state := db.StatusValid
+		if i, ok := db.Find(recs, db.SerialHex(cert.SerialNumber)); ok {
+			state = recs[i].State(now)
+		} else if now.After(cert.NotAfter) {
+			state = db.StatusExpired
+		}
+		if state == db.StatusValid {
+			out = append(out, Change{CN: cn, Action: ActionRevoke, Reasons: []string{reason}})
+		}
+	}
+	slices.SortStableFunc(out, func(a, b Change) int { return strings.Compare(a.CN, b.CN) })
+	return out, nil
+}
+
+// compare は 1 つのプロファイルと発行済み証明書を比較します。
+func compare(cfg issue.Config, j issue.Job, typ string, expiring time.Duration, now time.Time) (Change, error) {
+	c := Change{CN: j.Profile.CN, Profile: j.Name, prof: j.Profile}
+	paths, err := cfg.Paths(j.Profile.CN)
+	if err != nil {
+		return c, err
+	}
+	meta, err := issue.ReadMeta(paths.Meta)
+	if errors.Is(err, issue.ErrNoMeta) {
+		c.typ = cmp.Or(typ, issue.TypeServer)
+		c.Action, c.Reasons = ActionCreate, []string{"missing"}
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if typ == "" {
+		typ = meta.Type
+	}
+	cert, err := issue.ReadCert(paths.Cert)
+	if err != nil {
+		c.typ = cmp.Or(typ, issue.TypeServer)
+		c.Action, c.Reasons = ActionCreate, []string{"missing cert.pem"}
+		return c, nil
+	}
+
+	p := j.Profile
+	if want, got := normalize(p.SAN), normalize(meta.SAN); !slices.Equal(want, got) {
+		c.Reasons = append(c.Reasons, fmt.Sprintf("san %v -> %v", got, want))
+	}
+	// 外部鍵の証明書のアルゴリズムは CSR で決まるため比較しません。
+	if !meta.ExternalKey {
+		algo, bits := p.Algo, p.RSABits
+		if algo == "" {
+			algo = cfg.DefaultAlgo
+		}
+		if bits == 0 {
+			bits = 2048
+		}
+		if want := issue.AlgoString(algo, bits); !strings.EqualFold(want, meta.Algorithm) {
+			c.Reasons = append(c.Reasons, fmt.Sprintf("algorithm %s -> %s", meta.Algorithm, want))
+		}
+	}
+	if meta.Type != typ {
+		c.Reasons = append(c.Reasons, fmt.Sprintf("type %s -> %s", meta.Type, typ))
+	}
+	days := p.Days
+	if days == 0 {
+		days = cfg.DefaultDays
+	}
+	if got := int(math.Round(cert.NotAfter.Sub(cert.NotBefore).Hours() / 24)); got != days {
+		c.Reasons = append(c.Reasons, fmt.Sprintf("days %d -> %d", got, days))
+	}
+	drifted := len(c.Reasons) > 0
+	if left := cert.NotAfter.Sub(now); left <= expiring {
+		if left < 0 {
+			c.Reasons = append(c.Reasons, "expired "+cert.NotAfter.Format("2006-01-02"))
+		} else {
+			c.Reasons = append(c.Reasons, fmt.Sprintf("expires in %d days", int(left.Hours()/24)))
+		}
+	}
+	c.typ = typ
+	if len(c.Reasons) > 0 {
+		c.Action = ActionReissue
+		c.Renew = !drifted
+	}
+	return c, nil
+}
+
+// Apply は 1 つの操作を適用します。
+// create と設定の差分がある reissue はプロファイルから発行し直し (新しい鍵)、
+// 期限切れが近いだけの reissue は鍵を再利用して更新し、revoke は cessationOfOperation で失効します。
+func Apply(cfg Config, c Change) error {
+	icfg := cfg.Config
+	issue.SetDefaults(&icfg)
+	switch c.Action {
+	case ActionCreate:
+		icfg.Overwrite = true
+		return issue.Issue(icfg, c.prof, c.typ)
+	case ActionReissue:
+		if c.Renew {
+			_, err := issue.Renew(icfg, c.CN, issue.RenewOptions{KeyPass: c.prof.KeyPass})
+			return err
+		}
+		paths, err := icfg.Paths(c.CN)
+		if err != nil {
+			return err
+		}
+		if meta, err := issue.ReadMeta(paths.Meta); err == nil && meta.ExternalKey {
+			return fmt.Errorf("%w: sign a new CSR with sign-csr", issue.ErrExternalKey)
+		}
+		icfg.Overwrite = true
+		return issue.Issue(icfg, c.prof, c.typ)
+	case ActionRevoke:
+		rcfg := revoke.Config{Layout: icfg.Layout, CAKeyPass: icfg.CAKeyPass, CRLDays: cfg.CRLDays, LockTimeout: icfg.LockTimeout}
+		rcfg.CA = icfg.CA
+		return revoke.RevokeWith(rcfg, revoke.Profile{CN: c.CN}, revoke.Options{Reason: "cessationOfOperation"})
+	default:
+		return fmt.Errorf("unknown action %q", c.Action)
+	}
+}
+
+// resolve は base からの相対パス path を絶対パスにします。
+func resolve(base, path string) string {
+	if !filepath.IsAbs(path) && base != "" {
+		path = filepath.Join(base, path)
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// skipped は profile が読み込めなかったプロファイルかを返します。
+func skipped(opt Options, profile string) bool {
+	path := resolve(opt.Base, profile)
+	for _, s := range opt.Skip {
+		if resolve(opt.Base, s) == path {
+			return true
+		}
+	}
+	return false
+}
+
+// inScope は path (プロファイルの絶対パス) が scope のディレクトリ直下の *.yaml / *.yml か、
+// グロブに一致するかを返します。scope は作業ディレクトリからの相対パスも指定できます。
+func inScope(path string, scope []string) bool {
+	for _, s := range scope {
+		s = resolve("", s)
+		if fi, err := os.Stat(s); err == nil && fi.IsDir() {
+			ext := filepath.Ext(path)
+			if filepath.Dir(path) == s && (ext == ".yaml" || ext == ".yml") {
+				return true
+			}
+			continue
+		}
+		if ok, _ := filepath.Match(s, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize は SAN を比較用に小文字化して並べ替えます。
+func normalize(san []string) []string {
+	out := make([]string, len(san))
+	for i, s := range san {
+		out[i] = strings.ToLower(s)
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
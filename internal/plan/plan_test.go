@@ -0,0 +1,208 @@
+package plan_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"orecert/internal/ca"
+	"orecert/internal/db"
+	"orecert/internal/issue"
+	"orecert/internal/plan"
+)
+
+func createCA(t *testing.T, dir string) plan.Config {
+	t.Helper()
+	cfg := plan.Config{}
+	cfg.CA.Key = filepath.Join(dir, "certs", "ca", "key.pem")
+	cfg.CA.Cert = filepath.Join(dir, "certs", "ca", "cert.pem")
+	if err := ca.InitCA(ca.Config{CA: cfg.CA}); err != nil {
+		t.Fatalf("init ca: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// job は profiles/<cn>.yaml から読み込んだプロファイルとしてのジョブです。
+func job(p issue.Profile) issue.Job {
+	p.Source = filepath.Join("profiles", p.CN+".yaml")
+	return issue.Job{Name: p.Source, Profile: p}
+}
+
+// issueAll は jobs のプロファイルから証明書を発行します。
+func issueAll(t *testing.T, cfg plan.Config, typ string, jobs ...issue.Job) {
+	t.Helper()
+	for _, j := range jobs {
+		if err := issue.Issue(cfg.Config, j.Profile, typ); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func find(changes []plan.Change, cn string) (plan.Change, bool) {
+	for _, c := range changes {
+		if c.CN == cn {
+			return c, true
+		}
+	}
+	return plan.Change{}, false
+}
+
+// TestPlanApply は未発行・差分・期限切れ間近・孤立を検出し、apply 後に差分が無くなることを確認します。
+func TestPlanApply(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	os.Mkdir("profiles", 0755)
+	issueAll(t, cfg, "server",
+		job(issue.Profile{CN: "same", SAN: []string{"DNS:same.local"}}),
+		job(issue.Profile{CN: "san", SAN: []string{"DNS:old.local"}}),
+		job(issue.Profile{CN: "algo"}),
+		job(issue.Profile{CN: "kind"}),
+		job(issue.Profile{CN: "short", Days: 10}),
+		job(issue.Profile{CN: "orphan"}),
+	)
+	// プロファイルから発行していない証明書は孤立とみなしません。
+	issueAll(t, cfg, "server", issue.Job{Profile: issue.Profile{CN: "manual"}})
+
+	jobs := []issue.Job{
+		job(issue.Profile{CN: "same", SAN: []string{"dns:SAME.local"}}),
+		job(issue.Profile{CN: "san", SAN: []string{"DNS:new.local"}}),
+		job(issue.Profile{CN: "algo", Algo: "ecdsa"}),
+		job(issue.Profile{CN: "kind", Days: 100}),
+		job(issue.Profile{CN: "short", Days: 10}),
+		job(issue.Profile{CN: "new"}),
+	}
+	changes, err := plan.Plan(cfg, jobs, plan.Options{Scope: []string{"profiles"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"algo":   plan.ActionReissue,
+		"kind":   plan.ActionReissue,
+		"new":    plan.ActionCreate,
+		"orphan": plan.ActionRevoke,
+		"san":    plan.ActionReissue,
+		"short":  plan.ActionReissue,
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("changes: %+v", changes)
+	}
+	for i, c := range changes {
+		if want[c.CN] != c.Action {
+			t.Errorf("%s: %s", c.CN, c.Action)
+		}
+		if i > 0 && changes[i-1].CN > c.CN {
+			t.Errorf("not sorted: %s", c.CN)
+		}
+	}
+	if c, _ := find(changes, "kind"); len(c.Reasons) != 1 || !strings.HasPrefix(c.Reasons[0], "days 825 -> 100") {
+		t.Errorf("kind reasons: %v", c.Reasons)
+	}
+	if c, _ := find(changes, "short"); !c.Renew {
+		t.Errorf("short should renew: %+v", c)
+	}
+	if c, _ := find(changes, "san"); c.Renew {
+		t.Errorf("san should reissue: %+v", c)
+	}
+
+	for _, c := range changes {
+		if err := plan.Apply(cfg, c); err != nil {
+			t.Fatalf("apply %s: %v", c.CN, err)
+		}
+	}
+	paths, _ := cfg.Paths("algo")
+	meta, err := issue.ReadMeta(paths.Meta)
+	if err != nil || !strings.HasPrefix(meta.Algorithm, "ECDSA") {
+		t.Errorf("algo meta: %+v %v", meta, err)
+	}
+	recs, _ := db.Load(db.Path(cfg.CA.Cert))
+	var revoked int
+	for _, r := range recs {
+		if r.CN == "orphan" && r.RevokedAt != nil {
+			revoked++
+		}
+	}
+	if revoked != 1 {
+		t.Errorf("orphan not revoked: %+v", recs)
+	}
+
+	// 期限切れ間近の判定を外すと差分は残りません。孤立した証明書は失効済みです。
+	changes, err = plan.Plan(cfg, jobs, plan.Options{Expiring: 1, Scope: []string{"profiles"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("changes after apply: %+v", changes)
+	}
+}
+
+func TestPlan_DuplicateCN(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	jobs := []issue.Job{
+		{Name: "a.yaml", Profile: issue.Profile{CN: "a"}},
+		{Name: "b.yaml", Profile: issue.Profile{CN: "a"}},
+	}
+	if _, err := plan.Plan(cfg, jobs, plan.Options{}); !errors.Is(err, plan.ErrDuplicateCN) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+// TestPlan_Subset は一部のプロファイルだけを指定した場合に、範囲外の証明書を失効しないことを確認します。
+func TestPlan_Subset(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	web, api := job(issue.Profile{CN: "web"}), job(issue.Profile{CN: "api"})
+	issueAll(t, cfg, "server", web, api)
+	for _, scope := range [][]string{{"profiles/web.yaml"}, {"profiles/w*.yaml"}} {
+		changes, err := plan.Plan(cfg, []issue.Job{web}, plan.Options{Scope: scope})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 0 {
+			t.Errorf("%v: %+v", scope, changes)
+		}
+	}
+}
+
+// TestPlan_Prune は --prune でプロファイル外の証明書を失効し、外部鍵の証明書は残すことを確認します。
+func TestPlan_Prune(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	issueAll(t, cfg, "server", issue.Job{Profile: issue.Profile{CN: "manual"}}, issue.Job{Profile: issue.Profile{CN: "acme"}})
+	paths, _ := cfg.Paths("acme")
+	meta, _ := os.ReadFile(paths.Meta)
+	os.WriteFile(paths.Meta, []byte(strings.Replace(string(meta), "{", `{"external_key":true,`, 1)), 0644)
+
+	changes, err := plan.Plan(cfg, nil, plan.Options{Scope: []string{"profiles"}})
+	if err != nil || len(changes) != 0 {
+		t.Fatalf("without prune: %+v %v", changes, err)
+	}
+	changes, err = plan.Plan(cfg, nil, plan.Options{Scope: []string{"profiles"}, Prune: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].CN != "manual" || changes[0].Action != plan.ActionRevoke {
+		t.Fatalf("prune: %+v", changes)
+	}
+}
+
+// TestPlan_KeepsType は type の無いプロファイルで発行済みの用途を差分としないことを確認します。
+func TestPlan_KeepsType(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	j := job(issue.Profile{CN: "client"})
+	issueAll(t, cfg, "client", j)
+	changes, err := plan.Plan(cfg, []issue.Job{j}, plan.Options{})
+	if err != nil || len(changes) != 0 {
+		t.Fatalf("changes: %+v %v", changes, err)
+	}
+	changes, err = plan.Plan(cfg, []issue.Job{j}, plan.Options{Type: "server"})
+	if err != nil || len(changes) != 1 || changes[0].Reasons[0] != "type client -> server" {
+		t.Fatalf("with -t: %+v %v", changes, err)
+	}
+}
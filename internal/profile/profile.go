@@ -0,0 +1,211 @@
+// Package profile はプロファイル YAML を読み込み、extends による継承と
+// 設定ファイルの defaults を重ねた結果を返します。
+// 文字列の値は text/template として変数 ({{.name}} など) を展開できます。
+package profile
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Extends は継承元のプロファイルを指定するキーです。パスは指定したファイルのディレクトリからの相対です。
+const Extends = "extends"
+
+// LegacyType は旧形式の用途のキーです。用途は -t で指定するため、プロファイルの値は無視します。
+const LegacyType = "type"
+
+// appendKeys は継承元に追記するリストのキーです。それ以外のリストは置き換えます。
+var appendKeys = []string{"san"}
+
+var (
+	ErrCycle    = errors.New("extends cycle")
+	ErrTemplate = errors.New("invalid profile template")
+	ErrValues   = errors.New("invalid values file")
+)
+
+// Load は path のプロファイルを読み込み、extends を再帰的にたどって継承元から順に重ねます。
+// defaults は最も下の継承元よりさらに下に重ねます。
+func Load(path string, defaults map[string]any) (map[string]any, error) {
+	m, err := load(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return Merge(defaults, m), nil
+}
+
+// load は path と継承元を重ねた結果です。chain は循環の検出に使う読み込み中のパスです。
+func load(path string, chain []string) (map[string]any, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(chain, abs) {
+		return nil, fmt.Errorf("%w: %s", ErrCycle, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]any{}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	base, ok := m[Extends]
+	if !ok {
+		return m, nil
+	}
+	delete(m, Extends)
+	name, ok := base.(string)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("%s: %s must be a file name", path, Extends)
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(filepath.Dir(path), name)
+	}
+	parent, err := load(name, append(chain, abs))
+	if err != nil {
+		return nil, err
+	}
+	return Merge(parent, m), nil
+}
+
+// Merge は base に over を重ねた新しいマップを返します。
+// マップは再帰的に重ね、san は base の後ろに追記 (重複は除く) し、それ以外の値は over で置き換えます。
+func Merge(base, over map[string]any) map[string]any {
+	out := make(map[string]any, len(base)+len(over))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range over {
+		switch ov := v.(type) {
+		case map[string]any:
+			if bv, ok := out[k].(map[string]any); ok {
+				out[k] = Merge(bv, ov)
+				continue
+			}
+		case []any:
+			if bv, ok := out[k].([]any); ok && slices.Contains(appendKeys, k) {
+				list := slices.Clone(bv)
+				for _, e := range ov {
+					if !slices.Contains(list, e) {
+						list = append(list, e)
+					}
+				}
+				out[k] = list
+				continue
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// Decode は重ねた結果を YAML のタグに従って out に読み込みます。
+func Decode(m map[string]any, out any) error {
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, out)
+}
+
+// Render は m の文字列の値を vars で展開した新しいマップを返します。
+// 未定義の変数を参照した場合は ErrTemplate です。
+func Render(m map[string]any, vars map[string]string) (map[string]any, error) {
+	v, err := render("", m, vars)
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]any), nil
+}
+
+// render は v を再帰的に展開します。key はエラー表示用の位置です。
+func render(key string, v any, vars map[string]string) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			r, err := render(strings.TrimPrefix(key+"."+k, "."), e, vars)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = r
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			r, err := render(fmt.Sprintf("%s[%d]", key, i), e, vars)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = r
+		}
+		return out, nil
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		t, err := template.New(key).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrTemplate, key, err)
+		}
+		var b strings.Builder
+		if err := t.Execute(&b, vars); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrTemplate, key, err)
+		}
+		return b.String(), nil
+	default:
+		return v, nil
+	}
+}
+
+// ReadValues は変数の値の一覧を読み込みます。1 行 (要素) が 1 枚の証明書に対応します。
+// 拡張子が .csv の場合は先頭行を変数名とする CSV、それ以外は変数名と値のマップのリストの YAML です。
+func ReadValues(path string) ([]map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rows []map[string]string
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		recs, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrValues, path, err)
+		}
+		if len(recs) > 0 {
+			head := recs[0]
+			for _, rec := range recs[1:] {
+				row := make(map[string]string, len(head))
+				for i, name := range head {
+					row[strings.TrimSpace(name)] = rec[i]
+				}
+				rows = append(rows, row)
+			}
+		}
+	} else {
+		var list []map[string]any
+		if err := yaml.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrValues, path, err)
+		}
+		for _, e := range list {
+			row := make(map[string]string, len(e))
+			for k, v := range e {
+				row[k] = fmt.Sprint(v)
+			}
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: %s: no rows", ErrValues, path)
+	}
+	return rows, nil
+}
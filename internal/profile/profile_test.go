@@ -0,0 +1,151 @@
+package profile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"orecert/internal/issue"
+)
+
+func write(t *testing.T, path, data string) {
+	t.Helper()
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestLoad は多段の extends と defaults が下から順に重なり、san だけが追記されることを確認します。
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "base", "org.yml"), `
+algo: ecdsa
+subject:
+  o: Example
+  c: JP
+san: ["DNS:*.dev.internal"]
+key_usage: [digitalSignature]
+`)
+	write(t, filepath.Join(dir, "web-base.yaml"), `
+extends: base/org.yml
+days: 90
+subject:
+  ou: Web
+san: ["DNS:web.dev.internal"]
+`)
+	write(t, filepath.Join(dir, "web.yaml"), `
+extends: web-base.yaml
+cn: web
+san: ["DNS:web.dev.internal", "DNS:www"]
+key_usage: [digitalSignature, keyAgreement]
+`)
+	defaults := map[string]any{"days": 397, "rsa_bits": 4096, "san": []any{"DNS:common.internal"}}
+	m, err := Load(filepath.Join(dir, "web.yaml"), defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m[Extends]; ok {
+		t.Error("extends left in result")
+	}
+	var prof issue.Profile
+	if err := Decode(m, &prof); err != nil {
+		t.Fatal(err)
+	}
+	wantSAN := []string{"DNS:common.internal", "DNS:*.dev.internal", "DNS:web.dev.internal", "DNS:www"}
+	if !slices.Equal(prof.SAN, wantSAN) {
+		t.Errorf("san: %v", prof.SAN)
+	}
+	if prof.CN != "web" || prof.Algo != "ecdsa" || prof.Days != 90 || prof.RSABits != 4096 {
+		t.Errorf("profile: %+v", prof)
+	}
+	if prof.Subject.O != "Example" || prof.Subject.C != "JP" || prof.Subject.OU != "Web" {
+		t.Errorf("subject: %+v", prof.Subject)
+	}
+	if !slices.Equal(prof.KeyUsage, []string{"digitalSignature", "keyAgreement"}) {
+		t.Errorf("key_usage: %v", prof.KeyUsage)
+	}
+	if len(defaults) != 3 || len(defaults["san"].([]any)) != 1 {
+		t.Errorf("defaults modified: %v", defaults)
+	}
+}
+
+func TestLoad_Cycle(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "a.yaml"), "extends: b.yaml\ncn: a\n")
+	write(t, filepath.Join(dir, "b.yaml"), "extends: a.yaml\n")
+	if _, err := Load(filepath.Join(dir, "a.yaml"), nil); !errors.Is(err, ErrCycle) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestLoad_MissingParent(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "a.yaml"), "extends: none.yaml\ncn: a\n")
+	if _, err := Load(filepath.Join(dir, "a.yaml"), nil); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	m := map[string]any{
+		"cn":      "{{.name}}.dev.internal",
+		"san":     []any{"DNS:{{.name}}", "IP:{{.ip}}"},
+		"subject": map[string]any{"ou": "{{.team}}"},
+		"days":    90,
+	}
+	r, err := Render(m, map[string]string{"name": "web1", "ip": "10.0.0.1", "team": "Web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prof issue.Profile
+	if err := Decode(r, &prof); err != nil {
+		t.Fatal(err)
+	}
+	if prof.CN != "web1.dev.internal" || !slices.Equal(prof.SAN, []string{"DNS:web1", "IP:10.0.0.1"}) || prof.Subject.OU != "Web" || prof.Days != 90 {
+		t.Errorf("profile: %+v", prof)
+	}
+	if m["cn"] != "{{.name}}.dev.internal" {
+		t.Error("input modified")
+	}
+	if _, err := Render(m, map[string]string{"name": "web1"}); !errors.Is(err, ErrTemplate) {
+		t.Errorf("missing variable: %v", err)
+	}
+	if _, err := Render(map[string]any{"cn": "{{.name"}, nil); !errors.Is(err, ErrTemplate) {
+		t.Errorf("parse error: %v", err)
+	}
+}
+
+func TestReadValues(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "hosts.csv")
+	write(t, csvPath, "name, ip\nweb1,10.0.0.1\nweb2,10.0.0.2\n")
+	rows, err := ReadValues(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[1]["name"] != "web2" || rows[1]["ip"] != "10.0.0.2" {
+		t.Errorf("csv rows: %v", rows)
+	}
+
+	yamlPath := filepath.Join(dir, "devices.yaml")
+	write(t, yamlPath, "- {name: dev1, id: 42}\n- {name: dev2, id: 43}\n")
+	rows, err = ReadValues(yamlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0]["id"] != "42" {
+		t.Errorf("yaml rows: %v", rows)
+	}
+
+	write(t, csvPath, "name,ip\n")
+	if _, err := ReadValues(csvPath); !errors.Is(err, ErrValues) {
+		t.Errorf("empty: %v", err)
+	}
+	write(t, csvPath, "name,ip\nweb1\n")
+	if _, err := ReadValues(csvPath); !errors.Is(err, ErrValues) {
+		t.Errorf("short row: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package revoke
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"orecert/internal/lock"
+)
+
+// TestRevoke_Concurrent は同時に失効しても CRL のエントリが失われないことを確認します。
+func TestRevoke_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	os.Chdir(dir)
+	const n = 6
+	for i := 0; i < n; i++ {
+		issueCert(t, dir, fmt.Sprintf("host%d", i), cfg)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- Revoke(cfg, Profile{CN: fmt.Sprintf("host%d", i)})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rl, err := ReadCRL(filepath.Join("certs", "ca", "crl.pem"))
+	if err != nil || len(rl.RevokedCertificateEntries) != n {
+		t.Fatalf("crl entries lost: %v", err)
+	}
+}
+
+func TestRevoke_LockTimeout(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	issueCert(t, dir, "host", cfg)
+	os.Chdir(dir)
+	l, err := lock.Dir(filepath.Dir(cfg.CA.Cert), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Release()
+	cfg.LockTimeout = 100 * time.Millisecond
+	err = Revoke(cfg, Profile{CN: "host"})
+	var le *lock.LockedError
+	if !errors.As(err, &le) || le.PID != os.Getpid() {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -4,20 +4,32 @@ import (
 	"crypto"
 	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"errors"
 	"math/big"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
+	"orecert/internal/db"
 	"orecert/internal/issue"
+	"orecert/internal/lock"
+	"orecert/internal/password"
+	"orecert/internal/stage"
 )
 
 // Config は revoke 用設定です。
 type Config struct {
-	CA struct {
+	issue.Layout `mapstructure:",squash"`
+	CAKeyPass    string `mapstructure:"ca_key_pass"`
+	CRLDays      int    `mapstructure:"crl_days"`
+	// LockTimeout は CA ディレクトリのロックを待つ上限です。0 の場合は lock.DefaultTimeout です。
+	LockTimeout time.Duration `mapstructure:"lock_timeout"`
+	CA          struct {
 		Key  string `mapstructure:"key"`
 		Cert string `mapstructure:"cert"`
 	} `mapstructure:"ca"`
@@ -28,69 +40,321 @@ type Profile struct {
 	CN string `mapstructure:"cn"`
 }
 
+// Options は失効理由と危殆化日時の指定です。
+type Options struct {
+	// Reason は RFC 5280 の失効理由名 (keyCompromise など) です。空は unspecified です。
+	Reason string
+	// InvalidityDate は鍵が危殆化したと判明している日時です。ゼロ値は指定なしです。
+	InvalidityDate time.Time
+}
+
+var (
+	ErrAlreadyRevoked  = errors.New("certificate already revoked")
+	ErrInvalidReason   = errors.New("invalid revocation reason")
+	ErrInvalidityDate  = errors.New("invalidity date is in the future")
+	ErrInvalidSerial   = errors.New("invalid serial")
+	errCASignerMissing = errors.New("ca key is not signer")
+)
+
+// OIDInvalidityDate は CRL エントリ拡張 invalidityDate の OID です。
+var OIDInvalidityDate = asn1.ObjectIdentifier{2, 5, 29, 24}
+
+// Reasons は RFC 5280 の失効理由名と reasonCode の対応です。
+// removeFromCRL (8) は差分 CRL でのみ使えるため、完全な CRL だけを出力する orecert では受け付けません。
+var Reasons = map[string]int{
+	"unspecified":          0,
+	"keyCompromise":        1,
+	"cACompromise":         2,
+	"affiliationChanged":   3,
+	"superseded":           4,
+	"cessationOfOperation": 5,
+	"certificateHold":      6,
+	"privilegeWithdrawn":   9,
+	"aACompromise":         10,
+}
+
+// ReasonString は reasonCode から失効理由名を返します。
+func ReasonString(code int) string {
+	for name, c := range Reasons {
+		if c == code {
+			return name
+		}
+	}
+	return "unspecified"
+}
+
 // Revoke は証明書を失効させ CRL を更新します。
 func Revoke(cfg Config, prof Profile) error {
+	return RevokeWith(cfg, prof, Options{})
+}
+
+// RevokeWith は CN の cert.pem の証明書を失効理由付きで失効させます。
+// issue・renew と同じく CN のロック、CA のロックの順に取得し、再発行中の cert.pem を読まないようにします。
+func RevokeWith(cfg Config, prof Profile, opt Options) error {
 	if prof.CN == "" || strings.Contains(prof.CN, "..") || strings.ContainsAny(prof.CN, "/\\") {
 		return issue.ErrInvalidCN
 	}
-	if cfg.CA.Key == "" {
-		cfg.CA.Key = filepath.FromSlash("certs/ca/key.pem")
+	paths, err := cfg.Paths(prof.CN)
+	if err != nil {
+		return err
 	}
-	if cfg.CA.Cert == "" {
-		cfg.CA.Cert = filepath.FromSlash("certs/ca/cert.pem")
+	// 存在しない CN のディレクトリをロックで作らないよう先に確認します。
+	if _, err := os.Stat(paths.Cert); err != nil {
+		return err
+	}
+	l, err := lock.Dir(paths.Dir, cfg.LockTimeout)
+	if err != nil {
+		return err
 	}
-	crlPath := filepath.Join(filepath.Dir(cfg.CA.Cert), "crl.pem")
-	certPath := filepath.Join("certs", prof.CN, "cert.pem")
+	defer l.Release()
+	cert, err := issue.ReadCert(paths.Cert)
+	if err != nil {
+		return err
+	}
+	return RevokeCert(cfg, cert, opt)
+}
 
-	cert, err := issue.ReadCert(certPath)
+// RevokeCert は証明書ファイルの内容を直接指定して失効させます。
+func RevokeCert(cfg Config, cert *x509.Certificate, opt Options) error {
+	setDefaults(&cfg)
+	iss, caCert, err := issue.FindIssuer(cfg.CA.Key, cfg.CA.Cert, cert)
 	if err != nil {
 		return err
 	}
-	caCert, err := issue.ReadCert(cfg.CA.Cert)
+	// CRL の読み込みから反映までの間、他のプロセスによる CRL・台帳の更新を止めます。
+	l, err := lock.Dir(filepath.Dir(cfg.CA.Cert), cfg.LockTimeout)
 	if err != nil {
 		return err
 	}
-	keyAny, err := issue.ReadKey(cfg.CA.Key)
+	defer l.Release()
+	// CRL と台帳はまとめて置き換え、片方だけが更新された状態を残さないようにします。
+	st := stage.New()
+	if err := revoke(cfg, st, iss, caCert, cert.SerialNumber, opt); err != nil {
+		return err
+	}
+	path := db.Path(cfg.CA.Cert)
+	recs, err := db.Load(path)
 	if err != nil {
 		return err
 	}
-	signer, ok := keyAny.(crypto.Signer)
+	serial := db.SerialHex(cert.SerialNumber)
+	if _, ok := db.Find(recs, serial); !ok {
+		// 台帳導入前に発行された証明書はその場で登録します。
+		recs = db.Put(recs, db.FromCert(cert, "", iss.Name, issue.FormatSAN(cert.DNSNames, cert.IPAddresses, cert.URIs, cert.EmailAddresses), issue.Fingerprint(cert.Raw)))
+	}
+	if err := stageRecords(st, path, recs, serial, opt); err != nil {
+		return err
+	}
+	return st.Commit()
+}
+
+// RevokeSerial は台帳に記録されたシリアル (16 進) の証明書を失効させ、台帳の CN を返します。
+// cert.pem が再発行で上書きされた過去の証明書も失効できます。
+func RevokeSerial(cfg Config, serial string, opt Options) (string, error) {
+	setDefaults(&cfg)
+	n, ok := new(big.Int).SetString(strings.ReplaceAll(serial, ":", ""), 16)
+	if !ok {
+		return "", ErrInvalidSerial
+	}
+	l, err := lock.Dir(filepath.Dir(cfg.CA.Cert), cfg.LockTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer l.Release()
+	path := db.Path(cfg.CA.Cert)
+	recs, err := db.Load(path)
+	if err != nil {
+		return "", err
+	}
+	i, ok := db.Find(recs, serial)
 	if !ok {
-		return errors.New("ca key is not signer")
+		return "", db.ErrNotFound
 	}
+	rec := recs[i]
+	iss, err := issue.ResolveIssuer(cfg.CA.Key, cfg.CA.Cert, rec.Issuer)
+	if err != nil {
+		return rec.CN, err
+	}
+	caCert, err := issue.ReadCert(iss.Cert)
+	if err != nil {
+		return rec.CN, err
+	}
+	st := stage.New()
+	if err := revoke(cfg, st, iss, caCert, n, opt); err != nil {
+		return rec.CN, err
+	}
+	if err := stageRecords(st, path, recs, rec.Serial, opt); err != nil {
+		return rec.CN, err
+	}
+	return rec.CN, st.Commit()
+}
 
-	data, err := os.ReadFile(crlPath)
+// stageRecords は recs のシリアルを失効状態にした台帳を st に追加します。
+func stageRecords(st *stage.Stage, path string, recs []db.Record, serial string, opt Options) error {
+	if err := db.SetRevoked(recs, serial, time.Now(), reasonName(opt.Reason)); err != nil {
+		return err
+	}
+	b, err := db.Encode(recs)
 	if err != nil {
 		return err
 	}
+	st.Write(path, b, 0644)
+	return nil
+}
+
+// ReadCRL は PEM 形式の CRL を読み込みます。
+// init-ca 直後の空 CRL の場合は nil を返します。
+func ReadCRL(path string) (*x509.RevocationList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
 	blk, _ := pem.Decode(data)
 	if blk == nil {
-		return errors.New("invalid crl pem")
+		return nil, errors.New("invalid crl pem")
+	}
+	if len(blk.Bytes) == 0 {
+		return nil, nil
+	}
+	return x509.ParseRevocationList(blk.Bytes)
+}
+
+// InvalidityDate は CRL エントリの invalidityDate 拡張を返します。
+func InvalidityDate(e x509.RevocationListEntry) (time.Time, bool) {
+	for _, ext := range e.Extensions {
+		if ext.Id.Equal(OIDInvalidityDate) {
+			var t time.Time
+			if _, err := asn1.UnmarshalWithParams(ext.Value, &t, "generalized"); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// revoke は iss の CRL にシリアルを追加して再署名し、st に追加します。
+func revoke(cfg Config, st *stage.Stage, iss issue.Issuer, caCert *x509.Certificate, serial *big.Int, opt Options) error {
+	code, ok := Reasons[reasonName(opt.Reason)]
+	if !ok {
+		return ErrInvalidReason
+	}
+	now := time.Now()
+	if opt.InvalidityDate.After(now) {
+		return ErrInvalidityDate
+	}
+	signer, err := Signer(iss, cfg.CAKeyPass)
+	if err != nil {
+		return err
+	}
+
+	crlPath := iss.CRLPath()
+	rl, err := ReadCRL(crlPath)
+	if err != nil {
+		return err
 	}
 	var revoked []x509.RevocationListEntry
 	number := big.NewInt(1)
-	if len(blk.Bytes) > 0 {
-		rl, err := x509.ParseRevocationList(blk.Bytes)
-		if err != nil {
-			return err
-		}
+	if rl != nil {
 		revoked = rl.RevokedCertificateEntries
 		if rl.Number != nil {
 			number = new(big.Int).Add(rl.Number, big.NewInt(1))
 		}
 	}
-	revoked = append(revoked, x509.RevocationListEntry{SerialNumber: cert.SerialNumber, RevocationTime: time.Now()})
+	for _, e := range revoked {
+		if e.SerialNumber.Cmp(serial) == 0 {
+			return ErrAlreadyRevoked
+		}
+	}
+	entry := x509.RevocationListEntry{SerialNumber: serial, RevocationTime: now, ReasonCode: code}
+	if !opt.InvalidityDate.IsZero() {
+		v, err := asn1.MarshalWithParams(opt.InvalidityDate.UTC(), "generalized")
+		if err != nil {
+			return err
+		}
+		entry.ExtraExtensions = []pkix.Extension{{Id: OIDInvalidityDate, Value: v}}
+	}
+	revoked = append(revoked, entry)
+	der, err := signCRL(caCert, signer, revoked, number, now, now.AddDate(0, 0, cfg.CRLDays))
+	if err != nil {
+		return err
+	}
+	stageCRL(st, crlPath, der)
+	return nil
+}
+
+// WriteCRL は失効エントリを CA 鍵で署名した CRL を PEM で保存します。
+// 同じディレクトリに DER 形式 (拡張子 .der) も出力します。両者はまとめて置き換えます。
+func WriteCRL(path string, caCert *x509.Certificate, signer crypto.Signer, revoked []x509.RevocationListEntry, number *big.Int, thisUpdate, nextUpdate time.Time) error {
+	der, err := signCRL(caCert, signer, revoked, number, thisUpdate, nextUpdate)
+	if err != nil {
+		return err
+	}
+	st := stage.New()
+	stageCRL(st, path, der)
+	return st.Commit()
+}
+
+// stageCRL は CRL の PEM と DER を st に追加します。
+func stageCRL(st *stage.Stage, path string, der []byte) {
+	st.Write(path, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0644)
+	st.Write(DERPath(path), der, 0644)
+}
 
+// signCRL は失効エントリを CA 鍵で署名した CRL を DER で返します。
+func signCRL(caCert *x509.Certificate, signer crypto.Signer, revoked []x509.RevocationListEntry, number *big.Int, thisUpdate, nextUpdate time.Time) ([]byte, error) {
+	sort.SliceStable(revoked, func(i, j int) bool { return revoked[i].RevocationTime.Before(revoked[j].RevocationTime) })
+	// 既存エントリの拡張は ExtraExtensions として引き継がないと再署名時に失われます。
+	for i := range revoked {
+		if len(revoked[i].ExtraExtensions) == 0 {
+			for _, ext := range revoked[i].Extensions {
+				if ext.Id.Equal(OIDInvalidityDate) {
+					revoked[i].ExtraExtensions = append(revoked[i].ExtraExtensions, ext)
+				}
+			}
+		}
+	}
 	tmpl := &x509.RevocationList{
-		SignatureAlgorithm:        caCert.SignatureAlgorithm,
 		RevokedCertificateEntries: revoked,
 		Number:                    number,
-		ThisUpdate:                time.Now(),
-		NextUpdate:                time.Now().AddDate(0, 0, 30),
+		ThisUpdate:                thisUpdate,
+		NextUpdate:                nextUpdate,
 	}
-	der, err := x509.CreateRevocationList(rand.Reader, tmpl, caCert, signer)
+	return x509.CreateRevocationList(rand.Reader, tmpl, caCert, signer)
+}
+
+// DERPath は PEM の CRL パスに対応する DER ファイルのパスを返します。
+func DERPath(pemPath string) string {
+	return strings.TrimSuffix(pemPath, filepath.Ext(pemPath)) + ".der"
+}
+
+// Signer は署名 CA の秘密鍵を crypto.Signer として読み込みます。
+func Signer(iss issue.Issuer, keyPass string) (crypto.Signer, error) {
+	keyAny, err := issue.ReadKeyWith(iss.Key, password.Cached(keyPass))
 	if err != nil {
-		return err
+		return nil, err
+	}
+	signer, ok := keyAny.(crypto.Signer)
+	if !ok {
+		return nil, errCASignerMissing
+	}
+	return signer, nil
+}
+
+func setDefaults(cfg *Config) {
+	if cfg.CRLDays == 0 {
+		cfg.CRLDays = 30
+	}
+	if cfg.CA.Key == "" {
+		cfg.CA.Key = cfg.CAPath("key.pem")
+	}
+	if cfg.CA.Cert == "" {
+		cfg.CA.Cert = cfg.CAPath("cert.pem")
+	}
+}
+
+func reasonName(r string) string {
+	if r == "" {
+		return "unspecified"
 	}
-	return os.WriteFile(crlPath, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0644)
+	return r
 }
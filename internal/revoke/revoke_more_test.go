@@ -6,6 +6,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"orecert/internal/ca"
+	"orecert/internal/issue"
 )
 
 // TestRevoke_Multiple は CRL が 2 件になることを確認します。
@@ -58,3 +61,27 @@ func TestRevoke_BrokenCACert(t *testing.T) {
 		t.Fatal("エラーが必要")
 	}
 }
+
+// TestRevoke_Intermediate は中間 CA 発行証明書が中間 CA の CRL に載ることを確認します。
+func TestRevoke_Intermediate(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	if err := ca.InitIntermediate(ca.Config{CA: cfg.CA}, "issuing", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	os.Chdir(dir)
+	icfg := issue.Config{Issuer: "issuing"}
+	icfg.CA = cfg.CA
+	if err := issue.Issue(icfg, issue.Profile{CN: "i"}, "server"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Revoke(cfg, Profile{CN: "i"}); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(issue.IntermediateDir(cfg.CA.Cert, "issuing"), "crl.pem"))
+	blk, _ := pem.Decode(data)
+	rl, err := x509.ParseRevocationList(blk.Bytes)
+	if err != nil || len(rl.RevokedCertificateEntries) != 1 {
+		t.Fatalf("intermediate crl not updated: %v", err)
+	}
+}
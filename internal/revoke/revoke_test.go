@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"orecert/internal/ca"
+	"orecert/internal/db"
 )
 
 func createCA(t *testing.T, dir string) Config {
@@ -72,6 +73,10 @@ func TestRevoke_OK(t *testing.T) {
 	if err != nil || len(rl.RevokedCertificateEntries) != 1 {
 		t.Fatalf("crl not updated")
 	}
+	rec, err := db.Lookup(db.Path(cfg.CA.Cert), db.SerialHex(rl.RevokedCertificateEntries[0].SerialNumber))
+	if err != nil || rec.Status != db.StatusRevoked || rec.CN != "host" {
+		t.Fatalf("database not updated: %+v %v", rec, err)
+	}
 }
 
 func TestRevoke_InvalidCN(t *testing.T) {
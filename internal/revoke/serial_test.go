@@ -0,0 +1,100 @@
+package revoke
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"orecert/internal/db"
+	"orecert/internal/issue"
+)
+
+// TestRevokeSerial_Reissued は再発行で上書きされた旧証明書をシリアルで失効できることを確認します。
+func TestRevokeSerial_Reissued(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	os.Chdir(dir)
+	icfg := issue.Config{Overwrite: true}
+	icfg.CA = cfg.CA
+	if err := issue.Issue(icfg, issue.Profile{CN: "leak"}, "server"); err != nil {
+		t.Fatal(err)
+	}
+	old, _ := issue.ReadCert(filepath.Join("certs", "leak", "cert.pem"))
+	if err := issue.Issue(icfg, issue.Profile{CN: "leak"}, "server"); err != nil {
+		t.Fatal(err)
+	}
+	when := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	opt := Options{Reason: "keyCompromise", InvalidityDate: when}
+	if cn, err := RevokeSerial(cfg, db.SerialHex(old.SerialNumber), opt); err != nil || cn != "leak" {
+		t.Fatalf("revoke serial: %q %v", cn, err)
+	}
+	rl, err := ReadCRL(filepath.Join("certs", "ca", "crl.pem"))
+	if err != nil || len(rl.RevokedCertificateEntries) != 1 {
+		t.Fatalf("crl: %v", err)
+	}
+	e := rl.RevokedCertificateEntries[0]
+	if e.SerialNumber.Cmp(old.SerialNumber) != 0 || e.ReasonCode != 1 {
+		t.Fatalf("entry mismatch: %v reason=%d", e.SerialNumber, e.ReasonCode)
+	}
+	if d, ok := InvalidityDate(e); !ok || !d.Equal(when) {
+		t.Fatalf("invalidity date: %v %v", d, ok)
+	}
+	rec, _ := db.Lookup(db.Path(cfg.CA.Cert), db.SerialHex(old.SerialNumber))
+	if rec.Status != db.StatusRevoked || rec.Reason != "keyCompromise" {
+		t.Fatalf("db not updated: %+v", rec)
+	}
+
+	// 既存エントリの拡張は再署名後も保持されます。
+	if err := Revoke(cfg, Profile{CN: "leak"}); err != nil {
+		t.Fatal(err)
+	}
+	rl, _ = ReadCRL(filepath.Join("certs", "ca", "crl.pem"))
+	if len(rl.RevokedCertificateEntries) != 2 {
+		t.Fatalf("2 entries expected")
+	}
+	if _, ok := InvalidityDate(rl.RevokedCertificateEntries[0]); !ok || rl.RevokedCertificateEntries[0].ReasonCode != 1 {
+		t.Fatalf("extensions lost on resign")
+	}
+}
+
+func TestRevoke_Duplicate(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	issueCert(t, dir, "dup", cfg)
+	os.Chdir(dir)
+	if err := Revoke(cfg, Profile{CN: "dup"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RevokeWith(cfg, Profile{CN: "dup"}, Options{Reason: "superseded"}); err != ErrAlreadyRevoked {
+		t.Fatalf("expected ErrAlreadyRevoked, got %v", err)
+	}
+	rl, _ := ReadCRL(filepath.Join("certs", "ca", "crl.pem"))
+	if len(rl.RevokedCertificateEntries) != 1 {
+		t.Fatalf("duplicate entry added")
+	}
+}
+
+func TestRevoke_OptionErrors(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	issueCert(t, dir, "opt", cfg)
+	os.Chdir(dir)
+	for _, reason := range []string{"bogus", "removeFromCRL"} {
+		if err := RevokeWith(cfg, Profile{CN: "opt"}, Options{Reason: reason}); err != ErrInvalidReason {
+			t.Fatalf("%s: expected ErrInvalidReason, got %v", reason, err)
+		}
+	}
+	if err := RevokeWith(cfg, Profile{CN: "opt"}, Options{InvalidityDate: time.Now().Add(time.Hour)}); err != ErrInvalidityDate {
+		t.Fatalf("expected ErrInvalidityDate, got %v", err)
+	}
+	if _, err := RevokeSerial(cfg, "zz", Options{}); err != ErrInvalidSerial {
+		t.Fatalf("expected ErrInvalidSerial, got %v", err)
+	}
+	if _, err := RevokeSerial(cfg, "ABCDEF", Options{}); err != db.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if ReasonString(5) != "cessationOfOperation" {
+		t.Fatalf("reason string")
+	}
+}
@@ -0,0 +1,172 @@
+// Package stage は複数ファイルの書き込みをまとめて反映します。
+// 内容は出力先と同じディレクトリの一時ディレクトリに書き出してから rename で置き換え、
+// 途中で失敗した場合は置き換え済みのファイルを元に戻します。
+package stage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// rename はテストで失敗を差し込むための差し替え口です。
+var rename = os.Rename
+
+type op struct {
+	path   string
+	data   []byte
+	perm   os.FileMode
+	remove bool
+}
+
+// Stage は反映待ちのファイル操作の一覧です。
+type Stage struct {
+	ops []op
+}
+
+// New は空の Stage を返します。
+func New() *Stage {
+	return &Stage{}
+}
+
+// Write は path に data を書き込む操作を追加します。
+func (s *Stage) Write(path string, data []byte, perm os.FileMode) {
+	s.ops = append(s.ops, op{path: path, data: data, perm: perm})
+}
+
+// Remove は path を削除する操作を追加します。ファイルが無い場合は何もしません。
+func (s *Stage) Remove(path string) {
+	s.ops = append(s.ops, op{path: path, remove: true})
+}
+
+// undo は置き換えたファイルを戻すための記録です。backup が空の場合は元のファイルがありません。
+type undo struct {
+	path   string
+	backup string
+}
+
+// Commit はすべての操作を反映します。
+// 一時ディレクトリへの書き出しに失敗した場合は出力先に触れず、
+// 置き換えの途中で失敗した場合は反映済みの操作を逆順に取り消してエラーを返します。
+// 失敗した場合は Commit が作成したディレクトリも削除します。
+func (s *Stage) Commit() (err error) {
+	tmp := map[string]string{}
+	var created []string
+	defer func() {
+		for _, d := range tmp {
+			os.RemoveAll(d)
+		}
+		if err != nil {
+			for i := len(created) - 1; i >= 0; i-- {
+				os.Remove(created[i])
+			}
+		}
+	}()
+	staged := make([]string, len(s.ops))
+	for i, o := range s.ops {
+		if fi, err := os.Lstat(o.path); err == nil && fi.IsDir() {
+			return fmt.Errorf("%s: is a directory", o.path)
+		}
+		dir := filepath.Dir(o.path)
+		if _, ok := tmp[dir]; !ok {
+			created = append(created, missing(dir)...)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			d, err := os.MkdirTemp(dir, ".stage-")
+			if err != nil {
+				return err
+			}
+			tmp[dir] = d
+		}
+		if o.remove {
+			continue
+		}
+		staged[i] = filepath.Join(tmp[dir], fmt.Sprintf("%d.new", i))
+		if err := writeSync(staged[i], o.data, o.perm); err != nil {
+			return err
+		}
+	}
+
+	var done []undo
+	for i, o := range s.ops {
+		u := undo{path: o.path}
+		backup := filepath.Join(tmp[filepath.Dir(o.path)], fmt.Sprintf("%d.old", i))
+		if err := rename(o.path, backup); err == nil {
+			u.backup = backup
+		} else if !os.IsNotExist(err) {
+			rollback(done)
+			return err
+		}
+		done = append(done, u)
+		if o.remove {
+			continue
+		}
+		if err := rename(staged[i], o.path); err != nil {
+			rollback(done)
+			return err
+		}
+	}
+	for dir := range tmp {
+		syncDir(dir)
+	}
+	return nil
+}
+
+// missing は dir とその親のうち存在しないものを親から順に返します。
+func missing(dir string) []string {
+	var out []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Lstat(d); err == nil || filepath.Dir(d) == d {
+			break
+		}
+		out = append([]string{d}, out...)
+	}
+	return out
+}
+
+// WriteFile は 1 つのファイルを一時ファイル経由で置き換えます。
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	s := New()
+	s.Write(path, data, perm)
+	return s.Commit()
+}
+
+// rollback は反映済みの操作を逆順に取り消します。
+func rollback(done []undo) {
+	for i := len(done) - 1; i >= 0; i-- {
+		u := done[i]
+		os.Remove(u.path)
+		if u.backup != "" {
+			os.Rename(u.backup, u.path)
+		}
+	}
+}
+
+// writeSync はファイルを作成し、内容をディスクに書き出してから閉じます。
+func writeSync(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir はディレクトリエントリの変更をディスクに書き出します。
+// ディレクトリの同期に対応しない環境もあるためエラーは無視します。
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
@@ -0,0 +1,119 @@
+package stage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestCommit(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "a.pem")
+	gone := filepath.Join(dir, "b.pem")
+	os.WriteFile(old, []byte("old"), 0644)
+	os.WriteFile(gone, []byte("gone"), 0644)
+
+	s := New()
+	s.Write(old, []byte("new"), 0644)
+	s.Write(filepath.Join(dir, "sub", "c.pem"), []byte("c"), 0600)
+	s.Remove(gone)
+	s.Remove(filepath.Join(dir, "missing"))
+	if err := s.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if read(t, old) != "new" || read(t, filepath.Join(dir, "sub", "c.pem")) != "c" {
+		t.Fatal("files not replaced")
+	}
+	if _, err := os.Stat(gone); !os.IsNotExist(err) {
+		t.Fatalf("removed file exists: %v", err)
+	}
+	fi, err := os.Stat(filepath.Join(dir, "sub", "c.pem"))
+	if err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("perm: %v %v", fi, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if e.Name() != "a.pem" && e.Name() != "sub" {
+			t.Errorf("leftover %s", e.Name())
+		}
+	}
+}
+
+// TestCommit_Rollback は置き換えの途中で失敗した場合に元のファイルへ戻ることを確認します。
+func TestCommit_Rollback(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "key.pem")
+	cert := filepath.Join(dir, "cert.pem")
+	meta := filepath.Join(dir, "meta.json")
+	os.WriteFile(key, []byte("old key"), 0600)
+	os.WriteFile(cert, []byte("old cert"), 0644)
+
+	fail := errors.New("injected")
+	calls := 0
+	rename = func(from, to string) error {
+		calls++
+		if to == meta {
+			return fail
+		}
+		return os.Rename(from, to)
+	}
+	t.Cleanup(func() { rename = os.Rename })
+
+	s := New()
+	s.Write(key, []byte("new key"), 0600)
+	s.Write(cert, []byte("new cert"), 0644)
+	s.Write(meta, []byte("{}"), 0644)
+	if err := s.Commit(); !errors.Is(err, fail) {
+		t.Fatalf("got %v", err)
+	}
+	if read(t, key) != "old key" || read(t, cert) != "old cert" {
+		t.Fatal("files not rolled back")
+	}
+	if _, err := os.Stat(meta); !os.IsNotExist(err) {
+		t.Fatalf("new file left behind: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Fatalf("leftover entries: %v", entries)
+	}
+}
+
+func TestCommit_Directory(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "key.pem")
+	s := New()
+	s.Write(key, []byte("key"), 0600)
+	s.Write(filepath.Join(dir, "sub"), []byte("x"), 0644)
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	if err := s.Commit(); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := os.Stat(key); !os.IsNotExist(err) {
+		t.Fatalf("key written: %v", err)
+	}
+}
+
+// TestCommit_RemovesCreatedDirs は失敗した場合に Commit が作成したディレクトリを残さないことを確認します。
+func TestCommit_RemovesCreatedDirs(t *testing.T) {
+	dir := t.TempDir()
+	s := New()
+	s.Write(filepath.Join(dir, "archive", "01", "cert.pem"), []byte("old"), 0644)
+	s.Write(filepath.Join(dir, "sub"), []byte("x"), 0644)
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	if err := s.Commit(); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "archive")); !os.IsNotExist(err) {
+		t.Fatalf("created dir left behind: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package verify
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"orecert/internal/issue"
+	"orecert/internal/revoke"
+)
+
+func revokeCfg(dir string) revoke.Config {
+	c := revoke.Config{}
+	c.CA.Key = filepath.Join(dir, "certs", "ca", "key.pem")
+	c.CA.Cert = filepath.Join(dir, "certs", "ca", "cert.pem")
+	return c
+}
+
+func TestVerify_RevokedInCRL(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	os.Chdir(dir)
+	issueCert(t, dir, "crlrev", time.Now().AddDate(0, 0, 1), dir)
+	opt := revoke.Options{Reason: "keyCompromise"}
+	if err := revoke.RevokeWith(revokeCfg(dir), revoke.Profile{CN: "crlrev"}, opt); err != nil {
+		t.Fatal(err)
+	}
+	// 台帳が無くても CRL だけで失効を検出します。
+	os.Remove(filepath.Join(dir, "certs", "ca", "index.json"))
+	err := Verify(cfg, Profile{CN: "crlrev"})
+	var re *RevokedError
+	if !errors.As(err, &re) || !errors.Is(err, ErrRevoked) {
+		t.Fatalf("expected RevokedError, got %v", err)
+	}
+	if re.Reason != "keyCompromise" || re.RevokedAt.IsZero() {
+		t.Fatalf("reason/time missing: %+v", re)
+	}
+}
+
+func TestVerify_StaleCRL(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	os.Chdir(dir)
+	issueCert(t, dir, "stale", time.Now().AddDate(0, 0, 1), dir)
+	caCert, _ := issue.ReadCert(cfg.CA.Cert)
+	key, _ := issue.ReadKey(filepath.Join(dir, "certs", "ca", "key.pem"))
+	past := time.Now().AddDate(0, 0, -40)
+	if err := revoke.WriteCRL(filepath.Join(dir, "certs", "ca", "crl.pem"), caCert, key.(crypto.Signer), nil, big.NewInt(1), past, past.AddDate(0, 0, 30)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(cfg, Profile{CN: "stale"}); err != ErrCRLStale {
+		t.Fatalf("expected ErrCRLStale, got %v", err)
+	}
+}
+
+func TestVerify_CRLBadSignature(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	other := filepath.Join(dir, "other")
+	os.MkdirAll(other, 0755)
+	createCA(t, other)
+	os.Chdir(dir)
+	issueCert(t, dir, "badcrl", time.Now().AddDate(0, 0, 1), dir)
+	otherCert, _ := issue.ReadCert(filepath.Join(other, "certs", "ca", "cert.pem"))
+	otherKey, _ := issue.ReadKey(filepath.Join(other, "certs", "ca", "key.pem"))
+	now := time.Now()
+	var entries []x509.RevocationListEntry
+	if err := revoke.WriteCRL(filepath.Join(dir, "certs", "ca", "crl.pem"), otherCert, otherKey.(crypto.Signer), entries, big.NewInt(1), now, now.AddDate(0, 0, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(cfg, Profile{CN: "badcrl"}); err != ErrCRLSignature {
+		t.Fatalf("expected ErrCRLSignature, got %v", err)
+	}
+}
@@ -3,16 +3,20 @@ package verify
 import (
 	"crypto/x509"
 	"errors"
-	"path/filepath"
+	"fmt"
+	"os"
 	"strings"
 	"time"
 
+	"orecert/internal/db"
 	"orecert/internal/issue"
+	"orecert/internal/revoke"
 )
 
 // Config は verify 用設定です。
 type Config struct {
-	CA struct {
+	issue.Layout `mapstructure:",squash"`
+	CA           struct {
 		Cert string `mapstructure:"cert"`
 	} `mapstructure:"ca"`
 }
@@ -24,20 +28,43 @@ type Profile struct {
 
 // エラー定義
 var (
-	ErrExpired = errors.New("expired")
-	ErrVerify  = errors.New("verify failed")
+	ErrExpired      = errors.New("expired")
+	ErrVerify       = errors.New("verify failed")
+	ErrRevoked      = errors.New("revoked")
+	ErrCRLSignature = errors.New("crl signature invalid")
+	ErrCRLStale     = errors.New("crl is stale")
 )
 
+// RevokedError は失効済み証明書の失効日時と理由を保持します。
+// errors.Is(err, ErrRevoked) で判定できます。
+type RevokedError struct {
+	Serial    string
+	RevokedAt time.Time
+	Reason    string
+}
+
+func (e *RevokedError) Error() string {
+	return fmt.Sprintf("revoked: serial %s at %s (%s)", e.Serial, e.RevokedAt.UTC().Format(time.RFC3339), e.Reason)
+}
+
+// Unwrap は ErrRevoked を返します。
+func (e *RevokedError) Unwrap() error {
+	return ErrRevoked
+}
+
 // Verify は証明書と CA のチェーン検証を行います。
 func Verify(cfg Config, prof Profile) error {
 	if prof.CN == "" || strings.Contains(prof.CN, "..") || strings.ContainsAny(prof.CN, "/\\") {
 		return issue.ErrInvalidCN
 	}
 	if cfg.CA.Cert == "" {
-		cfg.CA.Cert = filepath.FromSlash("certs/ca/cert.pem")
+		cfg.CA.Cert = cfg.CAPath("cert.pem")
+	}
+	paths, err := cfg.Paths(prof.CN)
+	if err != nil {
+		return err
 	}
-	certPath := filepath.Join("certs", prof.CN, "cert.pem")
-	cert, err := issue.ReadCert(certPath)
+	cert, err := issue.ReadCert(paths.Cert)
 	if err != nil {
 		return err
 	}
@@ -50,8 +77,79 @@ func Verify(cfg Config, prof Profile) error {
 	}
 	pool := x509.NewCertPool()
 	pool.AddCert(caCert)
-	if _, err := cert.Verify(x509.VerifyOptions{Roots: pool, CurrentTime: time.Now()}); err != nil {
+	inter := x509.NewCertPool()
+	if chain, err := issue.ReadCerts(paths.Fullchain); err == nil {
+		for _, c := range chain[1:] {
+			inter.AddCert(c)
+		}
+	}
+	// 用途 (server 以外の client・codesign など) によらず検証するため、EKU は問いません。
+	chains, err := cert.Verify(x509.VerifyOptions{Roots: pool, Intermediates: inter, CurrentTime: time.Now(), KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	if err != nil {
 		return ErrVerify
 	}
+	// 末尾のルート CA を除く各証明書を、チェーン検証で求めた署名 CA の CRL で確認します。
+	issuers, err := issue.Issuers("", cfg.CA.Cert)
+	if err != nil {
+		return err
+	}
+	chain := chains[0]
+	for i := 0; i < len(chain)-1; i++ {
+		iss, err := issuerOf(issuers, chain[i+1])
+		if err != nil {
+			return err
+		}
+		if err := checkCRL(iss, chain[i], chain[i+1]); err != nil {
+			return err
+		}
+	}
+	rec, err := db.Lookup(db.Path(cfg.CA.Cert), db.SerialHex(cert.SerialNumber))
+	if err != nil && err != db.ErrNotFound {
+		return err
+	}
+	if err == nil && rec.Status == db.StatusRevoked {
+		e := &RevokedError{Serial: rec.Serial, Reason: rec.Reason}
+		if rec.RevokedAt != nil {
+			e.RevokedAt = *rec.RevokedAt
+		}
+		return e
+	}
+	return nil
+}
+
+// issuerOf は証明書が c である署名 CA を issuers から返します。
+func issuerOf(issuers []issue.Issuer, c *x509.Certificate) (issue.Issuer, error) {
+	for _, iss := range issuers {
+		if ic, err := issue.ReadCert(iss.Cert); err == nil && ic.Equal(c) {
+			return iss, nil
+		}
+	}
+	return issue.Issuer{}, issue.ErrUnknownIssuer
+}
+
+// checkCRL は cert が署名 CA iss (証明書は issuer) の CRL に載っていないことを確認します。
+// CRL の署名と NextUpdate も検証します。CRL ファイルが無い場合は確認しません。
+func checkCRL(iss issue.Issuer, cert, issuer *x509.Certificate) error {
+	rl, err := revoke.ReadCRL(iss.CRLPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if rl == nil {
+		return nil
+	}
+	if err := rl.CheckSignatureFrom(issuer); err != nil {
+		return ErrCRLSignature
+	}
+	if !rl.NextUpdate.IsZero() && time.Now().After(rl.NextUpdate) {
+		return ErrCRLStale
+	}
+	for _, e := range rl.RevokedCertificateEntries {
+		if e.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return &RevokedError{Serial: db.SerialHex(e.SerialNumber), RevokedAt: e.RevocationTime, Reason: revoke.ReasonString(e.ReasonCode)}
+		}
+	}
 	return nil
 }
@@ -6,6 +6,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"math/big"
 	"os"
 	"path/filepath"
@@ -14,6 +15,7 @@ import (
 
 	"orecert/internal/ca"
 	"orecert/internal/issue"
+	"orecert/internal/revoke"
 )
 
 func createCA(t *testing.T, dir string) Config {
@@ -74,6 +76,26 @@ func TestVerify_OK(t *testing.T) {
 	}
 }
 
+// TestVerify_Types は server 以外の用途の証明書も検証できることを確認します。
+func TestVerify_Types(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	icfg := issue.Config{}
+	icfg.CA.Key = filepath.Join(dir, "certs", "ca", "key.pem")
+	icfg.CA.Cert = cfg.CA.Cert
+	for _, typ := range []string{"client", "codesign", "smime", "timestamp", "ocsp"} {
+		if err := issue.Issue(icfg, issue.Profile{CN: typ}, typ); err != nil {
+			t.Fatalf("issue %s: %v", typ, err)
+		}
+		if err := Verify(cfg, Profile{CN: typ}); err != nil {
+			t.Errorf("verify %s: %v", typ, err)
+		}
+	}
+}
+
 func TestVerify_Expired(t *testing.T) {
 	dir := t.TempDir()
 	cfg := createCA(t, dir)
@@ -114,3 +136,28 @@ func TestVerify_ChainFail(t *testing.T) {
 		t.Fatalf("expected ErrVerify, got %v", err)
 	}
 }
+
+func TestVerify_RevokedInDatabase(t *testing.T) {
+	dir := t.TempDir()
+	cfg := createCA(t, dir)
+	os.Chdir(dir)
+	icfg := issue.Config{}
+	icfg.CA.Key = filepath.Join(dir, "certs", "ca", "key.pem")
+	icfg.CA.Cert = cfg.CA.Cert
+	if err := issue.Issue(icfg, issue.Profile{CN: "rev"}, "server"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(cfg, Profile{CN: "rev"}); err != nil {
+		t.Fatalf("valid record: %v", err)
+	}
+	rcfg := revoke.Config{}
+	rcfg.CA = icfg.CA
+	if err := revoke.Revoke(rcfg, revoke.Profile{CN: "rev"}); err != nil {
+		t.Fatal(err)
+	}
+	// CRL が無くても台帳の失効状態で拒否します。
+	os.Remove(filepath.Join(dir, "certs", "ca", "crl.pem"))
+	if err := Verify(cfg, Profile{CN: "rev"}); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("expected ErrRevoked, got %v", err)
+	}
+}